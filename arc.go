@@ -0,0 +1,416 @@
+package lazylru
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	heap "github.com/TriggerMail/lazylru/containers/heap"
+)
+
+// the four lists of an adaptive replacement cache
+const (
+	arcT1 uint8 = iota // resident, seen once recently
+	arcT2              // resident, seen at least twice recently
+	arcB1              // ghosts of items evicted from arcT1
+	arcB2              // ghosts of items evicted from arcT2
+)
+
+// ARC is a scan-resistant variant of LazyLRU based on the Adaptive Replacement
+// Cache algorithm (Megiddo & Modha). Items seen once live in a recency list
+// and items seen more than once live in a frequency list. When items are
+// evicted, their keys are remembered in a pair of ghost lists. A write to a
+// key in one of the ghost lists shows that the corresponding list was too
+// small, so the target size of the recency list adapts toward whichever list
+// is producing ghost hits.
+//
+// A full scan of the key space only churns the recency list, so items that
+// have been read more than once survive the scan. The current target size of
+// the recency list is exposed as Stats().AdaptiveTarget.
+//
+// Like LazyLRU, each list is a heap ordered by insert number, and items in the
+// frequency list are only reshuffled on read when they are in the oldest
+// quarter of that list.
+type ARC[K comparable, V any] struct {
+	onEvict    []EvictCB[K, V]
+	doneCh     chan int
+	index      map[K]*item[K, V]
+	lists      [4]itemPQ[K, V]
+	maxItems   int
+	target     int
+	itemIx     uint64
+	ttl        time.Duration
+	stats      Stats
+	lock       sync.RWMutex
+	isRunning  bool
+	isClosing  bool
+	numEvictCB atomic.Int32
+}
+
+// NewARC creates an ARC with the given capacity and default expiration. Up to
+// maxItems values are held in the cache, and up to maxItems keys are held in
+// the ghost lists. If maxItems is zero or fewer, the cache will not hold
+// anything. If ttl is greater than zero, a background ticker will be engaged
+// to proactively remove expired items.
+func NewARC[K comparable, V any](maxItems int, ttl time.Duration) *ARC[K, V] {
+	if maxItems < 0 {
+		maxItems = 0
+	}
+
+	arc := &ARC[K, V]{
+		index:    map[K]*item[K, V]{},
+		maxItems: maxItems,
+		itemIx:   1, // starting at 1 means that 0 can always be popped
+		ttl:      ttl,
+		doneCh:   make(chan int),
+	}
+
+	if ttl > 0 {
+		arc.reaper()
+	} else {
+		arc.isClosing = true
+		close(arc.doneCh)
+	}
+
+	return arc
+}
+
+// OnEvict registers a callback that will be executed when items are removed
+// from the cache via eviction due to max size, because the TTL has been
+// exceeded, or because they were deleted. Keys moving into the ghost lists are
+// considered evicted. The same caveats as LazyLRU.OnEvict apply.
+func (arc *ARC[K, V]) OnEvict(cb EvictCB[K, V]) {
+	arc.lock.Lock()
+	arc.onEvict = append(arc.onEvict, cb)
+	arc.numEvictCB.Add(1)
+	arc.lock.Unlock()
+}
+
+func (arc *ARC[K, V]) execOnEvict(deathList []*item[K, V]) {
+	if len(deathList) == 0 || arc.numEvictCB.Load() == 0 {
+		return
+	}
+
+	arc.lock.RLock()
+	callbacks := arc.onEvict
+	arc.lock.RUnlock()
+
+	for _, item := range deathList {
+		for _, cb := range callbacks {
+			cb(item.key, item.value)
+		}
+	}
+}
+
+// IsRunning indicates whether the background reaper is active
+func (arc *ARC[K, V]) IsRunning() bool {
+	arc.lock.RLock()
+	defer arc.lock.RUnlock()
+	return arc.isRunning
+}
+
+// reaper engages a background goroutine to check a random window of each
+// resident list for expired items on a regular basis.
+func (arc *ARC[K, V]) reaper() {
+	watchTime := arc.ttl / 10
+	if watchTime < time.Millisecond {
+		watchTime = time.Millisecond
+	}
+	if watchTime > time.Second {
+		watchTime = time.Second
+	}
+	ticker := time.NewTicker(watchTime)
+	arc.isRunning = true
+	go func() {
+		for {
+			select {
+			case <-arc.doneCh:
+				ticker.Stop()
+				arc.lock.Lock()
+				arc.isRunning = false
+				arc.lock.Unlock()
+				return
+			case <-ticker.C:
+				arc.reap(-1)
+			}
+		}
+	}()
+}
+
+// Reap removes all expired items from the cache
+func (arc *ARC[K, V]) Reap() {
+	arc.reap(0)
+}
+
+func (arc *ARC[K, V]) reap(start int) {
+	timestamp := time.Now()
+	var deathList []*item[K, V]
+
+	arc.lock.RLock()
+	for _, l := range []uint8{arcT1, arcT2} {
+		pq := arc.lists[l]
+		if len(pq) == 0 {
+			continue
+		}
+		from, end := start, len(pq)
+		if from < 0 {
+			from = rand.IntN(len(pq)) //nolint:gosec
+			end = min(from+100, len(pq))
+		}
+		for i := from; i < end; i++ {
+			if pq[i].expiration.Before(timestamp) {
+				deathList = append(deathList, pq[i])
+			}
+		}
+	}
+	arc.lock.RUnlock()
+	atomic.AddUint32(&arc.stats.ReaperCycles, 1)
+
+	if len(deathList) == 0 {
+		return
+	}
+
+	arc.lock.Lock()
+	n := 0
+	for _, pqi := range deathList {
+		// it may have been touched between the locks
+		if arc.index[pqi.key] == pqi && pqi.list <= arcT2 && pqi.expiration.Before(timestamp) {
+			arc.remove(pqi)
+			arc.stats.KeysReaped++
+			deathList[n] = pqi
+			n++
+		}
+	}
+	arc.lock.Unlock()
+	arc.execOnEvict(deathList[:n])
+}
+
+// shouldBubble determines if an item in the frequency list is close enough to
+// the front of that list to be worth moving on read. This is NOT thread safe
+// and should only be called with a lock in place.
+func (arc *ARC[K, V]) shouldBubble(pqi *item[K, V]) bool {
+	return pqi.list == arcT1 || pqi.index <= len(arc.lists[arcT2])>>2
+}
+
+// Get retrieves a value from the cache. The returned bool indicates whether the
+// key was found in the cache. Keys held only in the ghost lists are not found.
+func (arc *ARC[K, V]) Get(key K) (V, bool) {
+	var zero V
+	arc.lock.RLock()
+	pqi, ok := arc.index[key]
+	if !ok || pqi.list > arcT2 {
+		arc.lock.RUnlock()
+		atomic.AddUint32(&arc.stats.KeysReadNotFound, 1)
+		return zero, false
+	}
+	value, expiration := pqi.value, pqi.expiration
+	bubble := arc.shouldBubble(pqi)
+	arc.lock.RUnlock()
+
+	if expiration.Before(time.Now()) {
+		arc.lock.Lock()
+		// double check in case this has already been removed
+		if arc.index[key] == pqi && pqi.list <= arcT2 && pqi.expiration.Before(time.Now()) {
+			arc.remove(pqi)
+			arc.stats.KeysReadExpired++
+		}
+		arc.lock.Unlock()
+		return zero, false
+	}
+
+	if bubble {
+		arc.lock.Lock()
+		// double check because someone else may have shuffled
+		if arc.index[key] == pqi && pqi.list <= arcT2 && arc.shouldBubble(pqi) {
+			arc.move(pqi, arcT2)
+			arc.stats.Shuffles++
+		}
+		arc.lock.Unlock()
+	}
+
+	atomic.AddUint32(&arc.stats.KeysReadOK, 1)
+	return value, true
+}
+
+// Set writes to the cache
+func (arc *ARC[K, V]) Set(key K, value V) {
+	arc.SetTTL(key, value, arc.ttl)
+}
+
+// SetTTL writes to the cache, expiring with the given time-to-live value
+func (arc *ARC[K, V]) SetTTL(key K, value V, ttl time.Duration) {
+	arc.lock.Lock()
+	deathList := arc.setInternal(key, value, time.Now().Add(ttl))
+	arc.lock.Unlock()
+	arc.execOnEvict(deathList)
+}
+
+// setInternal writes elements. This is NOT thread safe and should always be
+// called with a write lock
+func (arc *ARC[K, V]) setInternal(key K, value V, expiration time.Time) []*item[K, V] {
+	if arc.maxItems <= 0 {
+		return nil
+	}
+	arc.stats.KeysWritten++
+	pqi, ok := arc.index[key]
+	if ok && pqi.list <= arcT2 {
+		// a hit in either resident list promotes to the frequency list
+		pqi.value = value
+		pqi.expiration = expiration
+		arc.move(pqi, arcT2)
+		return nil
+	}
+
+	var deathList []*item[K, V]
+	if ok {
+		// a ghost hit means the list it came from was too small
+		arc.stats.GhostHits++
+		b1, b2 := len(arc.lists[arcB1]), len(arc.lists[arcB2])
+		if pqi.list == arcB1 {
+			arc.target = min(arc.maxItems, arc.target+max(1, b2/b1))
+		} else {
+			arc.target = max(0, arc.target-max(1, b1/b2))
+		}
+		arc.stats.AdaptiveTarget = uint32(arc.target) //nolint:gosec
+		deathList = arc.replace(pqi.list == arcB2, deathList)
+		heap.Remove(&arc.lists[pqi.list], pqi.index)
+		pqi.value = value
+		pqi.expiration = expiration
+		arc.push(pqi, arcT2)
+		return deathList
+	}
+
+	if len(arc.lists[arcT1])+len(arc.lists[arcB1]) >= arc.maxItems {
+		if len(arc.lists[arcT1]) < arc.maxItems {
+			arc.dropGhost(arcB1)
+			deathList = arc.replace(false, deathList)
+		} else {
+			deadGuy := heap.Pop(&arc.lists[arcT1])
+			delete(arc.index, deadGuy.key)
+			deathList = append(deathList, deadGuy)
+			arc.stats.Evictions++
+		}
+	} else if arc.totalLen() >= arc.maxItems {
+		if arc.totalLen() >= 2*arc.maxItems {
+			arc.dropGhost(arcB2)
+		}
+		deathList = arc.replace(false, deathList)
+	}
+
+	pqi = &item[K, V]{
+		value:      value,
+		key:        key,
+		expiration: expiration,
+	}
+	arc.push(pqi, arcT1)
+	arc.index[key] = pqi
+	return deathList
+}
+
+// replace makes room for a new resident item, if needed, by moving the oldest
+// item from one of the resident lists into the matching ghost list. This is
+// NOT thread safe and should always be called with a write lock
+func (arc *ARC[K, V]) replace(inB2 bool, deathList []*item[K, V]) []*item[K, V] {
+	if len(arc.lists[arcT1])+len(arc.lists[arcT2]) < arc.maxItems {
+		return deathList
+	}
+	from, to := arcT2, arcB2
+	if t1 := len(arc.lists[arcT1]); t1 > 0 && (t1 > arc.target || (inB2 && t1 == arc.target) || len(arc.lists[arcT2]) == 0) {
+		from, to = arcT1, arcB1
+	}
+	deadGuy := heap.Pop(&arc.lists[from])
+	deathList = append(deathList, deadGuy)
+	arc.stats.Evictions++
+
+	// the evicted item keeps its value for the callbacks, so the ghost needs
+	// to be a separate item
+	ghost := &item[K, V]{key: deadGuy.key}
+	arc.push(ghost, to)
+	arc.index[ghost.key] = ghost
+	return deathList
+}
+
+// dropGhost forgets the oldest key in a ghost list. This is NOT thread safe
+// and should always be called with a write lock
+func (arc *ARC[K, V]) dropGhost(list uint8) {
+	if len(arc.lists[list]) > 0 {
+		ghost := heap.Pop(&arc.lists[list])
+		delete(arc.index, ghost.key)
+	}
+}
+
+// push adds an item as the newest member of a list. This is NOT thread safe
+// and should always be called with a write lock
+func (arc *ARC[K, V]) push(pqi *item[K, V], list uint8) {
+	pqi.list = list
+	pqi.insertNumber = atomic.AddUint64(&arc.itemIx, 1)
+	heap.Push(&arc.lists[list], pqi)
+}
+
+// move makes an item the newest member of a list, taking it out of whichever
+// list it is in now. This is NOT thread safe and should always be called with
+// a write lock
+func (arc *ARC[K, V]) move(pqi *item[K, V], list uint8) {
+	if pqi.list == list {
+		arc.lists[list].update(pqi, atomic.AddUint64(&arc.itemIx, 1))
+		return
+	}
+	heap.Remove(&arc.lists[pqi.list], pqi.index)
+	arc.push(pqi, list)
+}
+
+// remove takes an item out of the cache entirely, without leaving a ghost.
+// This is NOT thread safe and should always be called with a write lock
+func (arc *ARC[K, V]) remove(pqi *item[K, V]) {
+	heap.Remove(&arc.lists[pqi.list], pqi.index)
+	delete(arc.index, pqi.key)
+}
+
+// totalLen counts resident and ghost entries. This is NOT thread safe and
+// should only be called with a lock in place.
+func (arc *ARC[K, V]) totalLen() int {
+	return len(arc.lists[arcT1]) + len(arc.lists[arcT2]) + len(arc.lists[arcB1]) + len(arc.lists[arcB2])
+}
+
+// Delete eliminates a key from the cache, including any ghost entry. Removing
+// a key that is not in the index is safe.
+func (arc *ARC[K, V]) Delete(key K) {
+	arc.lock.Lock()
+	pqi, ok := arc.index[key]
+	if !ok {
+		arc.lock.Unlock()
+		return
+	}
+	arc.remove(pqi)
+	arc.lock.Unlock()
+	if pqi.list <= arcT2 {
+		arc.execOnEvict([]*item[K, V]{pqi})
+	}
+}
+
+// Len returns the number of resident items in the cache
+func (arc *ARC[K, V]) Len() int {
+	arc.lock.RLock()
+	defer arc.lock.RUnlock()
+	return len(arc.lists[arcT1]) + len(arc.lists[arcT2])
+}
+
+// Close stops the reaper process. This is safe to call multiple times.
+func (arc *ARC[K, V]) Close() {
+	arc.lock.Lock()
+	if !arc.isClosing {
+		close(arc.doneCh)
+		arc.isClosing = true
+	}
+	arc.lock.Unlock()
+}
+
+// Stats gets a copy of the stats held by the cache. Note that this is a copy,
+// so returned objects will not update as the service continues to execute.
+func (arc *ARC[K, V]) Stats() Stats {
+	// note that this returns a copy of stats, not a reference
+	arc.lock.RLock()
+	defer arc.lock.RUnlock()
+	return arc.stats.load()
+}
@@ -0,0 +1,145 @@
+package lazylru_test
+
+import (
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+func doARCTest[K comparable, V any](t *testing.T, maxItems int, ttl time.Duration, test func(t *testing.T, arc *lazylru.ARC[K, V]), expected ExpectedStats) {
+	arc := lazylru.NewARC[K, V](maxItems, ttl)
+	test(t, arc)
+	arc.Close()
+	expected.Test(t, arc.Stats())
+}
+
+func TestARCGetKnown(t *testing.T) {
+	doARCTest(t, 10, time.Hour, func(t *testing.T, arc *lazylru.ARC[string, string]) {
+		arc.Set("abloy", "medeco")
+		v, ok := arc.Get("abloy")
+		require.True(t, ok)
+		require.Equal(t, "medeco", v)
+		_, ok = arc.Get("schlage")
+		require.False(t, ok)
+	},
+		ExpectedStats{}.WithKeysWritten(1).WithKeysReadOK(1).WithKeysReadNotFound(1),
+	)
+}
+
+func TestARCScanResistant(t *testing.T) {
+	doARCTest(t, 10, time.Hour, func(t *testing.T, arc *lazylru.ARC[int, int]) {
+		// five hot keys, each read after being written
+		for i := 0; i < 5; i++ {
+			arc.Set(i, i)
+			_, ok := arc.Get(i)
+			require.True(t, ok)
+		}
+
+		// a scan of many cold keys
+		for i := 100; i < 200; i++ {
+			arc.Set(i, i)
+		}
+		require.Equal(t, 10, arc.Len())
+
+		for i := 0; i < 5; i++ {
+			v, ok := arc.Get(i)
+			require.True(t, ok, "hot key %d", i)
+			require.Equal(t, i, v)
+		}
+	},
+		ExpectedStats{}.WithKeysWritten(105).WithEvictions(95),
+	)
+}
+
+func TestARCGhostHitAdapts(t *testing.T) {
+	doARCTest(t, 4, time.Hour, func(t *testing.T, arc *lazylru.ARC[int, int]) {
+		// 0 and 1 go to the frequency list
+		for i := 0; i < 2; i++ {
+			arc.Set(i, i)
+			_, ok := arc.Get(i)
+			require.True(t, ok)
+		}
+		arc.Set(2, 2)
+		arc.Set(3, 3)
+		// 2 is pushed out of the recency list and into its ghost list
+		arc.Set(4, 4)
+		require.Equal(t, 4, arc.Len())
+		require.Zero(t, arc.Stats().AdaptiveTarget)
+		_, ok := arc.Get(2)
+		require.False(t, ok)
+
+		// a ghost hit means the recency list should grow
+		arc.Set(2, 2)
+		v, ok := arc.Get(2)
+		require.True(t, ok)
+		require.Equal(t, 2, v)
+		require.Equal(t, 4, arc.Len())
+		require.Equal(t, uint32(1), arc.Stats().AdaptiveTarget)
+	},
+		ExpectedStats{}.WithKeysWritten(6).WithGhostHits(1).WithEvictions(2),
+	)
+}
+
+func TestARCExpired(t *testing.T) {
+	doARCTest(t, 10, time.Hour, func(t *testing.T, arc *lazylru.ARC[string, string]) {
+		arc.SetTTL("abloy", "medeco", 0)
+		arc.SetTTL("schlage", "kwikset", time.Millisecond)
+		_, ok := arc.Get("abloy")
+		require.False(t, ok)
+		time.Sleep(2 * time.Millisecond)
+		arc.Reap()
+		require.Equal(t, 0, arc.Len())
+	},
+		ExpectedStats{}.WithKeysWritten(2).WithKeysReadExpired(1).WithKeysReaped(1),
+	)
+}
+
+func TestARCCallbacks(t *testing.T) {
+	var evicted []int
+	arc := lazylru.NewARC[int, int](5, time.Hour)
+	defer arc.Close()
+	arc.OnEvict(func(k, v int) {
+		require.Equal(t, k<<4, v)
+		evicted = append(evicted, k)
+	})
+	for i := 0; i < 10; i++ {
+		arc.Set(i, i<<4)
+	}
+	require.Equal(t, []int{0, 1, 2, 3, 4}, evicted)
+	arc.Delete(9)
+	arc.Delete(0) // ghost only, no callback
+	require.Equal(t, []int{0, 1, 2, 3, 4, 9}, evicted)
+	require.Equal(t, 4, arc.Len())
+}
+
+func TestARCClose(t *testing.T) {
+	arc := lazylru.NewARC[string, string](10, time.Hour)
+	require.True(t, arc.IsRunning())
+	arc.Close()
+	time.Sleep(time.Millisecond * 10)
+	require.False(t, arc.IsRunning())
+	arc.Close() // ensure double-close is safe
+}
+
+func TestARCStatsConcurrent(t *testing.T) {
+	arc := lazylru.NewARC[int, int](10, time.Hour)
+	defer arc.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			arc.Set(i%20, i)
+			arc.Get(i % 20)
+		}
+	}()
+	// the race detector flags Stats if it reads counters that writers bump
+	for i := 0; i < 100; i++ {
+		_ = arc.Stats()
+	}
+	<-done
+	stats := arc.Stats()
+	require.Equal(t, uint32(1000), stats.KeysWritten)
+	require.Equal(t, uint32(1000), stats.KeysReadOK+stats.KeysReadNotFound)
+}
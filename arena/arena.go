@@ -0,0 +1,360 @@
+// Package arena is an LRU cache of byte values that keeps its keys and values
+// in large chunks of memory rather than in individual allocations. Entries are
+// referenced by integer handles and offsets, so the garbage collector sees a
+// few big byte slices and a map of integers instead of millions of pointers,
+// which keeps mark phases short for very large caches.
+//
+// Overwritten, deleted, and evicted entries leave holes in the chunks. When
+// enough of the arena is holes, the live entries are copied into new chunks
+// and the old ones are dropped.
+package arena
+
+import (
+	"errors"
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+// ErrTooLarge is returned when an entry is bigger than the whole cache
+var ErrTooLarge = errors.New("entry is larger than the cache")
+
+// Options controls how the cache behaves
+type Options struct {
+	// MaxItems is the maximum number of entries. Zero means no limit.
+	MaxItems int
+	// MaxBytes is the maximum number of bytes of keys and values held. Zero
+	// means no limit.
+	MaxBytes int64
+	// ChunkSize is the size of each chunk of the arena. Entries that are bigger
+	// get a chunk of their own. The default is 1 MiB.
+	ChunkSize int
+	// TTL is how long entries live. Zero means they never expire.
+	TTL time.Duration
+	// CompactRatio triggers a compaction when more than this fraction of the
+	// arena is taken up by dead entries. The default is 0.5. A negative value
+	// never compacts automatically.
+	CompactRatio float64
+}
+
+const defaultChunkSize = 1 << 20
+
+// Stats represents counts of actions against the cache
+type Stats struct {
+	Keys        int   // entries in the cache
+	LiveBytes   int64 // bytes of keys and values in the cache
+	ArenaBytes  int64 // bytes written to the arena, live or dead
+	Chunks      int   // chunks in the arena
+	Hits        uint64
+	Misses      uint64
+	Expired     uint64 // reads that found an expired entry
+	Writes      uint64
+	Evictions   uint64
+	Compactions uint64
+}
+
+// slot describes one entry. It holds no pointers, so a slice of them is never
+// scanned by the garbage collector.
+type slot struct {
+	hash       uint64
+	expiration int64 // unix nanoseconds, or zero for never
+	chunk      uint32
+	offset     uint32
+	klen       uint32
+	vlen       uint32
+	prev, next uint32 // the LRU list, most recent first; 0 is the end
+	chain      uint32 // the next slot with the same hash; 0 is the end
+}
+
+// Cache is an LRU cache of byte values held in an arena. It is safe for
+// concurrent use.
+type Cache struct {
+	seed   maphash.Seed
+	index  map[uint64]uint32 // hash to the first slot with that hash
+	slots  []slot            // slot 0 is never used, so 0 can mean "none"
+	free   []uint32          // slots that can be reused
+	chunks [][]byte          // each chunk's length is how much of it is used
+	opts   Options
+	head   uint32 // most recently used
+	tail   uint32 // least recently used
+	live   int64
+	used   int64
+	stats  Stats
+	lock   sync.Mutex
+}
+
+// New creates an empty cache
+func New(opts Options) *Cache {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = defaultChunkSize
+	}
+	if opts.CompactRatio == 0 {
+		opts.CompactRatio = 0.5
+	}
+	return &Cache{
+		seed:  maphash.MakeSeed(),
+		index: map[uint64]uint32{},
+		slots: make([]slot, 1),
+		opts:  opts,
+	}
+}
+
+// Get reads a copy of a value. The returned bool indicates whether the key was
+// found.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	return c.AppendGet(nil, key)
+}
+
+// AppendGet appends a value to dst, which saves an allocation when dst has
+// room. The returned bool indicates whether the key was found; if not, dst is
+// returned unchanged.
+func (c *Cache) AppendGet(dst []byte, key string) ([]byte, bool) {
+	hash := maphash.String(c.seed, key)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	h := c.find(hash, key)
+	if h == 0 {
+		c.stats.Misses++
+		return dst, false
+	}
+	s := &c.slots[h]
+	if s.expiration != 0 && s.expiration < time.Now().UnixNano() {
+		c.remove(h)
+		c.stats.Expired++
+		return dst, false
+	}
+	c.stats.Hits++
+	c.moveToFront(h)
+	return append(dst, c.value(s)...), true
+}
+
+// Set writes a value. The key and value are copied into the arena.
+func (c *Cache) Set(key string, value []byte) error {
+	return c.SetTTL(key, value, c.opts.TTL)
+}
+
+// SetTTL writes a value that expires after the given time-to-live. Zero means
+// it never expires.
+func (c *Cache) SetTTL(key string, value []byte, ttl time.Duration) error {
+	size := int64(len(key) + len(value))
+	if c.opts.MaxBytes > 0 && size > c.opts.MaxBytes {
+		return ErrTooLarge
+	}
+	var expiration int64
+	if ttl > 0 {
+		expiration = time.Now().Add(ttl).UnixNano()
+	}
+	hash := maphash.String(c.seed, key)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if h := c.find(hash, key); h != 0 {
+		c.remove(h)
+	}
+	for c.tail != 0 && c.full(size) {
+		c.remove(c.tail)
+		c.stats.Evictions++
+	}
+	if c.shouldCompact() {
+		c.compact()
+	}
+
+	chunk, offset := c.alloc(int(size))
+	buf := c.chunks[chunk][offset : int(offset)+int(size)]
+	copy(buf, key)
+	copy(buf[len(key):], value)
+
+	h := c.newSlot()
+	c.slots[h] = slot{
+		hash:       hash,
+		expiration: expiration,
+		chunk:      chunk,
+		offset:     offset,
+		klen:       uint32(len(key)),
+		vlen:       uint32(len(value)),
+		chain:      c.index[hash],
+	}
+	c.index[hash] = h
+	c.pushFront(h)
+	c.live += size
+	c.stats.Writes++
+	return nil
+}
+
+// Delete removes a key. Deleting a key that is not in the cache is safe.
+func (c *Cache) Delete(key string) {
+	hash := maphash.String(c.seed, key)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if h := c.find(hash, key); h != 0 {
+		c.remove(h)
+	}
+}
+
+// Len returns the number of entries in the cache, including any that have
+// expired but not been read or evicted yet
+func (c *Cache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.count()
+}
+
+// Compact copies the live entries into new chunks and drops the old ones
+func (c *Cache) Compact() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.compact()
+}
+
+// Stats gets a copy of the stats held by the cache
+func (c *Cache) Stats() Stats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	stats := c.stats
+	stats.Keys = c.count()
+	stats.LiveBytes = c.live
+	stats.ArenaBytes = c.used
+	stats.Chunks = len(c.chunks)
+	return stats
+}
+
+// count returns the number of slots in use. This is NOT thread safe and
+// should always be called with a lock
+func (c *Cache) count() int {
+	return len(c.slots) - 1 - len(c.free)
+}
+
+// find looks up the slot for a key, or 0 if it is not there. This is NOT
+// thread safe and should always be called with a lock
+func (c *Cache) find(hash uint64, key string) uint32 {
+	for h := c.index[hash]; h != 0; h = c.slots[h].chain {
+		s := &c.slots[h]
+		// the conversion in a comparison doesn't allocate
+		if string(c.chunks[s.chunk][s.offset:s.offset+s.klen]) == key {
+			return h
+		}
+	}
+	return 0
+}
+
+func (c *Cache) value(s *slot) []byte {
+	start := s.offset + s.klen
+	return c.chunks[s.chunk][start : start+s.vlen]
+}
+
+// full decides whether an entry of the given size needs room to be made
+func (c *Cache) full(size int64) bool {
+	if c.opts.MaxItems > 0 && c.count() >= c.opts.MaxItems {
+		return true
+	}
+	return c.opts.MaxBytes > 0 && c.live+size > c.opts.MaxBytes
+}
+
+// alloc finds room for size bytes in the arena, starting a new chunk if the
+// last one is full
+func (c *Cache) alloc(size int) (uint32, uint32) {
+	if n := len(c.chunks); n > 0 {
+		last := c.chunks[n-1]
+		if len(last)+size <= cap(last) {
+			c.chunks[n-1] = last[:len(last)+size]
+			c.used += int64(size)
+			return uint32(n - 1), uint32(len(last))
+		}
+	}
+	c.chunks = append(c.chunks, make([]byte, size, max(size, c.opts.ChunkSize)))
+	c.used += int64(size)
+	return uint32(len(c.chunks) - 1), 0
+}
+
+func (c *Cache) newSlot() uint32 {
+	if n := len(c.free); n > 0 {
+		h := c.free[n-1]
+		c.free = c.free[:n-1]
+		return h
+	}
+	c.slots = append(c.slots, slot{})
+	return uint32(len(c.slots) - 1)
+}
+
+// remove takes a slot out of the index and the LRU list and frees it. Its
+// bytes stay in the arena until the next compaction.
+func (c *Cache) remove(h uint32) {
+	s := &c.slots[h]
+	if head := c.index[s.hash]; head == h {
+		if s.chain == 0 {
+			delete(c.index, s.hash)
+		} else {
+			c.index[s.hash] = s.chain
+		}
+	} else {
+		for p := head; p != 0; p = c.slots[p].chain {
+			if c.slots[p].chain == h {
+				c.slots[p].chain = s.chain
+				break
+			}
+		}
+	}
+	c.unlink(h)
+	c.live -= int64(s.klen + s.vlen)
+	*s = slot{}
+	c.free = append(c.free, h)
+}
+
+func (c *Cache) pushFront(h uint32) {
+	s := &c.slots[h]
+	s.prev, s.next = 0, c.head
+	if c.head != 0 {
+		c.slots[c.head].prev = h
+	}
+	c.head = h
+	if c.tail == 0 {
+		c.tail = h
+	}
+}
+
+func (c *Cache) unlink(h uint32) {
+	s := &c.slots[h]
+	if s.prev != 0 {
+		c.slots[s.prev].next = s.next
+	} else {
+		c.head = s.next
+	}
+	if s.next != 0 {
+		c.slots[s.next].prev = s.prev
+	} else {
+		c.tail = s.prev
+	}
+	s.prev, s.next = 0, 0
+}
+
+func (c *Cache) moveToFront(h uint32) {
+	if c.head == h {
+		return
+	}
+	c.unlink(h)
+	c.pushFront(h)
+}
+
+// shouldCompact decides whether there are enough dead bytes to compact. Small
+// arenas are left alone, since there is little to gain.
+func (c *Cache) shouldCompact() bool {
+	dead := c.used - c.live
+	return c.opts.CompactRatio > 0 &&
+		c.used >= int64(c.opts.ChunkSize) &&
+		float64(dead) > float64(c.used)*c.opts.CompactRatio
+}
+
+// compact copies the live entries, oldest first, into new chunks
+func (c *Cache) compact() {
+	old := c.chunks
+	c.chunks = nil
+	c.used = 0
+	for h := c.tail; h != 0; h = c.slots[h].prev {
+		s := &c.slots[h]
+		size := int(s.klen + s.vlen)
+		chunk, offset := c.alloc(size)
+		copy(c.chunks[chunk][offset:], old[s.chunk][s.offset:int(s.offset)+size])
+		s.chunk, s.offset = chunk, offset
+	}
+	c.stats.Compactions++
+}
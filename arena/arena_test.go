@@ -0,0 +1,167 @@
+package arena_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/TriggerMail/lazylru/arena"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSetDelete(t *testing.T) {
+	c := arena.New(arena.Options{MaxItems: 10})
+	require.NoError(t, c.Set("a", []byte("one")))
+	require.NoError(t, c.Set("b", []byte("two")))
+	require.NoError(t, c.Set("a", []byte("uno")))
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	require.Equal(t, []byte("uno"), v)
+
+	// reads are copies
+	v[0] = 'X'
+	v, _ = c.Get("a")
+	require.Equal(t, []byte("uno"), v)
+
+	buf := make([]byte, 0, 16)
+	buf, ok = c.AppendGet(buf, "b")
+	require.True(t, ok)
+	require.Equal(t, []byte("two"), buf)
+
+	_, ok = c.Get("c")
+	require.False(t, ok)
+
+	c.Delete("a")
+	c.Delete("c")
+	_, ok = c.Get("a")
+	require.False(t, ok)
+	require.Equal(t, 1, c.Len())
+
+	stats := c.Stats()
+	require.Equal(t, 1, stats.Keys)
+	require.Equal(t, int64(len("b")+len("two")), stats.LiveBytes)
+	require.Equal(t, uint64(3), stats.Hits)
+	require.Equal(t, uint64(2), stats.Misses)
+	require.Equal(t, uint64(3), stats.Writes)
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c := arena.New(arena.Options{MaxItems: 3})
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, c.Set(key, []byte(key)))
+	}
+	_, ok := c.Get("a")
+	require.True(t, ok)
+	require.NoError(t, c.Set("d", []byte("d"))) // evicts b
+	_, ok = c.Get("b")
+	require.False(t, ok)
+	for _, key := range []string{"a", "c", "d"} {
+		_, ok := c.Get(key)
+		require.True(t, ok, key)
+	}
+	require.Equal(t, uint64(1), c.Stats().Evictions)
+}
+
+func TestMaxBytes(t *testing.T) {
+	c := arena.New(arena.Options{MaxBytes: 20})
+	require.NoError(t, c.Set("a", make([]byte, 9)))  // 10 bytes
+	require.NoError(t, c.Set("b", make([]byte, 9)))  // 20 bytes
+	require.NoError(t, c.Set("c", make([]byte, 14))) // evicts a and b
+	require.Equal(t, 1, c.Len())
+	require.ErrorIs(t, c.Set("d", make([]byte, 20)), arena.ErrTooLarge)
+}
+
+func TestExpiration(t *testing.T) {
+	c := arena.New(arena.Options{TTL: time.Hour})
+	require.NoError(t, c.SetTTL("a", []byte("a"), 10*time.Millisecond))
+	require.NoError(t, c.Set("b", []byte("b")))
+	time.Sleep(20 * time.Millisecond)
+	_, ok := c.Get("a")
+	require.False(t, ok)
+	_, ok = c.Get("b")
+	require.True(t, ok)
+	require.Equal(t, uint64(1), c.Stats().Expired)
+	require.Equal(t, 1, c.Len())
+}
+
+func TestCompaction(t *testing.T) {
+	c := arena.New(arena.Options{MaxItems: 10, ChunkSize: 64})
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i%10)
+		require.NoError(t, c.Set(key, []byte(fmt.Sprintf("value%03d", i))))
+	}
+	stats := c.Stats()
+	require.Positive(t, stats.Compactions)
+	require.Equal(t, 10, stats.Keys)
+	// the arena stays near the size of the live data
+	require.Less(t, stats.ArenaBytes, 3*stats.LiveBytes)
+	for i := 90; i < 100; i++ {
+		v, ok := c.Get(fmt.Sprintf("key%d", i%10))
+		require.True(t, ok)
+		require.Equal(t, fmt.Sprintf("value%03d", i), string(v))
+	}
+
+	c.Compact()
+	stats = c.Stats()
+	require.Equal(t, stats.LiveBytes, stats.ArenaBytes)
+	for i := 90; i < 100; i++ {
+		v, ok := c.Get(fmt.Sprintf("key%d", i%10))
+		require.True(t, ok)
+		require.Equal(t, fmt.Sprintf("value%03d", i), string(v))
+	}
+}
+
+func TestBigEntries(t *testing.T) {
+	c := arena.New(arena.Options{ChunkSize: 16})
+	big := make([]byte, 100)
+	for i := range big {
+		big[i] = byte(i)
+	}
+	require.NoError(t, c.Set("big", big))
+	require.NoError(t, c.Set("small", []byte("s")))
+	v, ok := c.Get("big")
+	require.True(t, ok)
+	require.Equal(t, big, v)
+	v, ok = c.Get("small")
+	require.True(t, ok)
+	require.Equal(t, []byte("s"), v)
+}
+
+func TestConcurrent(t *testing.T) {
+	c := arena.New(arena.Options{MaxItems: 100, ChunkSize: 256})
+	done := make(chan struct{})
+	for g := 0; g < 4; g++ {
+		go func(g int) {
+			defer func() { done <- struct{}{} }()
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("%d-%d", g, i%50)
+				_ = c.Set(key, []byte(key))
+				if v, ok := c.Get(key); ok && string(v) != key {
+					t.Errorf("got %q for %q", v, key)
+				}
+			}
+		}(g)
+	}
+	for g := 0; g < 4; g++ {
+		<-done
+	}
+	require.LessOrEqual(t, c.Len(), 100)
+}
+
+func BenchmarkSetGet(b *testing.B) {
+	c := arena.New(arena.Options{MaxItems: 10000})
+	keys := make([]string, 20000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	value := make([]byte, 100)
+	var buf []byte
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := keys[i%len(keys)]
+		_ = c.Set(key, value)
+		buf, _ = c.AppendGet(buf[:0], key)
+	}
+}
@@ -0,0 +1,115 @@
+package lazylru
+
+import "sync/atomic"
+
+// The bubble threshold is a fixed-point fraction of the capacity of the cache.
+// Items closer to the front of the queue than that fraction are moved to the
+// back when they are read.
+const (
+	bubbleScaleBits    = 10
+	bubbleScaleOne     = 1 << bubbleScaleBits
+	defaultBubbleScale = bubbleScaleOne >> 2 // the oldest quarter
+)
+
+// The adaptive threshold responds to these rates, measured over a window of
+// writes and shuffles at least as big as the cache.
+const (
+	adaptMinWindow   = 64
+	adaptChurnRate   = 0.5  // evictions per write before we bubble more
+	adaptCalmRate    = 0.05 // evictions per write before we bubble less
+	adaptShuffleRate = 0.1  // shuffles per read worth bubbling less for
+)
+
+// bubbleState holds the current bubble threshold and, in adaptive mode, the
+// counters at the start of the current measurement window.
+type bubbleState struct {
+	scale     int
+	minScale  int
+	maxScale  int
+	writes    uint32
+	evictions uint32
+	reads     uint32
+	shuffles  uint32
+	adaptive  bool
+}
+
+// SetBubbleFraction sets how far from the front of the queue an item can be
+// and still be moved to the back when it is read. By default, only items in
+// the oldest quarter (0.25) are moved. A fraction of 1 moves every item on
+// every read, which is a true LRU. A fraction of 0 never moves items on read,
+// which is FIFO. This disables the adaptive threshold.
+func (lru *LazyLRU[K, V]) SetBubbleFraction(fraction float64) {
+	lru.lock.Lock()
+	lru.bubbler = bubbleState{scale: fractionToScale(fraction)}
+	lru.lock.Unlock()
+}
+
+// SetAdaptiveBubble lets the cache choose how far from the front of the queue
+// an item can be and still be moved to the back when it is read. When the
+// cache is undersized and most writes cause an eviction, the lazy reordering
+// can push out frequently-read items, so the threshold is raised, up to
+// maxFraction. When there is little churn, shuffles cost locks without doing
+// much good, so the threshold is lowered, down to minFraction. See
+// SetBubbleFraction for the meaning of the fractions.
+func (lru *LazyLRU[K, V]) SetAdaptiveBubble(minFraction, maxFraction float64) {
+	minScale, maxScale := fractionToScale(minFraction), fractionToScale(maxFraction)
+	if minScale > maxScale {
+		minScale, maxScale = maxScale, minScale
+	}
+	lru.lock.Lock()
+	lru.bubbler = bubbleState{
+		scale:    min(max(lru.bubbler.scale, minScale), maxScale),
+		minScale: minScale,
+		maxScale: maxScale,
+		adaptive: true,
+	}
+	lru.bubbler.mark(&lru.stats)
+	lru.lock.Unlock()
+}
+
+// BubbleFraction returns the current bubble threshold as a fraction of the
+// capacity of the cache. See SetBubbleFraction.
+func (lru *LazyLRU[K, V]) BubbleFraction() float64 {
+	lru.lock.RLock()
+	defer lru.lock.RUnlock()
+	return float64(lru.bubbler.scale) / bubbleScaleOne
+}
+
+func fractionToScale(fraction float64) int {
+	return int(min(max(fraction, 0), 1) * bubbleScaleOne)
+}
+
+// mark starts a new measurement window
+func (bs *bubbleState) mark(stats *Stats) {
+	bs.writes = stats.KeysWritten
+	bs.evictions = stats.Evictions
+	bs.shuffles = stats.Shuffles
+	bs.reads = atomic.LoadUint32(&stats.KeysReadOK)
+}
+
+// adapt adjusts the bubble threshold once enough has happened since the last
+// adjustment. This is NOT thread safe and should always be called with a write
+// lock
+func (lru *LazyLRU[K, V]) adapt() {
+	bs := &lru.bubbler
+	if !bs.adaptive {
+		return
+	}
+	writes := lru.stats.KeysWritten - bs.writes
+	shuffles := lru.stats.Shuffles - bs.shuffles
+	if int(writes+shuffles) < max(lru.maxItems, adaptMinWindow) {
+		return
+	}
+	evictions := lru.stats.Evictions - bs.evictions
+	reads := atomic.LoadUint32(&lru.stats.KeysReadOK) - bs.reads
+
+	evictRate := float64(evictions) / float64(max(writes, 1))
+	shuffleRate := float64(shuffles) / float64(max(reads, 1))
+	switch {
+	case evictRate > adaptChurnRate:
+		bs.scale = min(max(bs.scale<<1, 1), bs.maxScale)
+	case evictRate < adaptCalmRate && shuffleRate > adaptShuffleRate:
+		bs.scale = max(bs.scale>>1, bs.minScale)
+	}
+	bs.mark(&lru.stats)
+}
@@ -0,0 +1,65 @@
+package lazylru_test
+
+import (
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBubbleFractionAlways(t *testing.T) {
+	doTest(t, 100, time.Hour, func(t *testing.T, lru *lazylru.LazyLRU[int, int]) {
+		lru.SetBubbleFraction(1)
+		require.Equal(t, 1.0, lru.BubbleFraction())
+		for i := 0; i < 100; i++ {
+			lru.Set(i, i)
+		}
+		// every read shuffles, even of the newest item
+		for i := 0; i < 10; i++ {
+			_, ok := lru.Get(99)
+			require.True(t, ok)
+		}
+	},
+		ExpectedStats{}.WithKeysReadOK(10).WithShuffles(10),
+	)
+}
+
+func TestBubbleFractionNever(t *testing.T) {
+	doTest(t, 100, time.Hour, func(t *testing.T, lru *lazylru.LazyLRU[int, int]) {
+		lru.SetBubbleFraction(-1)
+		require.Equal(t, 0.0, lru.BubbleFraction())
+		for i := 0; i < 100; i++ {
+			lru.Set(i, i)
+		}
+		for i := 0; i < 10; i++ {
+			_, ok := lru.Get(0)
+			require.True(t, ok)
+		}
+		require.Equal(t, 10, len(lru.MGet(0, 1, 2, 3, 4, 5, 6, 7, 8, 9)))
+	},
+		ExpectedStats{}.WithKeysReadOK(20).WithShuffles(0),
+	)
+}
+
+func TestBubbleAdaptive(t *testing.T) {
+	lru := lazylru.NewT[int, int](64, time.Hour)
+	defer lru.Close()
+	lru.SetAdaptiveBubble(1.0/16, 1)
+	require.Equal(t, 0.25, lru.BubbleFraction())
+
+	// an undersized cache that churns should bubble more
+	for i := 0; i < 1000; i++ {
+		lru.Set(i, i)
+	}
+	require.Equal(t, 1.0, lru.BubbleFraction())
+
+	// a cache that doesn't evict, but shuffles a lot, should bubble less
+	for n := 0; n < 20; n++ {
+		for i := 1000 - 64; i < 1000; i++ {
+			_, ok := lru.Get(i)
+			require.True(t, ok)
+		}
+	}
+	require.Equal(t, 1.0/16, lru.BubbleFraction())
+}
@@ -0,0 +1,207 @@
+package lazylru
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	heap "github.com/TriggerMail/lazylru/containers/heap"
+)
+
+// Budget caps the total number of items held by a group of caches, such as the
+// shards of a sharded cache, so that a cache that gets more than its share of
+// the keys can borrow room that the others are not using. Caches in a group
+// share a clock, so the ages of their items can be compared, and when the
+// group is over budget, the item evicted is the oldest at the tail of any of
+// the caches.
+//
+// A budget can also cap the total weight of the values in the group. Only
+// caches that weigh their values, such as the one behind NewCompressedBudgeted,
+// count toward it.
+//
+// The budget is enforced after each write, once the writer has released its
+// cache's lock, so the group can briefly hold one extra item per write in
+// flight.
+type Budget struct {
+	clock     uint64 // insert numbers shared by every cache in the group
+	count     atomic.Int64
+	weight    atomic.Int64
+	maxItems  int64
+	maxWeight int64        // zero for no limit
+	paused    atomic.Int32 // outstanding calls to Pause
+	lock      sync.Mutex   // guards members and lets one writer enforce at a time
+	members   []budgetMember
+}
+
+// budgetMember is the part of a cache that a Budget needs. Caches of any key
+// and value type can share a budget.
+type budgetMember interface {
+	// tail reports the priority and insert number of the next item to be
+	// evicted, or ok=false if there isn't one
+	tail() (priority Priority, insertNumber uint64, ok bool, closed bool)
+	// evictTail evicts the next item, returning false if there wasn't one
+	evictTail() bool
+}
+
+// NewBudget creates a budget for a group of caches that together hold at most
+// maxItems items
+func NewBudget(maxItems int) *Budget {
+	return &Budget{clock: 1, maxItems: int64(max(maxItems, 0))}
+}
+
+// NewWeightedBudget creates a budget for a group of caches that together hold
+// at most maxItems items and at most maxWeight of weight. If maxWeight is zero
+// or fewer, only the items are counted, as with NewBudget.
+func NewWeightedBudget(maxItems int, maxWeight int64) *Budget {
+	b := NewBudget(maxItems)
+	b.maxWeight = max(maxWeight, 0)
+	return b
+}
+
+// Len returns the number of items held by the caches in the group
+func (b *Budget) Len() int {
+	return int(b.count.Load())
+}
+
+// MaxItems returns the number of items the group may hold
+func (b *Budget) MaxItems() int {
+	return int(b.maxItems)
+}
+
+// Weight returns the total weight of the values held by the caches in the
+// group that weigh their values
+func (b *Budget) Weight() int64 {
+	return b.weight.Load()
+}
+
+// MaxWeight returns the weight the group may hold, or zero if there is no limit
+func (b *Budget) MaxWeight() int64 {
+	return b.maxWeight
+}
+
+// Pause stops the budget from evicting anything until Resume is called, so
+// that an item can be copied from one cache in the group to another before it
+// is deleted from the first without pushing out some other item. Calls to
+// Pause and Resume may be nested.
+func (b *Budget) Pause() {
+	b.paused.Add(1)
+}
+
+// Resume undoes a call to Pause. Once every Pause has been undone, the budget
+// evicts whatever it needs to in order to be within its limits again.
+func (b *Budget) Resume() {
+	if b.paused.Add(-1) == 0 {
+		b.enforce()
+	}
+}
+
+// over reports whether the group holds more than it may and is not paused
+func (b *Budget) over() bool {
+	if b.paused.Load() > 0 {
+		return false
+	}
+	return b.count.Load() > b.maxItems || (b.maxWeight > 0 && b.weight.Load() > b.maxWeight)
+}
+
+// NewBudgeted creates a cache that draws on the given budget. The cache on its
+// own may hold as many items as the whole budget. It stops counting against
+// the budget once it is released by CloseContext.
+func NewBudgeted[K comparable, V any](b *Budget, ttl time.Duration) *LazyLRU[K, V] {
+	lru := newLazyLRU[K, V](int(b.maxItems), ttl)
+	lru.budget = b
+	lru.clock = &b.clock
+	b.lock.Lock()
+	b.members = append(b.members, lru)
+	b.lock.Unlock()
+	lru.startReaper()
+	return lru
+}
+
+// enforce evicts the oldest items in the group until it is within budget. If
+// another writer is already enforcing, it is left to do the work: it checks
+// the count again once it lets go of the lock, so no write is missed. This
+// also keeps the evictions enforce causes from enforcing in turn.
+func (b *Budget) enforce() {
+	for b.over() {
+		if !b.lock.TryLock() {
+			return
+		}
+		stuck := false
+		for !stuck && b.over() {
+			stuck = !b.evictOldest()
+		}
+		b.lock.Unlock()
+		if stuck {
+			// nothing can be evicted, as when every item is pinned
+			return
+		}
+	}
+}
+
+// evictOldest evicts the tail of whichever cache has the oldest one, dropping
+// caches that have been closed. This should always be called with the lock.
+func (b *Budget) evictOldest() bool {
+	var victim budgetMember
+	var victimPriority Priority
+	var victimInsert uint64
+	live := b.members[:0]
+	for _, m := range b.members {
+		priority, insertNumber, ok, closed := m.tail()
+		if closed {
+			continue
+		}
+		live = append(live, m)
+		if !ok {
+			continue
+		}
+		// this is the same order the queues use, without LFU frequencies
+		if victim == nil || priority < victimPriority || (priority == victimPriority && insertNumber < victimInsert) {
+			victim, victimPriority, victimInsert = m, priority, insertNumber
+		}
+	}
+	clear(b.members[len(live):])
+	b.members = live
+	return victim != nil && victim.evictTail()
+}
+
+// countBudget adds to the number of items counted against the cache's budget,
+// if it has one. This should always be called with a write lock.
+func (lru *LazyLRU[K, V]) countBudget(n int) {
+	if lru.budget != nil {
+		lru.budget.count.Add(int64(n))
+	}
+}
+
+// tail reports the next item to be evicted. See budgetMember.
+func (lru *LazyLRU[K, V]) tail() (Priority, uint64, bool, bool) {
+	lru.lock.RLock()
+	defer lru.lock.RUnlock()
+	if lru.isClosed {
+		return PriorityNormal, 0, false, true
+	}
+	if lru.items.Len() == 0 {
+		return PriorityNormal, 0, false, false
+	}
+	return lru.items[0].priority, lru.items[0].insertNumber, true, false
+}
+
+// evictTail evicts the next item to be evicted. See budgetMember.
+func (lru *LazyLRU[K, V]) evictTail() bool {
+	lru.lock.Lock()
+	if lru.isClosed || lru.items.Len() == 0 {
+		lru.lock.Unlock()
+		return false
+	}
+	deadGuy := heap.Pop(&lru.items)
+	if lru.index[deadGuy.key] == deadGuy {
+		lru.unindex(deadGuy.key)
+	}
+	lru.classLen[deadGuy.priority]--
+	lru.stats.Evictions++
+	lru.stats.EvictionsByPriority[deadGuy.priority]++
+	deathList := append(lru.newDeathList(), deadGuy)
+	lru.lock.Unlock()
+	lru.afterEvict(context.Background(), deathList)
+	return true
+}
@@ -0,0 +1,142 @@
+package lazylru_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudgetEvictsOldestTail(t *testing.T) {
+	budget := lazylru.NewBudget(4)
+	a := lazylru.NewBudgeted[string, int](budget, time.Hour)
+	defer a.Close()
+	b := lazylru.NewBudgeted[string, int](budget, time.Hour)
+	defer b.Close()
+
+	a.Set("a1", 1)
+	a.Set("a2", 2)
+	b.Set("b1", 1)
+	a.Set("a3", 3)
+	require.Equal(t, 4, budget.Len())
+
+	// b borrows room, and the oldest item in either cache makes way
+	b.Set("b2", 2)
+	require.Equal(t, 4, budget.Len())
+	_, ok := a.Get("a1")
+	require.False(t, ok)
+	require.Equal(t, 2, a.Len())
+	require.Equal(t, 2, b.Len())
+	require.Equal(t, uint32(1), a.Stats().Evictions)
+
+	// lower priorities go first, no matter how new they are
+	b.SetTTLPriority("b3", 3, time.Hour, lazylru.PriorityLow)
+	b.Set("b4", 4)
+	_, ok = b.Get("b3")
+	require.False(t, ok)
+	require.Equal(t, 4, budget.Len())
+
+	b.Delete("b4")
+	require.Equal(t, 3, budget.Len())
+}
+
+func TestBudgetPinned(t *testing.T) {
+	budget := lazylru.NewBudget(2)
+	lru := lazylru.NewBudgeted[string, int](budget, time.Hour)
+	defer lru.Close()
+	require.NoError(t, lru.SetPinned("a", 1))
+	lru.Set("b", 2)
+	// nothing else can go, so the pinned item has to stay
+	lru.Set("c", 3)
+	require.Equal(t, 2, budget.Len())
+	_, ok := lru.Get("a")
+	require.True(t, ok)
+}
+
+func TestBudgetRelease(t *testing.T) {
+	budget := lazylru.NewBudget(10)
+	a := lazylru.NewBudgeted[string, int](budget, time.Hour)
+	b := lazylru.NewBudgeted[string, int](budget, time.Hour)
+	defer b.Close()
+	for i := 0; i < 5; i++ {
+		a.Set(strconv.Itoa(i), i)
+	}
+	b.Set("x", 1)
+	require.Equal(t, 6, budget.Len())
+	require.NoError(t, a.CloseContext(context.Background()))
+	require.Equal(t, 1, budget.Len())
+	for i := 0; i < 20; i++ {
+		b.Set(strconv.Itoa(i), i)
+	}
+	require.Equal(t, 10, b.Len())
+	require.Equal(t, 10, budget.Len())
+}
+
+func TestBudgetConcurrent(t *testing.T) {
+	budget := lazylru.NewBudget(100)
+	caches := make([]*lazylru.LazyLRU[int, int], 4)
+	for i := range caches {
+		caches[i] = lazylru.NewBudgeted[int, int](budget, time.Hour)
+		defer caches[i].Close()
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				lru := caches[(g+i)%len(caches)]
+				lru.Set(g*10000+i, i)
+				if i%10 == 0 {
+					lru.Delete(g*10000 + i - 5)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	total := 0
+	for _, lru := range caches {
+		total += lru.Len()
+	}
+	require.Equal(t, total, budget.Len())
+	require.LessOrEqual(t, total, budget.MaxItems())
+}
+
+func TestBudgetWeight(t *testing.T) {
+	// each value is stored with a one byte header, so it weighs 10
+	budget := lazylru.NewWeightedBudget(100, 40)
+	a := lazylru.NewCompressedBudgeted[string](budget, time.Hour, shrinkNothing{}, 1<<20)
+	defer a.Close()
+	b := lazylru.NewCompressedBudgeted[string](budget, time.Hour, shrinkNothing{}, 1<<20)
+	defer b.Close()
+	// caches without a weigher count items but no weight
+	c := lazylru.NewBudgeted[string, int](budget, time.Hour)
+	defer c.Close()
+	value := []byte("123456789")
+
+	require.NoError(t, a.Set("a1", value))
+	require.NoError(t, a.Set("a2", value))
+	require.NoError(t, b.Set("b1", value))
+	c.Set("c1", 1)
+	require.NoError(t, a.Set("a3", value))
+	require.Equal(t, int64(40), budget.Weight())
+	require.Equal(t, 5, budget.Len())
+
+	// the oldest item goes to make room for the weight, even though there
+	// is room for more items
+	require.NoError(t, b.Set("b2", value))
+	require.Equal(t, int64(40), budget.Weight())
+	_, ok, err := a.Get("a1")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	b.Delete("b2")
+	a.Delete("a2")
+	require.Equal(t, int64(20), budget.Weight())
+	require.Equal(t, 3, budget.Len())
+	require.Equal(t, int64(40), budget.MaxWeight())
+}
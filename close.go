@@ -0,0 +1,105 @@
+package lazylru
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrClosed is returned by the error-returning methods of a cache that has
+// been closed with CloseContext.
+var ErrClosed = errors.New("cache is closed")
+
+// SetEvictOnClose decides whether CloseContext fires the eviction callbacks
+// for all of the items remaining in the cache. By default, it does not.
+func (lru *LazyLRU[K, V]) SetEvictOnClose(evict bool) {
+	lru.lock.Lock()
+	lru.evictClose = evict
+	lru.lock.Unlock()
+}
+
+// CloseContext stops the reaper and waits for it to exit, then releases the
+// items in the cache. If SetEvictOnClose is in effect, the eviction callbacks
+// are fired for every item that was still in the cache. In write-behind mode,
+// any queued writes are flushed to the store. Any queued eviction callbacks are
+// then allowed to finish. If the context ends before all of that is done, the
+// context's error is returned; calling CloseContext again picks up where the
+// last one left off.
+//
+// After CloseContext, the cache holds nothing. Get and MGet find nothing, Set
+// does nothing, and the error-returning variants, like GetCtx, SetCtx, and
+// MSetTTL, return ErrClosed.
+func (lru *LazyLRU[K, V]) CloseContext(ctx context.Context) error {
+	lru.lock.Lock()
+	if !lru.isClosing {
+		close(lru.doneCh)
+		lru.isClosing = true
+	}
+	lru.lock.Unlock()
+
+	select {
+	case <-lru.reaperDone:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	lru.lock.Lock()
+	var deathList []*item[K, V]
+	if !lru.isClosed && lru.evictClose {
+		deathList = make([]*item[K, V], 0, len(lru.index))
+		for _, pqi := range lru.index {
+			deathList = append(deathList, pqi)
+		}
+	}
+	lru.release()
+	dispatcher := lru.dispatcher
+	lru.lock.Unlock()
+
+	// the items are gone once released, so a retry could not find them again;
+	// their callbacks are fired before anything that can give up on ctx
+	if len(deathList) > 0 && lru.numEvictCB.Load() > 0 {
+		lru.execOnEvict(deathList)
+	}
+
+	if b := lru.backing.Swap(nil); b != nil {
+		if err := lru.stopBacking(ctx, b); err != nil {
+			lru.backing.CompareAndSwap(nil, b) // try again next time
+			return err
+		}
+	}
+	if dispatcher == nil {
+		return nil
+	}
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		dispatcher.flush()
+	}()
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release drops all of the items so that their memory can be reclaimed and
+// marks the cache as closed. This is NOT thread safe and should always be
+// called with a write lock
+func (lru *LazyLRU[K, V]) release() {
+	lru.isClosed = true
+	lru.readPath.Store(nil)
+	lru.countBudget(-len(lru.index))
+	lru.countBudgetWeight(-lru.weight)
+	lru.weight = 0
+	lru.index = nil
+	lru.pinned = nil
+	lru.items = nil
+	lru.promotions = nil
+	lru.freeLock.Lock()
+	lru.free = nil
+	lru.freeLists = nil
+	lru.freeLock.Unlock()
+	lru.classLen = [PriorityHigh + 1]int{}
+	lru.maxItems = 0
+	lru.maxPinned = 0
+}
@@ -0,0 +1,118 @@
+package lazylru_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloseContext(t *testing.T) {
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	require.True(t, lru.IsRunning())
+	lru.Set("a", 1)
+	require.NoError(t, lru.SetPinned("b", 2))
+	var evicted []string
+	lru.OnEvict(func(k string, _ int) { evicted = append(evicted, k) })
+
+	require.NoError(t, lru.CloseContext(context.Background()))
+	require.False(t, lru.IsRunning(), "the reaper should be stopped before CloseContext returns")
+	require.Empty(t, evicted)
+	require.Equal(t, 0, lru.Len())
+	require.Equal(t, 0, lru.PinnedLen())
+
+	// plain operations quietly do nothing
+	lru.Set("c", 3)
+	_, ok := lru.Get("a")
+	require.False(t, ok)
+	require.Empty(t, lru.MGet("a", "b", "c"))
+	lru.Delete("a")
+	lru.Reap()
+	require.Equal(t, 0, lru.Len())
+
+	// the error-returning variants say why
+	ctx := context.Background()
+	_, _, err := lru.GetCtx(ctx, "a")
+	require.ErrorIs(t, err, lazylru.ErrClosed)
+	_, err = lru.MGetCtx(ctx, "a")
+	require.ErrorIs(t, err, lazylru.ErrClosed)
+	require.ErrorIs(t, lru.SetCtx(ctx, "a", 1), lazylru.ErrClosed)
+	require.ErrorIs(t, lru.MSet([]string{"a"}, []int{1}), lazylru.ErrClosed)
+	require.ErrorIs(t, lru.SetPinned("a", 1), lazylru.ErrClosed)
+
+	// closing again is safe
+	lru.Close()
+	require.NoError(t, lru.CloseContext(ctx))
+}
+
+func TestCloseContextNoReaper(t *testing.T) {
+	lru := lazylru.NewT[string, int](10, 0)
+	lru.Set("a", 1)
+	require.NoError(t, lru.CloseContext(context.Background()))
+	require.Equal(t, 0, lru.Len())
+}
+
+func TestCloseContextEvictOnClose(t *testing.T) {
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	var mu sync.Mutex
+	evicted := map[string]int{}
+	lru.OnEvict(func(k string, v int) {
+		mu.Lock()
+		evicted[k] = v
+		mu.Unlock()
+	})
+	lru.UseAsyncEvict(10, 2, lazylru.EvictBlock)
+	lru.SetEvictOnClose(true)
+	lru.Set("a", 1)
+	lru.Set("b", 2)
+	require.NoError(t, lru.SetPinned("c", 3))
+
+	require.NoError(t, lru.CloseContext(context.Background()))
+	// the async callbacks must be done by the time CloseContext returns
+	require.Equal(t, map[string]int{"a": 1, "b": 2, "c": 3}, evicted)
+}
+
+func TestCloseContextDeadline(t *testing.T) {
+	lru := lazylru.NewT[string, int](1, time.Hour)
+	release := make(chan struct{})
+	lru.OnEvict(func(string, int) { <-release })
+	lru.UseAsyncEvict(10, 1, lazylru.EvictBlock)
+	lru.Set("a", 1)
+	lru.Set("b", 2) // the callback for "a" is stuck
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, lru.CloseContext(ctx), context.DeadlineExceeded)
+	require.Equal(t, 0, lru.Len(), "the items are released even if the callbacks are slow")
+
+	close(release)
+	require.NoError(t, lru.CloseContext(context.Background()))
+}
+
+func TestCloseContextDeadlineEvictOnClose(t *testing.T) {
+	store := newMapStore()
+	gate := store.gate(nil)
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	var evicted []string
+	lru.OnEvict(func(k string, _ int) { evicted = append(evicted, k) })
+	lru.SetEvictOnClose(true)
+	lru.UseWriteBehind(store, time.Hour, 100)
+	lru.Set("a", 1)
+
+	// the flush is stuck, but the callbacks must not wait for it, because the
+	// items are gone and a retry could not fire them
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, lru.CloseContext(ctx), context.DeadlineExceeded)
+	require.Equal(t, []string{"a"}, evicted)
+
+	close(gate)
+	require.NoError(t, lru.CloseContext(context.Background()))
+	require.Equal(t, []string{"a"}, evicted)
+	v, ok := store.get("a")
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+}
@@ -0,0 +1,174 @@
+package lazylru
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"time"
+)
+
+// Codec turns values into bytes and back again, for features that hold values
+// outside of memory or in a more compact form
+type Codec[V any] interface {
+	// Encode turns a value into bytes
+	Encode(value V) ([]byte, error)
+	// Decode turns bytes made by Encode back into a value
+	Decode(data []byte) (V, error)
+}
+
+// GobCodec encodes values with encoding/gob. It works for most types without
+// any extra code, but each encoding carries a description of the type, so it
+// is not the most compact for small values.
+type GobCodec[V any] struct{}
+
+// Encode turns a value into bytes
+func (GobCodec[V]) Encode(value V) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode turns bytes made by Encode back into a value
+func (GobCodec[V]) Decode(data []byte) (V, error) {
+	var value V
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	return value, err
+}
+
+// JSONCodec encodes values with encoding/json. Only exported fields are kept.
+type JSONCodec[V any] struct{}
+
+// Encode turns a value into bytes
+func (JSONCodec[V]) Encode(value V) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+// Decode turns bytes made by Encode back into a value
+func (JSONCodec[V]) Decode(data []byte) (V, error) {
+	var value V
+	err := json.Unmarshal(data, &value)
+	return value, err
+}
+
+// BinaryCodec encodes values with their own MarshalBinary and UnmarshalBinary
+// methods. PV is the pointer type, which is what usually has UnmarshalBinary,
+// so a codec for time.Time is BinaryCodec[time.Time, *time.Time].
+type BinaryCodec[V any, PV interface {
+	*V
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}] struct{}
+
+// Encode turns a value into bytes
+func (BinaryCodec[V, PV]) Encode(value V) ([]byte, error) {
+	return PV(&value).MarshalBinary()
+}
+
+// Decode turns bytes made by Encode back into a value
+func (BinaryCodec[V, PV]) Decode(data []byte) (V, error) {
+	var value V
+	err := PV(&value).UnmarshalBinary(data)
+	return value, err
+}
+
+// BytesCodec passes byte slices through untouched. The slices are not copied,
+// so they should not be changed after they are handed over.
+type BytesCodec struct{}
+
+// Encode returns the value as-is
+func (BytesCodec) Encode(value []byte) ([]byte, error) {
+	return value, nil
+}
+
+// Decode returns the data as-is
+func (BytesCodec) Decode(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// Encoded is a cache that holds its values encoded by a Codec and decodes them
+// on every read. Large structs are often smaller encoded, especially with
+// pointers and padding removed, so more of them fit in the same memory, at the
+// cost of encoding and decoding. Each read decodes a new copy, so changing a
+// value that was read does not change what is cached.
+type Encoded[K comparable, V any] struct {
+	lru   *LazyLRU[K, []byte]
+	codec Codec[V]
+}
+
+// NewEncoded creates a cache that holds up to maxItems values encoded with the
+// given codec, expiring them after ttl
+func NewEncoded[K comparable, V any](maxItems int, ttl time.Duration, codec Codec[V]) *Encoded[K, V] {
+	return &Encoded[K, V]{lru: NewT[K, []byte](maxItems, ttl), codec: codec}
+}
+
+// Get retrieves and decodes a value from the cache. The returned bool
+// indicates whether the key was found. A value that cannot be decoded is
+// returned as an error.
+func (e *Encoded[K, V]) Get(key K) (V, bool, error) {
+	data, ok := e.lru.Get(key)
+	if !ok {
+		var zero V
+		return zero, false, nil
+	}
+	value, err := e.codec.Decode(data)
+	if err != nil {
+		return value, false, err
+	}
+	return value, true, nil
+}
+
+// MGet retrieves and decodes multiple values from the cache, stopping at the
+// first value that cannot be decoded. Keys that are not found are not in the
+// returned map.
+func (e *Encoded[K, V]) MGet(keys ...K) (map[K]V, error) {
+	found := e.lru.MGet(keys...)
+	retval := make(map[K]V, len(found))
+	for key, data := range found {
+		value, err := e.codec.Decode(data)
+		if err != nil {
+			return nil, err
+		}
+		retval[key] = value
+	}
+	return retval, nil
+}
+
+// Set encodes a value and writes it to the cache. If the value cannot be
+// encoded, the cache is not changed.
+func (e *Encoded[K, V]) Set(key K, value V) error {
+	return e.SetTTL(key, value, e.lru.ttl)
+}
+
+// SetTTL encodes a value and writes it to the cache, expiring with the given
+// time-to-live value
+func (e *Encoded[K, V]) SetTTL(key K, value V, ttl time.Duration) error {
+	data, err := e.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	e.lru.SetTTL(key, data, ttl)
+	return nil
+}
+
+// Delete removes a key from the cache
+func (e *Encoded[K, V]) Delete(key K) {
+	e.lru.Delete(key)
+}
+
+// Len returns the number of items in the cache
+func (e *Encoded[K, V]) Len() int {
+	return e.lru.Len()
+}
+
+// Close stops the reaper process. This is safe to call multiple times.
+func (e *Encoded[K, V]) Close() {
+	e.lru.Close()
+}
+
+// Stats gets a copy of the stats held by the cache
+func (e *Encoded[K, V]) Stats() Stats {
+	return e.lru.Stats()
+}
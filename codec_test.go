@@ -0,0 +1,77 @@
+package lazylru_test
+
+import (
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+type codecStruct struct {
+	Name  string
+	Tags  []string
+	Count int
+}
+
+func testCodec[V any](t *testing.T, codec lazylru.Codec[V], value V) {
+	data, err := codec.Encode(value)
+	require.NoError(t, err)
+	decoded, err := codec.Decode(data)
+	require.NoError(t, err)
+	require.Equal(t, value, decoded)
+}
+
+func TestCodecs(t *testing.T) {
+	value := codecStruct{Name: "thing", Tags: []string{"a", "b"}, Count: 3}
+	t.Run("gob", func(t *testing.T) { testCodec[codecStruct](t, lazylru.GobCodec[codecStruct]{}, value) })
+	t.Run("json", func(t *testing.T) { testCodec[codecStruct](t, lazylru.JSONCodec[codecStruct]{}, value) })
+	t.Run("binary", func(t *testing.T) {
+		testCodec[time.Time](t, lazylru.BinaryCodec[time.Time, *time.Time]{}, time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC))
+	})
+	t.Run("bytes", func(t *testing.T) { testCodec[[]byte](t, lazylru.BytesCodec{}, []byte("raw")) })
+}
+
+func TestCodecDecodeError(t *testing.T) {
+	_, err := lazylru.JSONCodec[codecStruct]{}.Decode([]byte("{"))
+	require.Error(t, err)
+	_, err = lazylru.GobCodec[codecStruct]{}.Decode([]byte("nope"))
+	require.Error(t, err)
+}
+
+func TestEncoded(t *testing.T) {
+	e := lazylru.NewEncoded[string, codecStruct](3, time.Hour, lazylru.GobCodec[codecStruct]{})
+	defer e.Close()
+
+	require.NoError(t, e.Set("a", codecStruct{Name: "a", Count: 1}))
+	require.NoError(t, e.SetTTL("b", codecStruct{Name: "b", Count: 2}, time.Minute))
+	v, ok, err := e.Get("a")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, codecStruct{Name: "a", Count: 1}, v)
+
+	// reads are copies, so changing one doesn't change the cache
+	v.Count = 100
+	v, _, _ = e.Get("a")
+	require.Equal(t, 1, v.Count)
+
+	require.NoError(t, e.Set("c", codecStruct{Name: "c", Count: 3}))
+	found, err := e.MGet("a", "c", "d")
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	require.Equal(t, "c", found["c"].Name)
+
+	e.Delete("a")
+	_, ok, err = e.Get("a")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, 2, e.Len())
+	require.Equal(t, uint32(3), e.Stats().KeysWritten)
+}
+
+func TestEncodedEncodeError(t *testing.T) {
+	e := lazylru.NewEncoded[string, func()](2, time.Hour, lazylru.GobCodec[func()]{})
+	defer e.Close()
+	require.Error(t, e.Set("a", func() {}))
+	require.Equal(t, 0, e.Len())
+}
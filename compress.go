@@ -0,0 +1,299 @@
+package lazylru
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Compressor compresses and decompresses byte slices for a Compressed cache
+type Compressor interface {
+	// Compress returns a compressed copy of data
+	Compress(data []byte) ([]byte, error)
+	// Decompress returns what was given to Compress
+	Decompress(data []byte) ([]byte, error)
+}
+
+// FlateCompressor compresses with DEFLATE from compress/flate. The zero value
+// uses flate.DefaultCompression.
+type FlateCompressor struct {
+	Level int
+}
+
+// Compress returns a compressed copy of data
+func (fc FlateCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := flate.NewWriter(&buf, levelOrDefault(fc.Level))
+	if err != nil {
+		return nil, err
+	}
+	return finishCompress(&buf, zw, data)
+}
+
+// Decompress returns what was given to Compress
+func (FlateCompressor) Decompress(data []byte) ([]byte, error) {
+	zr := flate.NewReader(bytes.NewReader(data))
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// GzipCompressor compresses with gzip from compress/gzip, which is DEFLATE
+// with a header and a checksum. The zero value uses gzip.DefaultCompression.
+type GzipCompressor struct {
+	Level int
+}
+
+// Compress returns a compressed copy of data
+func (gc GzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, levelOrDefault(gc.Level))
+	if err != nil {
+		return nil, err
+	}
+	return finishCompress(&buf, zw, data)
+}
+
+// Decompress returns what was given to Compress
+func (GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// levelOrDefault maps the zero value to the default level, since zero is
+// "no compression" to flate and gzip
+func levelOrDefault(level int) int {
+	if level == 0 {
+		return flate.DefaultCompression
+	}
+	return level
+}
+
+func finishCompress(buf *bytes.Buffer, zw io.WriteCloser, data []byte) ([]byte, error) {
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Each stored value starts with a byte that says whether the rest of it is
+// compressed
+const (
+	compressRaw byte = iota
+	compressPacked
+)
+
+var errCompressHeader = errors.New("compressed value has an unknown header")
+
+// CompressedStats represents counts of actions against a compressed cache
+type CompressedStats struct {
+	Cache          Stats         // the stats of the LazyLRU that holds the bytes
+	Compressed     uint64        // values that were stored compressed
+	Uncompressed   uint64        // values stored as-is because they were small or didn't shrink
+	BytesIn        uint64        // bytes of values written, before compression
+	BytesStored    uint64        // bytes of values written, after compression
+	BytesSaved     uint64        // BytesIn less BytesStored
+	BytesHeld      uint64        // bytes of the values in the cache now, as stored
+	CompressTime   time.Duration // time spent compressing
+	DecompressTime time.Duration // time spent decompressing
+	Errors         uint64        // values that could not be compressed or decompressed
+}
+
+// Compressed is a cache of byte slices that compresses values at or above a
+// size threshold. It suits values like rendered JSON or HTML, which often
+// shrink several times over. Values that are below the threshold, or that do
+// not get smaller, are stored as-is, with one extra byte of overhead.
+//
+// Capacity is counted in items, and SetMaxBytes adds a limit on the bytes the
+// values take up once they are compressed.
+type Compressed[K comparable] struct {
+	lru        *LazyLRU[K, []byte]
+	compressor Compressor
+	threshold  int
+	stats      CompressedStats
+}
+
+// NewCompressed creates a cache that holds up to maxItems values, expiring
+// them after ttl. Values of at least threshold bytes are compressed with the
+// given compressor.
+func NewCompressed[K comparable](maxItems int, ttl time.Duration, compressor Compressor, threshold int) *Compressed[K] {
+	c := &Compressed[K]{
+		lru:        NewT[K, []byte](maxItems, ttl),
+		compressor: compressor,
+		threshold:  threshold,
+	}
+	c.lru.setWeigher(storedSize, 0)
+	return c
+}
+
+// NewCompressedBudgeted creates a compressed cache that draws on the given
+// budget, like NewBudgeted. Each value counts against the budget's weight
+// limit, if it has one, for its size as stored.
+func NewCompressedBudgeted[K comparable](b *Budget, ttl time.Duration, compressor Compressor, threshold int) *Compressed[K] {
+	c := &Compressed[K]{
+		lru:        NewBudgeted[K, []byte](b, ttl),
+		compressor: compressor,
+		threshold:  threshold,
+	}
+	c.lru.setWeigher(storedSize, 0)
+	return c
+}
+
+// SetMaxBytes limits the total size of the values in the cache, as stored, so
+// that a value counts for its compressed size plus its one-byte header. Items
+// are evicted in the usual order until the cache is within both this and the
+// item limit, and a value bigger than the whole limit is not kept. Zero or
+// fewer removes the limit, which is the default.
+func (c *Compressed[K]) SetMaxBytes(maxBytes int64) {
+	c.lru.setWeigher(storedSize, maxBytes)
+}
+
+func storedSize(stored []byte) int64 {
+	return int64(len(stored))
+}
+
+// Get retrieves a value from the cache, decompressing it if needed. The
+// returned bool indicates whether the key was found. A value that cannot be
+// decompressed is returned as an error.
+func (c *Compressed[K]) Get(key K) ([]byte, bool, error) {
+	stored, ok := c.lru.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	value, err := c.unpack(stored)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// MGet retrieves multiple values from the cache, stopping at the first value
+// that cannot be decompressed. Keys that are not found are not in the returned
+// map.
+func (c *Compressed[K]) MGet(keys ...K) (map[K][]byte, error) {
+	found := c.lru.MGet(keys...)
+	for key, stored := range found {
+		value, err := c.unpack(stored)
+		if err != nil {
+			return nil, err
+		}
+		found[key] = value
+	}
+	return found, nil
+}
+
+// Set writes a value to the cache, compressing it if it is big enough. If the
+// value cannot be compressed, the cache is not changed.
+func (c *Compressed[K]) Set(key K, value []byte) error {
+	return c.SetTTL(key, value, c.lru.ttl)
+}
+
+// SetTTL writes a value to the cache, expiring with the given time-to-live
+// value
+func (c *Compressed[K]) SetTTL(key K, value []byte, ttl time.Duration) error {
+	stored, err := c.pack(value)
+	if err != nil {
+		return err
+	}
+	c.lru.SetTTL(key, stored, ttl)
+	return nil
+}
+
+// pack adds the header and compresses the value if it is worth it
+func (c *Compressed[K]) pack(value []byte) ([]byte, error) {
+	atomic.AddUint64(&c.stats.BytesIn, uint64(len(value)))
+	if len(value) >= c.threshold {
+		start := time.Now()
+		packed, err := c.compressor.Compress(value)
+		atomic.AddInt64((*int64)(&c.stats.CompressTime), int64(time.Since(start)))
+		if err != nil {
+			atomic.AddUint64(&c.stats.Errors, 1)
+			return nil, err
+		}
+		if len(packed) < len(value) {
+			stored := make([]byte, 1+len(packed))
+			stored[0] = compressPacked
+			copy(stored[1:], packed)
+			atomic.AddUint64(&c.stats.Compressed, 1)
+			atomic.AddUint64(&c.stats.BytesStored, uint64(len(stored)))
+			return stored, nil
+		}
+	}
+	stored := make([]byte, 1+len(value))
+	stored[0] = compressRaw
+	copy(stored[1:], value)
+	atomic.AddUint64(&c.stats.Uncompressed, 1)
+	atomic.AddUint64(&c.stats.BytesStored, uint64(len(stored)))
+	return stored, nil
+}
+
+// unpack removes the header and decompresses the value if needed
+func (c *Compressed[K]) unpack(stored []byte) ([]byte, error) {
+	if len(stored) == 0 {
+		atomic.AddUint64(&c.stats.Errors, 1)
+		return nil, errCompressHeader
+	}
+	switch stored[0] {
+	case compressRaw:
+		// copy so that changing what we return doesn't change the cache
+		return append([]byte(nil), stored[1:]...), nil
+	case compressPacked:
+		start := time.Now()
+		value, err := c.compressor.Decompress(stored[1:])
+		atomic.AddInt64((*int64)(&c.stats.DecompressTime), int64(time.Since(start)))
+		if err != nil {
+			atomic.AddUint64(&c.stats.Errors, 1)
+			return nil, err
+		}
+		return value, nil
+	}
+	atomic.AddUint64(&c.stats.Errors, 1)
+	return nil, errCompressHeader
+}
+
+// Delete removes a key from the cache
+func (c *Compressed[K]) Delete(key K) {
+	c.lru.Delete(key)
+}
+
+// Len returns the number of items in the cache
+func (c *Compressed[K]) Len() int {
+	return c.lru.Len()
+}
+
+// Close stops the reaper process. This is safe to call multiple times.
+func (c *Compressed[K]) Close() {
+	c.lru.Close()
+}
+
+// Stats gets a copy of the stats held by the cache. Note that this is a copy,
+// so returned objects will not update as the service continues to execute.
+func (c *Compressed[K]) Stats() CompressedStats {
+	bytesIn, bytesStored := atomic.LoadUint64(&c.stats.BytesIn), atomic.LoadUint64(&c.stats.BytesStored)
+	var saved uint64
+	if bytesIn > bytesStored {
+		saved = bytesIn - bytesStored
+	}
+	return CompressedStats{
+		Cache:          c.lru.Stats(),
+		Compressed:     atomic.LoadUint64(&c.stats.Compressed),
+		Uncompressed:   atomic.LoadUint64(&c.stats.Uncompressed),
+		BytesIn:        bytesIn,
+		BytesStored:    bytesStored,
+		BytesSaved:     saved,
+		BytesHeld:      uint64(c.lru.heldWeight()),
+		CompressTime:   time.Duration(atomic.LoadInt64((*int64)(&c.stats.CompressTime))),
+		DecompressTime: time.Duration(atomic.LoadInt64((*int64)(&c.stats.DecompressTime))),
+		Errors:         atomic.LoadUint64(&c.stats.Errors),
+	}
+}
@@ -0,0 +1,147 @@
+package lazylru_test
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+func testCompressed(t *testing.T, compressor lazylru.Compressor) {
+	c := lazylru.NewCompressed[string](10, time.Hour, compressor, 64)
+	defer c.Close()
+
+	big := bytes.Repeat([]byte(`{"name":"thing","tags":["a","b"]},`), 100)
+	small := []byte(`{"name":"thing"}`)
+	require.NoError(t, c.Set("big", big))
+	require.NoError(t, c.SetTTL("small", small, time.Minute))
+
+	v, ok, err := c.Get("big")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, big, v)
+	v, ok, err = c.Get("small")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, small, v)
+
+	// reads are copies
+	v[0] = 'X'
+	v, _, _ = c.Get("small")
+	require.Equal(t, small, v)
+
+	found, err := c.MGet("big", "small", "missing")
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	require.Equal(t, big, found["big"])
+
+	c.Delete("big")
+	_, ok, err = c.Get("big")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, 1, c.Len())
+
+	stats := c.Stats()
+	require.Equal(t, uint64(1), stats.Compressed)
+	require.Equal(t, uint64(1), stats.Uncompressed)
+	require.Equal(t, uint64(len(big)+len(small)), stats.BytesIn)
+	require.Equal(t, stats.BytesIn-stats.BytesStored, stats.BytesSaved)
+	require.Greater(t, stats.BytesSaved, uint64(len(big)/2))
+	require.Positive(t, stats.CompressTime)
+	require.Positive(t, stats.DecompressTime)
+	require.Equal(t, uint32(2), stats.Cache.KeysWritten)
+}
+
+func TestCompressedFlate(t *testing.T) {
+	testCompressed(t, lazylru.FlateCompressor{})
+}
+
+func TestCompressedGzip(t *testing.T) {
+	testCompressed(t, lazylru.GzipCompressor{Level: 9})
+}
+
+// shrinkNothing is a compressor that never makes anything smaller
+type shrinkNothing struct{}
+
+func (shrinkNothing) Compress(data []byte) ([]byte, error) {
+	return append([]byte("xx"), data...), nil
+}
+
+func (shrinkNothing) Decompress(data []byte) ([]byte, error) {
+	return nil, errors.New("should not be called")
+}
+
+func TestCompressedIncompressible(t *testing.T) {
+	c := lazylru.NewCompressed[string](10, time.Hour, shrinkNothing{}, 0)
+	defer c.Close()
+	require.NoError(t, c.Set("a", []byte("hello")))
+	v, ok, err := c.Get("a")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, []byte("hello"), v)
+	stats := c.Stats()
+	require.Equal(t, uint64(0), stats.Compressed)
+	require.Equal(t, uint64(1), stats.Uncompressed)
+	require.Equal(t, uint64(0), stats.BytesSaved)
+}
+
+// failCompressor fails to compress
+type failCompressor struct{}
+
+func (failCompressor) Compress([]byte) ([]byte, error)   { return nil, errors.New("nope") }
+func (failCompressor) Decompress([]byte) ([]byte, error) { return nil, errors.New("nope") }
+
+func TestCompressedError(t *testing.T) {
+	c := lazylru.NewCompressed[string](10, time.Hour, failCompressor{}, 1)
+	defer c.Close()
+	require.Error(t, c.Set("a", []byte("hello")))
+	require.Equal(t, 0, c.Len())
+	require.Equal(t, uint64(1), c.Stats().Errors)
+}
+
+func TestCompressedMaxBytes(t *testing.T) {
+	c := lazylru.NewCompressed[string](100, time.Hour, lazylru.FlateCompressor{}, 64)
+	defer c.Close()
+
+	// each of these is 3400 bytes raw, but far smaller once compressed
+	big := bytes.Repeat([]byte(`{"name":"thing","tags":["a","b"]},`), 100)
+	require.NoError(t, c.Set("a", big))
+	stored := int64(c.Stats().BytesHeld)
+	require.Less(t, stored, int64(len(big))/10)
+
+	c.SetMaxBytes(3 * stored)
+	for _, key := range []string{"b", "c", "d"} {
+		require.NoError(t, c.Set(key, big))
+	}
+	require.Equal(t, 3, c.Len())
+	require.Equal(t, uint64(3*stored), c.Stats().BytesHeld)
+	_, ok, _ := c.Get("a")
+	require.False(t, ok)
+	require.Equal(t, uint32(1), c.Stats().Cache.Evictions)
+
+	// overwriting and deleting give back the room the old value took
+	require.NoError(t, c.Set("b", []byte("tiny")))
+	require.Equal(t, uint64(2*stored+5), c.Stats().BytesHeld)
+	c.Delete("c")
+	require.Equal(t, uint64(stored+5), c.Stats().BytesHeld)
+
+	// a value bigger than the whole limit is not kept
+	incompressible := make([]byte, 3*stored)
+	rng := rand.New(rand.NewPCG(1, 2)) //nolint:gosec
+	for i := range incompressible {
+		incompressible[i] = byte(rng.Uint32())
+	}
+	require.NoError(t, c.Set("huge", incompressible))
+	_, ok, _ = c.Get("huge")
+	require.False(t, ok)
+	require.LessOrEqual(t, int64(c.Stats().BytesHeld), 3*stored)
+
+	c.SetMaxBytes(0)
+	require.NoError(t, c.Set("huge", incompressible))
+	_, ok, _ = c.Get("huge")
+	require.True(t, ok)
+}
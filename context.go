@@ -0,0 +1,108 @@
+package lazylru
+
+import (
+	"context"
+	"time"
+)
+
+// GetCtx retrieves a value from the cache. The returned bool indicates whether
+// the key was found in the cache. If the context ends while waiting to read,
+// the context's error is returned. Once the value has been read, GetCtx will
+// not wait for the exclusive lock past the end of the context, so moving the
+// item in the queue or removing it because it has expired may be skipped.
+func (lru *LazyLRU[K, V]) GetCtx(ctx context.Context, key K) (V, bool, error) {
+	return lru.getThrough(ctx, key)
+}
+
+// MGetCtx retrieves values from the cache. Missing values will not be
+// returned. If the context ends while waiting to read, the context's error is
+// returned. See GetCtx.
+func (lru *LazyLRU[K, V]) MGetCtx(ctx context.Context, keys ...K) (map[K]V, error) {
+	return lru.mgetThrough(ctx, keys)
+}
+
+// SetCtx writes to the cache. If the context ends while waiting to write,
+// nothing is written and the context's error is returned. If the write causes
+// evictions, SetCtx waits for the eviction callbacks until the context ends.
+// Any callbacks that are still running at that point finish in the background
+// and SetCtx returns nil, because the write has already happened.
+func (lru *LazyLRU[K, V]) SetCtx(ctx context.Context, key K, value V) error {
+	return lru.set(ctx, key, value, lru.ttl, PriorityNormal)
+}
+
+// SetTTLCtx writes to the cache, expiring with the given time-to-live value.
+// See SetCtx.
+func (lru *LazyLRU[K, V]) SetTTLCtx(ctx context.Context, key K, value V, ttl time.Duration) error {
+	return lru.set(ctx, key, value, ttl, PriorityNormal)
+}
+
+// lockContext takes the write lock, giving up if the context ends first
+func (lru *LazyLRU[K, V]) lockContext(ctx context.Context) error {
+	if ctx.Done() == nil {
+		// skip building the method values, which would allocate
+		lru.lock.Lock()
+		return nil
+	}
+	return acquireContext(ctx, lru.lock.TryLock, lru.lock.Lock, lru.lock.Unlock)
+}
+
+// rlockContext takes the read lock, giving up if the context ends first
+func (lru *LazyLRU[K, V]) rlockContext(ctx context.Context) error {
+	if ctx.Done() == nil {
+		lru.lock.RLock()
+		return nil
+	}
+	return acquireContext(ctx, lru.lock.TryRLock, lru.lock.RLock, lru.lock.RUnlock)
+}
+
+// acquireContext takes a lock, giving up if the context ends first. Locks can't
+// be abandoned, so if the context ends while waiting, a goroutine is left to
+// take the lock and release it immediately.
+func acquireContext(ctx context.Context, tryLock func() bool, lock, unlock func()) error {
+	if ctx.Done() == nil {
+		// this context never ends, so there is nothing to be gained
+		lock()
+		return nil
+	}
+	if tryLock() {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	acquired := make(chan struct{})
+	go func() {
+		lock()
+		select {
+		case acquired <- struct{}{}:
+		case <-ctx.Done():
+			unlock()
+		}
+	}()
+	select {
+	case <-acquired:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// execOnEvictContext runs the eviction callbacks, but stops waiting for them
+// if the context ends first. It reports whether the callbacks finished.
+func (lru *LazyLRU[K, V]) execOnEvictContext(ctx context.Context, deathList []*item[K, V]) bool {
+	if ctx.Done() == nil {
+		lru.execOnEvict(deathList)
+		return true
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lru.execOnEvict(deathList)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
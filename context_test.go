@@ -0,0 +1,115 @@
+package lazylru
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextNotBlocked(t *testing.T) {
+	lru := NewT[string, int](10, time.Hour)
+	defer lru.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	require.NoError(t, lru.SetCtx(ctx, "a", 1))
+	require.NoError(t, lru.SetTTLCtx(ctx, "b", 2, time.Hour))
+	v, ok, err := lru.GetCtx(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+	_, ok, err = lru.GetCtx(ctx, "missing")
+	require.NoError(t, err)
+	require.False(t, ok)
+	vals, err := lru.MGetCtx(ctx, "a", "b", "missing")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"a": 1, "b": 2}, vals)
+}
+
+func TestContextWriteLockHeld(t *testing.T) {
+	lru := NewT[string, int](10, time.Hour)
+	defer lru.Close()
+	lru.Set("a", 1)
+
+	lru.lock.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, lru.SetCtx(ctx, "b", 2), context.DeadlineExceeded)
+	_, _, err := lru.GetCtx(ctx, "a")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = lru.MGetCtx(ctx, "a")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	lru.lock.Unlock()
+
+	// the abandoned lockers must not hold on to the lock
+	lru.Set("c", 3)
+	require.Equal(t, 2, lru.Len())
+	_, ok := lru.Get("b")
+	require.False(t, ok)
+}
+
+func TestContextSkipsShuffle(t *testing.T) {
+	lru := NewT[int, int](10, time.Hour)
+	defer lru.Close()
+	for i := 0; i < 10; i++ {
+		lru.Set(i, i)
+	}
+	lru.SetTTL(10, 10, -time.Second) // evicts 0, expired on arrival
+
+	// readers are fine, but nobody can shuffle or remove expired items. Each
+	// abandoned attempt to take the write lock blocks new readers until it
+	// gives up, so each read gets a lock of its own.
+	withReadLock := func(read func(ctx context.Context)) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		lru.lock.RLock()
+		read(ctx)
+		lru.lock.RUnlock()
+	}
+	withReadLock(func(ctx context.Context) {
+		v, ok, err := lru.GetCtx(ctx, 1)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, 1, v)
+	})
+	withReadLock(func(ctx context.Context) {
+		_, ok, err := lru.GetCtx(ctx, 10)
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+	withReadLock(func(ctx context.Context) {
+		vals, err := lru.MGetCtx(ctx, 2, 10)
+		require.NoError(t, err)
+		require.Equal(t, map[int]int{2: 2}, vals)
+	})
+
+	stats := lru.Stats()
+	require.Equal(t, uint32(0), stats.Shuffles)
+	require.Equal(t, uint32(0), stats.KeysReadExpired)
+	require.Equal(t, 10, lru.Len())
+}
+
+func TestContextSlowCallback(t *testing.T) {
+	lru := NewT[int, int](1, time.Hour)
+	defer lru.Close()
+	release := make(chan struct{})
+	evicted := make(chan int, 1)
+	lru.OnEvict(func(k, _ int) {
+		<-release
+		evicted <- k
+	})
+	lru.Set(1, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.NoError(t, lru.SetCtx(ctx, 2, 2))
+	v, ok := lru.Get(2)
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+
+	// the callback is still allowed to finish
+	close(release)
+	require.Equal(t, 1, <-evicted)
+}
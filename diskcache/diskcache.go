@@ -0,0 +1,382 @@
+// Package diskcache is a key-value cache held in an append-only file on disk,
+// with only the index held in memory. It can be used on its own or as the
+// second tier of a lazylru.Tiered cache, for data sets that are bigger than
+// memory.
+//
+// Every write and delete is appended to the segment file, so older versions of
+// a key take up space until the file is compacted. When the cache is opened,
+// the file is replayed to rebuild the index. A record that was only partly
+// written when the process died is detected by its checksum and cut off, along
+// with anything after it.
+package diskcache
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed is returned when using a cache that has been closed
+var ErrClosed = errors.New("diskcache is closed")
+
+// Options controls how the cache behaves
+type Options struct {
+	// CompactRatio triggers a compaction after a write when more than this
+	// fraction of the file is taken up by dead records, such as overwritten,
+	// deleted, or expired values. Zero never compacts automatically. The write
+	// has been made whether or not the compaction works; failures are counted
+	// in Stats().CompactionErrors and tried again after the next write.
+	CompactRatio float64
+	// CompactMinBytes keeps small files from being compacted automatically
+	CompactMinBytes int64
+	// SyncWrites flushes every write to stable storage before returning. This
+	// is much slower, but no acknowledged write is lost if the machine crashes.
+	SyncWrites bool
+}
+
+// Stats represents counts of actions against the cache
+type Stats struct {
+	Keys             int   // live keys in the index
+	FileBytes        int64 // size of the segment file
+	DeadBytes        int64 // bytes in the file taken up by dead records
+	Hits             uint64
+	Misses           uint64
+	Expired          uint64 // reads that found an expired value
+	Writes           uint64
+	Deletes          uint64
+	Compactions      uint64
+	CompactionErrors uint64 // automatic compactions that failed
+	Replayed         uint64 // records read when the cache was opened
+	Truncated        int64  // bytes of damaged records cut off when the cache was opened
+}
+
+// entry is where to find a value in the file
+type entry struct {
+	expiration time.Time
+	offset     int64 // start of the record
+	size       int64 // size of the whole record
+	valueOff   int64 // start of the value, relative to offset
+}
+
+func (e entry) expired(now time.Time) bool {
+	return !e.expiration.IsZero() && e.expiration.Before(now)
+}
+
+// Cache is a key-value cache held in an append-only file
+type Cache struct {
+	index map[string]entry
+	file  *os.File
+	path  string
+	opts  Options
+	size  int64 // where the next record goes
+	dead  int64
+	stats Stats
+	lock  sync.RWMutex
+}
+
+// Open opens the cache in the given file, creating it if needed and replaying
+// it if it already exists
+func Open(path string, opts Options) (*Cache, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600) //nolint:gosec // the caller picks the path
+	if err != nil {
+		return nil, err
+	}
+	c := &Cache{
+		index: map[string]entry{},
+		file:  file,
+		path:  path,
+		opts:  opts,
+	}
+	if err := c.replay(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// replay rebuilds the index from the file, cutting off any damaged tail
+func (c *Cache) replay() error {
+	if _, err := c.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(c.file)
+	now := time.Now()
+	var offset int64
+	for {
+		rec, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// everything from here on is suspect
+			info, serr := c.file.Stat()
+			if serr != nil {
+				return serr
+			}
+			c.stats.Truncated = info.Size() - offset
+			if err := c.file.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		c.stats.Replayed++
+		c.apply(rec, offset, now)
+		offset += rec.size()
+	}
+	c.size = offset
+	return nil
+}
+
+// apply updates the index for a record at the given offset. This is NOT
+// thread safe and should always be called with a write lock
+func (c *Cache) apply(rec *record, offset int64, now time.Time) {
+	if old, ok := c.index[rec.key]; ok {
+		c.dead += old.size
+		delete(c.index, rec.key)
+	}
+	if rec.op == opDelete || (!rec.expiration.IsZero() && rec.expiration.Before(now)) {
+		c.dead += rec.size()
+		return
+	}
+	c.index[rec.key] = entry{
+		expiration: rec.expiration,
+		offset:     offset,
+		size:       rec.size(),
+		valueOff:   rec.valueOffset(),
+	}
+}
+
+// Get reads a value and the time it expires. A zero expiration means the value
+// never expires. The returned bool indicates whether the key was found.
+func (c *Cache) Get(key string) ([]byte, time.Time, bool, error) {
+	c.lock.RLock()
+	if c.file == nil {
+		c.lock.RUnlock()
+		return nil, time.Time{}, false, ErrClosed
+	}
+	e, ok := c.index[key]
+	if !ok {
+		c.lock.RUnlock()
+		c.count(&c.stats.Misses)
+		return nil, time.Time{}, false, nil
+	}
+	if e.expired(time.Now()) {
+		c.lock.RUnlock()
+		c.count(&c.stats.Expired)
+		return nil, time.Time{}, false, nil
+	}
+	value := make([]byte, e.size-e.valueOff)
+	_, err := c.file.ReadAt(value, e.offset+e.valueOff)
+	c.lock.RUnlock()
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	c.count(&c.stats.Hits)
+	return value, e.expiration, true, nil
+}
+
+// Set writes a value that expires at the given time. A zero expiration means
+// the value never expires.
+func (c *Cache) Set(key string, value []byte, expiration time.Time) error {
+	return c.append(&record{op: opSet, key: key, value: value, expiration: expiration})
+}
+
+// Delete removes a value. Deleting a key that is not in the cache is safe.
+func (c *Cache) Delete(key string) error {
+	c.lock.RLock()
+	_, ok := c.index[key]
+	c.lock.RUnlock()
+	if !ok {
+		return nil
+	}
+	return c.append(&record{op: opDelete, key: key})
+}
+
+// append writes a record to the end of the file and updates the index
+func (c *Cache) append(rec *record) error {
+	buf := rec.marshal()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.file == nil {
+		return ErrClosed
+	}
+	if _, err := c.file.WriteAt(buf, c.size); err != nil {
+		return err
+	}
+	if c.opts.SyncWrites {
+		if err := c.file.Sync(); err != nil {
+			return err
+		}
+	}
+	c.apply(rec, c.size, time.Now())
+	c.size += int64(len(buf))
+	if rec.op == opDelete {
+		c.stats.Deletes++
+	} else {
+		c.stats.Writes++
+	}
+	if c.shouldCompact() {
+		if err := c.compact(); err != nil {
+			c.stats.CompactionErrors++
+		}
+	}
+	return nil
+}
+
+// shouldCompact decides whether there is enough garbage to compact. This is
+// NOT thread safe and should always be called with a lock
+func (c *Cache) shouldCompact() bool {
+	return c.opts.CompactRatio > 0 &&
+		c.size >= c.opts.CompactMinBytes &&
+		float64(c.dead) > float64(c.size)*c.opts.CompactRatio
+}
+
+// count increments a counter that is updated outside of the write lock
+func (c *Cache) count(counter *uint64) {
+	atomic.AddUint64(counter, 1)
+}
+
+// Compact rewrites the file with only the live, unexpired values
+func (c *Cache) Compact() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.file == nil {
+		return ErrClosed
+	}
+	return c.compact()
+}
+
+// compact copies the live records to a new file and swaps it in. This is NOT
+// thread safe and should always be called with a write lock
+func (c *Cache) compact() error {
+	tmpPath := c.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600) //nolint:gosec // derived from the caller's path
+	if err != nil {
+		return err
+	}
+	cleanup := func(err error) error {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	// copy in file order so that reading the old file is sequential
+	keys := make([]string, 0, len(c.index))
+	for key := range c.index {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return c.index[keys[i]].offset < c.index[keys[j]].offset })
+
+	now := time.Now()
+	w := bufio.NewWriter(tmp)
+	index := make(map[string]entry, len(c.index))
+	var offset int64
+	for _, key := range keys {
+		e := c.index[key]
+		if e.expired(now) {
+			continue
+		}
+		buf := make([]byte, e.size)
+		if _, err := c.file.ReadAt(buf, e.offset); err != nil {
+			return cleanup(err)
+		}
+		if _, err := w.Write(buf); err != nil {
+			return cleanup(err)
+		}
+		e.offset = offset
+		index[key] = e
+		offset += e.size
+	}
+	if err := w.Flush(); err != nil {
+		return cleanup(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return cleanup(err)
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		return cleanup(err)
+	}
+	_ = c.file.Close()
+	c.file = tmp
+	c.index = index
+	c.size = offset
+	c.dead = 0
+	c.stats.Compactions++
+	// the new file is in place either way, but until the directory is synced,
+	// a crash can bring back the old one
+	return syncDir(filepath.Dir(c.path))
+}
+
+// syncDir flushes a directory's entries, such as a rename, to stable storage
+func syncDir(path string) error {
+	dir, err := os.Open(path) //nolint:gosec // derived from the caller's path
+	if err != nil {
+		return err
+	}
+	err = dir.Sync()
+	if cerr := dir.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Len returns the number of keys in the cache, including any that have
+// expired but not yet been compacted away
+func (c *Cache) Len() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return len(c.index)
+}
+
+// Sync flushes the file to stable storage
+func (c *Cache) Sync() error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.file == nil {
+		return ErrClosed
+	}
+	return c.file.Sync()
+}
+
+// Close syncs and closes the file. The cache can be opened again from the
+// same file.
+func (c *Cache) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Sync()
+	if cerr := c.file.Close(); err == nil {
+		err = cerr
+	}
+	c.file = nil
+	c.index = nil
+	return err
+}
+
+// Stats gets a copy of the stats held by the cache
+func (c *Cache) Stats() Stats {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return Stats{
+		Keys:             len(c.index),
+		FileBytes:        c.size,
+		DeadBytes:        c.dead,
+		Hits:             atomic.LoadUint64(&c.stats.Hits),
+		Misses:           atomic.LoadUint64(&c.stats.Misses),
+		Expired:          atomic.LoadUint64(&c.stats.Expired),
+		Writes:           c.stats.Writes,
+		Deletes:          c.stats.Deletes,
+		Compactions:      c.stats.Compactions,
+		CompactionErrors: c.stats.CompactionErrors,
+		Replayed:         c.stats.Replayed,
+		Truncated:        c.stats.Truncated,
+	}
+}
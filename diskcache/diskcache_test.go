@@ -0,0 +1,259 @@
+package diskcache_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/TriggerMail/lazylru/diskcache"
+	"github.com/stretchr/testify/require"
+)
+
+func open(t *testing.T, path string, opts diskcache.Options) *diskcache.Cache {
+	t.Helper()
+	c, err := diskcache.Open(path, opts)
+	require.NoError(t, err)
+	return c
+}
+
+func requireValue(t *testing.T, c *diskcache.Cache, key, expected string) {
+	t.Helper()
+	v, _, ok, err := c.Get(key)
+	require.NoError(t, err)
+	require.True(t, ok, "expected %s to be found", key)
+	require.Equal(t, expected, string(v))
+}
+
+func requireMissing(t *testing.T, c *diskcache.Cache, key string) {
+	t.Helper()
+	_, _, ok, err := c.Get(key)
+	require.NoError(t, err)
+	require.False(t, ok, "expected %s to be missing", key)
+}
+
+func TestSetGetDelete(t *testing.T) {
+	c := open(t, filepath.Join(t.TempDir(), "cache"), diskcache.Options{})
+	defer c.Close()
+	require.NoError(t, c.Set("a", []byte("alpha"), time.Time{}))
+	require.NoError(t, c.Set("b", []byte("bravo"), time.Now().Add(time.Hour)))
+	require.NoError(t, c.Set("a", []byte("ALPHA"), time.Time{}))
+	requireValue(t, c, "a", "ALPHA")
+	requireValue(t, c, "b", "bravo")
+	requireMissing(t, c, "c")
+
+	require.NoError(t, c.Delete("b"))
+	require.NoError(t, c.Delete("c"))
+	requireMissing(t, c, "b")
+	require.Equal(t, 1, c.Len())
+
+	stats := c.Stats()
+	require.Equal(t, uint64(3), stats.Writes)
+	require.Equal(t, uint64(1), stats.Deletes)
+	require.Equal(t, uint64(2), stats.Hits)
+	require.Equal(t, uint64(2), stats.Misses)
+	require.Greater(t, stats.DeadBytes, int64(0))
+}
+
+func TestTTL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	c := open(t, path, diskcache.Options{})
+	expiration := time.Now().Add(50 * time.Millisecond)
+	require.NoError(t, c.Set("short", []byte("lived"), expiration))
+	require.NoError(t, c.Set("long", []byte("lived"), time.Now().Add(time.Hour)))
+	_, exp, ok, err := c.Get("short")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.True(t, exp.Equal(expiration.Round(0)), "the expiration should survive the round trip")
+	require.NoError(t, c.Close())
+
+	time.Sleep(60 * time.Millisecond)
+	c = open(t, path, diskcache.Options{})
+	defer c.Close()
+	requireMissing(t, c, "short")
+	requireValue(t, c, "long", "lived")
+	require.Equal(t, 1, c.Len(), "expired records are not indexed on replay")
+}
+
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	c := open(t, path, diskcache.Options{})
+	require.NoError(t, c.Set("a", []byte("1"), time.Time{}))
+	require.NoError(t, c.Set("b", []byte("2"), time.Time{}))
+	require.NoError(t, c.Set("a", []byte("3"), time.Time{}))
+	require.NoError(t, c.Delete("b"))
+	require.NoError(t, c.Close())
+
+	c = open(t, path, diskcache.Options{})
+	defer c.Close()
+	requireValue(t, c, "a", "3")
+	requireMissing(t, c, "b")
+	stats := c.Stats()
+	require.Equal(t, uint64(4), stats.Replayed)
+	require.Equal(t, int64(0), stats.Truncated)
+}
+
+func TestRecoverTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	c := open(t, path, diskcache.Options{})
+	require.NoError(t, c.Set("a", []byte("intact"), time.Time{}))
+	require.NoError(t, c.Set("b", []byte("torn"), time.Time{}))
+	good := c.Stats().FileBytes
+	require.NoError(t, c.Close())
+
+	// chop the last record in half
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-3))
+
+	c = open(t, path, diskcache.Options{})
+	requireValue(t, c, "a", "intact")
+	requireMissing(t, c, "b")
+	stats := c.Stats()
+	require.Greater(t, stats.Truncated, int64(0))
+	require.Less(t, stats.FileBytes, good)
+
+	// new writes go after the last good record
+	require.NoError(t, c.Set("c", []byte("after"), time.Time{}))
+	require.NoError(t, c.Close())
+	c = open(t, path, diskcache.Options{})
+	defer c.Close()
+	requireValue(t, c, "a", "intact")
+	requireValue(t, c, "c", "after")
+	require.Equal(t, int64(0), c.Stats().Truncated)
+}
+
+func TestRecoverCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	c := open(t, path, diskcache.Options{})
+	require.NoError(t, c.Set("a", []byte("intact"), time.Time{}))
+	require.NoError(t, c.Set("b", []byte("flipped"), time.Time{}))
+	require.NoError(t, c.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	c = open(t, path, diskcache.Options{})
+	defer c.Close()
+	requireValue(t, c, "a", "intact")
+	requireMissing(t, c, "b")
+}
+
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	c := open(t, path, diskcache.Options{})
+	for i := 0; i < 100; i++ {
+		require.NoError(t, c.Set("churn", []byte("value"), time.Time{}))
+	}
+	require.NoError(t, c.Set("keep", []byte("me"), time.Time{}))
+	require.NoError(t, c.Set("expire", []byte("soon"), time.Now().Add(10*time.Millisecond)))
+	before := c.Stats().FileBytes
+	time.Sleep(20 * time.Millisecond)
+
+	require.NoError(t, c.Compact())
+	stats := c.Stats()
+	require.Less(t, stats.FileBytes, before/10)
+	require.Equal(t, int64(0), stats.DeadBytes)
+	require.Equal(t, 2, stats.Keys)
+	requireValue(t, c, "churn", "value")
+	requireValue(t, c, "keep", "me")
+	require.NoError(t, c.Close())
+
+	// the compacted file replays cleanly
+	c = open(t, path, diskcache.Options{})
+	defer c.Close()
+	requireValue(t, c, "churn", "value")
+	requireValue(t, c, "keep", "me")
+	requireMissing(t, c, "expire")
+	_, err := os.Stat(path + ".compact")
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestAutoCompact(t *testing.T) {
+	c := open(t, filepath.Join(t.TempDir(), "cache"), diskcache.Options{CompactRatio: 0.5, CompactMinBytes: 1024})
+	defer c.Close()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, c.Set("churn", []byte("value"), time.Time{}))
+	}
+	stats := c.Stats()
+	require.Greater(t, stats.Compactions, uint64(0))
+	require.Less(t, stats.FileBytes, int64(2048))
+	requireValue(t, c, "churn", "value")
+}
+
+func TestAutoCompactError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	c := open(t, path, diskcache.Options{CompactRatio: 0.1, SyncWrites: true})
+	defer c.Close()
+	// the compaction can't make its new file where a directory is in the way
+	require.NoError(t, os.Mkdir(path+".compact", 0o700))
+	require.NoError(t, c.Set("a", []byte("one"), time.Time{}))
+	require.NoError(t, c.Set("a", []byte("two"), time.Time{}), "the write went through")
+	stats := c.Stats()
+	require.Equal(t, uint64(0), stats.Compactions)
+	require.Equal(t, uint64(1), stats.CompactionErrors)
+	requireValue(t, c, "a", "two")
+	require.Error(t, c.Compact())
+
+	require.NoError(t, os.Remove(path+".compact"))
+	require.NoError(t, c.Compact())
+	require.Equal(t, uint64(1), c.Stats().Compactions)
+	require.NoError(t, c.Close())
+	reopened := open(t, path, diskcache.Options{})
+	defer reopened.Close()
+	requireValue(t, reopened, "a", "two")
+}
+
+func TestConcurrent(t *testing.T) {
+	c := open(t, filepath.Join(t.TempDir(), "cache"), diskcache.Options{CompactRatio: 0.5, CompactMinBytes: 4096})
+	defer c.Close()
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := string(rune('a' + i%26))
+				if err := c.Set(key, []byte(key), time.Time{}); err != nil {
+					t.Error(err)
+				}
+				if v, _, ok, err := c.Get(key); err != nil || (ok && string(v) != key) {
+					t.Errorf("bad read of %s: %q %v", key, v, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, 26, c.Len())
+}
+
+func TestClosed(t *testing.T) {
+	c := open(t, filepath.Join(t.TempDir(), "cache"), diskcache.Options{})
+	require.NoError(t, c.Close())
+	require.NoError(t, c.Close())
+	require.ErrorIs(t, c.Set("a", nil, time.Time{}), diskcache.ErrClosed)
+	_, _, _, err := c.Get("a")
+	require.ErrorIs(t, err, diskcache.ErrClosed)
+}
+
+func TestTieredL2(t *testing.T) {
+	c := open(t, filepath.Join(t.TempDir(), "cache"), diskcache.Options{})
+	tc := lazylru.NewTiered(lazylru.NewT[int, string](2, time.Hour), diskcache.NewL2[int, string](c))
+	defer func() { require.NoError(t, tc.Close()) }()
+	for i := 0; i < 10; i++ {
+		tc.Set(i, string(rune('a'+i)))
+	}
+	require.Equal(t, 8, c.Len())
+	for i := 0; i < 10; i++ {
+		v, ok := tc.Get(i)
+		require.True(t, ok)
+		require.Equal(t, string(rune('a'+i)), v)
+	}
+	stats := tc.Stats()
+	require.Equal(t, uint32(10), stats.L2Hits, "each promotion pushes out one that is read later")
+	require.Equal(t, uint32(0), stats.L2Errors)
+}
@@ -0,0 +1,81 @@
+package diskcache
+
+import (
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+)
+
+// L2 adapts a Cache to be the second tier of a lazylru.Tiered cache. Keys and
+// values must be encodable with encoding/gob. The disk is the only limit on
+// its size, though expired values are dropped when the file is compacted.
+type L2[K comparable, V any] struct {
+	cache *Cache
+}
+
+var _ lazylru.L2[string, int] = (*L2[string, int])(nil)
+
+// NewL2 wraps a Cache for use as a second tier. Closing the L2 closes the
+// Cache.
+func NewL2[K comparable, V any](cache *Cache) *L2[K, V] {
+	return &L2[K, V]{cache: cache}
+}
+
+// Get reads a value and the time it expires
+func (l2 *L2[K, V]) Get(key K) (V, time.Time, bool, error) {
+	var zero V
+	k, err := encodeKey(key)
+	if err != nil {
+		return zero, time.Time{}, false, err
+	}
+	data, expiration, ok, err := l2.cache.Get(k)
+	if !ok || err != nil {
+		return zero, time.Time{}, false, err
+	}
+	value, err := lazylru.GobCodec[V]{}.Decode(data)
+	if err != nil {
+		return zero, time.Time{}, false, err
+	}
+	return value, expiration, true, nil
+}
+
+// Set writes a value that expires at the given time
+func (l2 *L2[K, V]) Set(key K, value V, expiration time.Time) error {
+	k, err := encodeKey(key)
+	if err != nil {
+		return err
+	}
+	data, err := lazylru.GobCodec[V]{}.Encode(value)
+	if err != nil {
+		return err
+	}
+	return l2.cache.Set(k, data, expiration)
+}
+
+// Delete removes a value
+func (l2 *L2[K, V]) Delete(key K) error {
+	k, err := encodeKey(key)
+	if err != nil {
+		return err
+	}
+	return l2.cache.Delete(k)
+}
+
+// Len returns the number of values held
+func (l2 *L2[K, V]) Len() int {
+	return l2.cache.Len()
+}
+
+// Close closes the underlying Cache
+func (l2 *L2[K, V]) Close() error {
+	return l2.cache.Close()
+}
+
+// encodeKey turns a key into the string used on disk. Strings are used as-is.
+func encodeKey[K comparable](key K) (string, error) {
+	if s, ok := any(key).(string); ok {
+		return s, nil
+	}
+	data, err := lazylru.GobCodec[K]{}.Encode(key)
+	return string(data), err
+}
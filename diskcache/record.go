@@ -0,0 +1,101 @@
+package diskcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// Each record in the segment file is a fixed-size header followed by the key
+// and the value. The checksum covers everything after itself, so a record that
+// was only partly written when the process died is detected on replay.
+//
+//	crc32 (4) | op (1) | expiration (8) | key length (4) | value length (4) | key | value
+const headerSize = 4 + 1 + 8 + 4 + 4
+
+const (
+	opSet    byte = 1
+	opDelete byte = 2
+)
+
+var errCorrupt = errors.New("corrupt record")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// record is a single entry in the segment file
+type record struct {
+	expiration time.Time // zero means the record never expires
+	key        string
+	value      []byte
+	op         byte
+}
+
+// size is the number of bytes the record takes up in the file
+func (r *record) size() int64 {
+	return int64(headerSize + len(r.key) + len(r.value))
+}
+
+// valueOffset is where the value starts, relative to the start of the record
+func (r *record) valueOffset() int64 {
+	return int64(headerSize + len(r.key))
+}
+
+func (r *record) marshal() []byte {
+	buf := make([]byte, r.size())
+	buf[4] = r.op
+	var exp int64
+	if !r.expiration.IsZero() {
+		exp = r.expiration.UnixNano()
+	}
+	binary.BigEndian.PutUint64(buf[5:], uint64(exp))
+	binary.BigEndian.PutUint32(buf[13:], uint32(len(r.key)))
+	binary.BigEndian.PutUint32(buf[17:], uint32(len(r.value)))
+	copy(buf[headerSize:], r.key)
+	copy(buf[headerSize+len(r.key):], r.value)
+	binary.BigEndian.PutUint32(buf, crc32.Checksum(buf[4:], crcTable))
+	return buf
+}
+
+// readRecord reads the next record. io.EOF means there are no more records.
+// Anything else that goes wrong, including a record cut short, is reported as
+// errCorrupt so that replay can stop at the last good record.
+func readRecord(r io.Reader) (*record, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, errCorrupt
+	}
+	klen := binary.BigEndian.Uint32(header[13:])
+	vlen := binary.BigEndian.Uint32(header[17:])
+	if klen > maxRecordPart || vlen > maxRecordPart {
+		return nil, errCorrupt
+	}
+	body := make([]byte, int(klen)+int(vlen))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, errCorrupt
+	}
+	crc := crc32.Update(crc32.Checksum(header[4:], crcTable), crcTable, body)
+	if crc != binary.BigEndian.Uint32(header[:4]) {
+		return nil, errCorrupt
+	}
+	rec := &record{
+		op:    header[4],
+		key:   string(body[:klen]),
+		value: body[klen:],
+	}
+	if exp := int64(binary.BigEndian.Uint64(header[5:])); exp != 0 {
+		rec.expiration = time.Unix(0, exp)
+	}
+	if rec.op != opSet && rec.op != opDelete {
+		return nil, errCorrupt
+	}
+	return rec, nil
+}
+
+// maxRecordPart is the biggest key or value we will believe a header about.
+// Anything bigger is more likely a torn write than a real record.
+const maxRecordPart = 1 << 30
@@ -0,0 +1,121 @@
+package lazylru
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// EvictPolicy decides what happens to an eviction notification when the queue
+// of the asynchronous dispatcher is full.
+type EvictPolicy uint8
+
+const (
+	// EvictBlock waits for room in the queue
+	EvictBlock EvictPolicy = iota
+	// EvictDrop discards the notification, so the callbacks are never called
+	// for that item
+	EvictDrop
+	// EvictInline runs the callbacks in the goroutine that caused the eviction,
+	// as if there were no dispatcher
+	EvictInline
+)
+
+// evictNote is a copy of an evicted item, along with the callbacks registered
+// at the time it was evicted
+type evictNote[K comparable, V any] struct {
+	key       K
+	value     V
+	callbacks []EvictCB[K, V]
+}
+
+// evictDispatcher runs eviction callbacks on a pool of workers
+type evictDispatcher[K comparable, V any] struct {
+	queue  chan evictNote[K, V]
+	wg     sync.WaitGroup
+	mu     sync.RWMutex // guards closed so that nobody sends on a closed queue
+	policy EvictPolicy
+	closed bool
+}
+
+// UseAsyncEvict runs the OnEvict callbacks on the given number of background
+// workers rather than in the Set, MSet, or reaper call that caused the
+// eviction. Notifications wait in a queue of the given size. When the queue is
+// full, the policy decides whether the caller waits, the notification is
+// dropped, or the callbacks run in the caller. Stats().EvictNotesQueued and
+// Stats().EvictNotesDropped count what happened to the notifications.
+//
+// Close waits for the workers to finish the queued notifications. Evictions
+// after that run their callbacks in the caller. Calling this more than once
+// waits for the earlier workers to finish before starting the new ones.
+func (lru *LazyLRU[K, V]) UseAsyncEvict(queueSize, workers int, policy EvictPolicy) {
+	d := &evictDispatcher[K, V]{
+		queue:  make(chan evictNote[K, V], max(queueSize, 0)),
+		policy: policy,
+	}
+	for i := 0; i < max(workers, 1); i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+	lru.lock.Lock()
+	old := lru.dispatcher
+	lru.dispatcher = d
+	lru.lock.Unlock()
+	if old != nil {
+		old.flush()
+	}
+}
+
+func (d *evictDispatcher[K, V]) work() {
+	defer d.wg.Done()
+	for note := range d.queue {
+		for _, cb := range note.callbacks {
+			cb(note.key, note.value)
+		}
+	}
+}
+
+// dispatch queues notifications for the items in the death list, returning
+// the items that should be handled by the caller instead
+func (d *evictDispatcher[K, V]) dispatch(deathList []*item[K, V], callbacks []EvictCB[K, V], stats *Stats) []*item[K, V] {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return deathList
+	}
+	var inline []*item[K, V]
+	for _, pqi := range deathList {
+		note := evictNote[K, V]{key: pqi.key, value: pqi.value, callbacks: callbacks}
+		switch d.policy {
+		case EvictDrop:
+			select {
+			case d.queue <- note:
+				atomic.AddUint32(&stats.EvictNotesQueued, 1)
+			default:
+				atomic.AddUint32(&stats.EvictNotesDropped, 1)
+			}
+		case EvictInline:
+			select {
+			case d.queue <- note:
+				atomic.AddUint32(&stats.EvictNotesQueued, 1)
+			default:
+				inline = append(inline, pqi)
+			}
+		default:
+			d.queue <- note
+			atomic.AddUint32(&stats.EvictNotesQueued, 1)
+		}
+	}
+	return inline
+}
+
+// flush stops accepting notifications and waits for the workers to finish the
+// ones that were already queued. This is safe to call multiple times.
+func (d *evictDispatcher[K, V]) flush() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+	d.wg.Wait()
+}
@@ -0,0 +1,112 @@
+package lazylru_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncEvictFlushedOnClose(t *testing.T) {
+	lru := lazylru.NewT[int, int](1, time.Hour)
+	var mu sync.Mutex
+	evicted := map[int]int{}
+	lru.OnEvict(func(k, v int) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		evicted[k] = v
+		mu.Unlock()
+	})
+	lru.UseAsyncEvict(100, 2, lazylru.EvictBlock)
+	for i := 0; i <= 10; i++ {
+		lru.Set(i, i*10)
+	}
+	lru.Close()
+
+	require.Len(t, evicted, 10)
+	for i := 0; i < 10; i++ {
+		require.Equal(t, i*10, evicted[i])
+	}
+	stats := lru.Stats()
+	require.Equal(t, uint32(10), stats.EvictNotesQueued)
+	require.Equal(t, uint32(0), stats.EvictNotesDropped)
+
+	// after the dispatcher is closed, callbacks run in the caller
+	lru.Set(11, 110)
+	require.Equal(t, 100, evicted[10])
+}
+
+func TestAsyncEvictDoesNotBlockWriter(t *testing.T) {
+	lru := lazylru.NewT[int, int](1, time.Hour)
+	release := make(chan struct{})
+	lru.OnEvict(func(int, int) { <-release })
+	lru.UseAsyncEvict(10, 1, lazylru.EvictBlock)
+	for i := 0; i < 5; i++ {
+		lru.Set(i, i) // would hang if the callback ran here
+	}
+	close(release)
+	lru.Close()
+	require.Equal(t, uint32(4), lru.Stats().EvictNotesQueued)
+}
+
+func TestAsyncEvictDrop(t *testing.T) {
+	lru := lazylru.NewT[int, int](1, time.Hour)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls atomic.Int32
+	lru.OnEvict(func(k, _ int) {
+		if k == 0 {
+			close(started)
+			<-release // hold up the only worker
+		}
+		calls.Add(1)
+	})
+	lru.UseAsyncEvict(1, 1, lazylru.EvictDrop)
+	lru.Set(0, 0)
+	lru.Set(1, 1) // evicts 0, which the worker takes
+	<-started
+	lru.Set(2, 2) // evicts 1, which waits in the queue
+	for i := 3; i < 10; i++ {
+		lru.Set(i, i) // the queue is full, so these are dropped
+	}
+	close(release)
+	lru.Close()
+	stats := lru.Stats()
+	require.Equal(t, uint32(2), stats.EvictNotesQueued)
+	require.Equal(t, uint32(7), stats.EvictNotesDropped)
+	require.Equal(t, int32(2), calls.Load())
+}
+
+func TestAsyncEvictInline(t *testing.T) {
+	lru := lazylru.NewT[int, int](1, time.Hour)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var inline atomic.Int32
+	lru.OnEvict(func(k, _ int) {
+		switch k {
+		case 0:
+			close(started)
+			<-release // hold up the only worker
+		case 1:
+		default:
+			inline.Add(1)
+		}
+	})
+	lru.UseAsyncEvict(1, 1, lazylru.EvictInline)
+	lru.Set(0, 0)
+	lru.Set(1, 1) // evicts 0, which the worker takes
+	<-started
+	lru.Set(2, 2) // evicts 1, which waits in the queue
+	for i := 3; i < 10; i++ {
+		lru.Set(i, i) // the queue is full, so these run here
+	}
+	require.Equal(t, int32(7), inline.Load())
+	close(release)
+	lru.Close()
+	stats := lru.Stats()
+	require.Equal(t, uint32(2), stats.EvictNotesQueued)
+	require.Equal(t, uint32(0), stats.EvictNotesDropped)
+}
@@ -16,6 +16,7 @@ type ExpectedStats struct {
 	Evictions        *uint32
 	KeysReaped       *uint32
 	ReaperCycles     *uint32
+	GhostHits        *uint32
 }
 
 func (es ExpectedStats) WithKeysWritten(v uint32) ExpectedStats {
@@ -58,6 +59,11 @@ func (es ExpectedStats) WithReaperCycles(v uint32) ExpectedStats {
 	return es
 }
 
+func (es ExpectedStats) WithGhostHits(v uint32) ExpectedStats {
+	es.GhostHits = &v
+	return es
+}
+
 func (es ExpectedStats) Test(t *testing.T, stats lazylru.Stats) {
 	if es.KeysWritten != nil {
 		require.Equal(t, int(*es.KeysWritten), int(stats.KeysWritten), "keys written")
@@ -90,4 +96,8 @@ func (es ExpectedStats) Test(t *testing.T, stats lazylru.Stats) {
 	if es.ReaperCycles != nil {
 		require.Equal(t, int(*es.ReaperCycles), int(stats.ReaperCycles), "reaper cycles")
 	}
+
+	if es.GhostHits != nil {
+		require.Equal(t, int(*es.GhostHits), int(stats.GhostHits), "ghost hits")
+	}
 }
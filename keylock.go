@@ -0,0 +1,78 @@
+package lazylru
+
+import (
+	"context"
+	"sync"
+)
+
+// keyLocks hands out a lock per key, so that operations on the same key can be
+// kept in order without holding up operations on other keys. A key's lock is
+// dropped once nobody is using it.
+type keyLocks[K comparable] struct {
+	locks map[K]*keyLock[K]
+	mu    sync.Mutex // guards locks and the refs of each lock
+}
+
+// keyLock is the lock for one key
+type keyLock[K comparable] struct {
+	mu    sync.Mutex
+	refs  int // guarded by the owner's mu
+	owner *keyLocks[K]
+	key   K
+}
+
+// lock takes the lock for a key, giving up if the context ends first
+func (kls *keyLocks[K]) lock(ctx context.Context, key K) (*keyLock[K], error) {
+	kl := kls.ref(key)
+	if err := acquireContext(ctx, kl.mu.TryLock, kl.mu.Lock, kl.mu.Unlock); err != nil {
+		kl.release()
+		return nil, err
+	}
+	return kl, nil
+}
+
+// tryLock takes the lock for a key if nobody else is holding it
+func (kls *keyLocks[K]) tryLock(key K) (*keyLock[K], bool) {
+	kl := kls.ref(key)
+	if !kl.mu.TryLock() {
+		kl.release()
+		return nil, false
+	}
+	return kl, true
+}
+
+// ref finds or makes the lock for a key and takes a reference to it
+func (kls *keyLocks[K]) ref(key K) *keyLock[K] {
+	kls.mu.Lock()
+	defer kls.mu.Unlock()
+	kl, ok := kls.locks[key]
+	if !ok {
+		if kls.locks == nil {
+			kls.locks = map[K]*keyLock[K]{}
+		}
+		kl = &keyLock[K]{owner: kls, key: key}
+		kls.locks[key] = kl
+	}
+	kl.refs++
+	return kl
+}
+
+// unlock releases a key taken by lock or tryLock. This is safe to call on nil.
+func (kl *keyLock[K]) unlock() {
+	if kl == nil {
+		return
+	}
+	kl.mu.Unlock()
+	kl.release()
+}
+
+// release gives up a reference to the lock, dropping it once nobody else is
+// waiting on it
+func (kl *keyLock[K]) release() {
+	kl.owner.mu.Lock()
+	kl.refs--
+	if kl.refs == 0 {
+		delete(kl.owner.locks, kl.key)
+	}
+	kl.owner.mu.Unlock()
+}
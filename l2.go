@@ -0,0 +1,210 @@
+package lazylru
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// l2Forever is how long entries live in the indexes of the second tiers. The
+// real expiration is stored with each value and checked by the Tiered cache,
+// which deletes expired entries that it finds.
+const l2Forever = 100 * 365 * 24 * time.Hour
+
+// CompressedL2 is an in-process second tier that holds values as compressed
+// bytes. This trades CPU for memory, so it can hold more items than the
+// LazyLRU in front of it in the same space. Values must be encodable with
+// encoding/gob.
+type CompressedL2[K comparable, V any] struct {
+	index *LazyLRU[K, []byte]
+	codec Codec[V]
+}
+
+// NewCompressedL2 creates a compressed second tier that holds up to maxItems
+// values, evicting the least recently used when full
+func NewCompressedL2[K comparable, V any](maxItems int) *CompressedL2[K, V] {
+	return &CompressedL2[K, V]{index: NewT[K, []byte](maxItems, 0), codec: GobCodec[V]{}}
+}
+
+// Get reads a value and the time it expires
+func (c *CompressedL2[K, V]) Get(key K) (V, time.Time, bool, error) {
+	data, ok := c.index.Get(key)
+	if !ok {
+		var zero V
+		return zero, time.Time{}, false, nil
+	}
+	value, expiration, err := decodeL2(bytes.NewReader(data), c.codec)
+	if err != nil {
+		return value, time.Time{}, false, err
+	}
+	return value, expiration, true, nil
+}
+
+// Set writes a value that expires at the given time
+func (c *CompressedL2[K, V]) Set(key K, value V, expiration time.Time) error {
+	var buf bytes.Buffer
+	if err := encodeL2(&buf, c.codec, value, expiration); err != nil {
+		return err
+	}
+	c.index.SetTTL(key, buf.Bytes(), l2Forever)
+	return nil
+}
+
+// Delete removes a value
+func (c *CompressedL2[K, V]) Delete(key K) error {
+	c.index.Delete(key)
+	return nil
+}
+
+// Len returns the number of values held
+func (c *CompressedL2[K, V]) Len() int {
+	return c.index.Len()
+}
+
+// Close releases the values held
+func (c *CompressedL2[K, V]) Close() error {
+	c.index.Close()
+	return nil
+}
+
+// FileL2 is a second tier that holds each value in its own file, keeping only
+// the index in memory. Values must be encodable with encoding/gob.
+type FileL2[K comparable, V any] struct {
+	index  *LazyLRU[K, string]
+	codec  Codec[V]
+	dir    string
+	fileIx atomic.Uint64
+	lock   sync.Mutex // keeps the index and the files in step
+}
+
+// NewFileL2 creates a file-backed second tier in a new directory under dir
+// that holds up to maxItems values, evicting the least recently used when
+// full. The directory and everything in it is removed on Close.
+func NewFileL2[K comparable, V any](dir string, maxItems int) (*FileL2[K, V], error) {
+	dir, err := os.MkdirTemp(dir, "lazylru-l2-")
+	if err != nil {
+		return nil, err
+	}
+	f := &FileL2[K, V]{index: NewT[K, string](maxItems, 0), codec: GobCodec[V]{}, dir: dir}
+	f.index.OnEvict(func(_ K, path string) {
+		_ = os.Remove(path)
+	})
+	return f, nil
+}
+
+// Get reads a value and the time it expires
+func (f *FileL2[K, V]) Get(key K) (V, time.Time, bool, error) {
+	var zero V
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	path, ok := f.index.Get(key)
+	if !ok {
+		return zero, time.Time{}, false, nil
+	}
+	file, err := os.Open(path) //nolint:gosec // we made the path
+	if err != nil {
+		return zero, time.Time{}, false, err
+	}
+	defer file.Close()
+	value, expiration, err := decodeL2(file, f.codec)
+	if err != nil {
+		return value, time.Time{}, false, err
+	}
+	return value, expiration, true, nil
+}
+
+// Set writes a value that expires at the given time
+func (f *FileL2[K, V]) Set(key K, value V, expiration time.Time) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	path, ok := f.index.Get(key)
+	if !ok {
+		path = filepath.Join(f.dir, fmt.Sprintf("%016x", f.fileIx.Add(1)))
+	}
+	file, err := os.Create(path) //nolint:gosec // we made the path
+	if err != nil {
+		return err
+	}
+	err = encodeL2(file, f.codec, value, expiration)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// a partly-written file is no use to anyone
+		_ = os.Remove(path)
+		f.index.Delete(key)
+		return err
+	}
+	f.index.SetTTL(key, path, l2Forever)
+	return nil
+}
+
+// Delete removes a value and its file
+func (f *FileL2[K, V]) Delete(key K) error {
+	f.lock.Lock()
+	f.index.Delete(key) // the eviction callback removes the file
+	f.lock.Unlock()
+	return nil
+}
+
+// Len returns the number of values held
+func (f *FileL2[K, V]) Len() int {
+	return f.index.Len()
+}
+
+// Close removes the directory and all of the values in it
+func (f *FileL2[K, V]) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.index.Close()
+	return os.RemoveAll(f.dir)
+}
+
+// encodeL2 writes the expiration, followed by the compressed value
+func encodeL2[V any](w io.Writer, codec Codec[V], value V, expiration time.Time) error {
+	data, err := codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	var header [8]byte
+	binary.BigEndian.PutUint64(header[:], uint64(expiration.UnixNano()))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	zw, err := flate.NewWriter(w, flate.BestSpeed)
+	if err != nil {
+		return err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// decodeL2 reads what encodeL2 wrote
+func decodeL2[V any](r io.Reader, codec Codec[V]) (V, time.Time, error) {
+	var zero V
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return zero, time.Time{}, err
+	}
+	expiration := time.Unix(0, int64(binary.BigEndian.Uint64(header[:])))
+	zr := flate.NewReader(r)
+	defer zr.Close()
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return zero, time.Time{}, err
+	}
+	value, err := codec.Decode(data)
+	if err != nil {
+		return zero, time.Time{}, err
+	}
+	return value, expiration, nil
+}
@@ -1,6 +1,7 @@
 package lazylru
 
 import (
+	"context"
 	"errors"
 	"iter"
 	"math/rand/v2"
@@ -30,15 +31,39 @@ type EvictCB[K comparable, V any] func(K, V)
 type LazyLRU[K comparable, V any] struct {
 	onEvict    []EvictCB[K, V]
 	doneCh     chan int
+	reaperDone chan struct{} // closed when the reaper has stopped
 	index      map[K]*item[K, V]
+	pinned     map[K]*item[K, V] // pinned items are also in the index, but not in items
+	readPath   atomic.Pointer[readPath[K, V]]
+	promotions chan *item[K, V] // pending moves from readers, if buffered
+	dispatcher *evictDispatcher[K, V]
+	backing    atomic.Pointer[backing[K, V]]
+	demote     func(key K, value V, expiration time.Time) // called for items evicted to make room
+	wal        *WAL[K, V]
+	free       []*item[K, V]   // recycled items, guarded by freeLock
+	freeLists  [][]*item[K, V] // recycled death lists, guarded by freeLock
 	items      itemPQ[K, V]
+	classLen   [PriorityHigh + 1]int
 	maxItems   int
+	maxPinned  int
+	bubbler    bubbleState
 	itemIx     uint64
+	clock      *uint64 // source of insert numbers, &itemIx unless shared by a Budget
+	budget     *Budget
+	weigh      func(V) int64 // the weight of a value, if the cache has a weight limit
+	weight     int64
+	maxWeight  int64
 	ttl        time.Duration
+	decay      time.Duration // LFU only: how often access counts are halved
+	lastDecay  time.Time
 	stats      Stats
 	lock       sync.RWMutex
+	freeLock   sync.Mutex
 	isRunning  bool
 	isClosing  bool
+	isClosed   bool // set by CloseContext once the items have been released
+	evictClose bool // fire the eviction callbacks for the remaining items on CloseContext
+	lfu        bool
 	numEvictCB atomic.Int32 // faster to check than locking and checking the length of onEvict
 }
 
@@ -59,30 +84,57 @@ func New(maxItems int, ttl time.Duration) *LazyLRU[string, interface{}] {
 // incur some runtime penalties. If ttl is greater than zero, a background
 // ticker will be engaged to proactively remove expired items.
 func NewT[K comparable, V any](maxItems int, ttl time.Duration) *LazyLRU[K, V] {
+	lru := newLazyLRU[K, V](maxItems, ttl)
+	lru.startReaper()
+
+	return lru
+}
+
+// newLazyLRU creates a LazyLRU without engaging the reaper, so that the
+// factory methods can adjust settings that affect the reaper first.
+func newLazyLRU[K comparable, V any](maxItems int, ttl time.Duration) *LazyLRU[K, V] {
 	if maxItems < 0 {
 		maxItems = 0
 	}
 
-	doneCh := make(chan int)
 	lru := &LazyLRU[K, V]{
-		items:     itemPQ[K, V]{},
-		index:     map[K]*item[K, V]{},
-		maxItems:  maxItems,
-		itemIx:    1, // starting at 1 means that 0 can always be popped
-		ttl:       ttl,
-		doneCh:    doneCh,
-		isRunning: false,
-		stats:     Stats{},
-	}
+		items:      itemPQ[K, V]{},
+		index:      map[K]*item[K, V]{},
+		pinned:     map[K]*item[K, V]{},
+		maxItems:   maxItems,
+		maxPinned:  maxItems / 2,
+		bubbler:    bubbleState{scale: defaultBubbleScale},
+		itemIx:     1, // starting at 1 means that 0 can always be popped
+		ttl:        ttl,
+		doneCh:     make(chan int),
+		reaperDone: make(chan struct{}),
+		isRunning:  false,
+		stats:      Stats{},
+	}
+	lru.clock = &lru.itemIx
+	return lru
+}
 
-	if ttl > 0 {
+// startReaper engages the background reaper if there is any periodic work to
+// do. Otherwise, the cache is marked as closing so that Close is a no-op.
+func (lru *LazyLRU[K, V]) startReaper() {
+	if lru.reapInterval() > 0 {
 		lru.reaper()
 	} else {
 		lru.isClosing = true
-		close(doneCh)
+		close(lru.doneCh)
+		close(lru.reaperDone)
 	}
+}
 
-	return lru
+// reapInterval is the shortest period of the background maintenance tasks, or
+// zero if there are none.
+func (lru *LazyLRU[K, V]) reapInterval() time.Duration {
+	interval := lru.ttl
+	if lru.lfu && lru.decay > 0 && (interval <= 0 || lru.decay < interval) {
+		interval = lru.decay
+	}
+	return interval
 }
 
 // OnEvict registers a callback that will be executed when items are removed
@@ -93,7 +145,7 @@ func NewT[K comparable, V any](maxItems int, ttl time.Duration) *LazyLRU[K, V] {
 // backlog of goroutines.
 //
 // If a Set or MSet operation causes an eviction, this function will be called
-// synchronously to that Set or MSet call.
+// synchronously to that Set or MSet call, unless UseAsyncEvict is in effect.
 func (lru *LazyLRU[K, V]) OnEvict(cb EvictCB[K, V]) {
 	lru.lock.Lock()
 	lru.onEvict = append(lru.onEvict, cb)
@@ -112,10 +164,14 @@ func (lru *LazyLRU[K, V]) execOnEvict(deathList []*item[K, V]) {
 	var callbacks []EvictCB[K, V]
 	lru.lock.RLock()
 	callbacks = lru.onEvict
+	dispatcher := lru.dispatcher
 	lru.lock.RUnlock()
 	if len(callbacks) == 0 {
 		return // this should never happen
 	}
+	if dispatcher != nil {
+		deathList = dispatcher.dispatch(deathList, callbacks, &lru.stats)
+	}
 
 	for _, item := range deathList {
 		for _, cb := range callbacks {
@@ -124,6 +180,35 @@ func (lru *LazyLRU[K, V]) execOnEvict(deathList []*item[K, V]) {
 	}
 }
 
+// afterEvict handles items that were evicted to make room for others. They
+// are flushed to the store if they haven't been yet, handed to the next tier
+// if there is one, and passed to the eviction callbacks.
+func (lru *LazyLRU[K, V]) afterEvict(ctx context.Context, deathList []*item[K, V]) {
+	if lru.budget != nil {
+		lru.budget.enforce()
+	}
+	if len(deathList) == 0 {
+		return
+	}
+	lru.flushEvicted(ctx, deathList)
+	lru.lock.RLock()
+	demote := lru.demote
+	recyclable := lru.promotions == nil
+	lru.lock.RUnlock()
+	if demote != nil {
+		for _, pqi := range deathList {
+			demote(pqi.key, pqi.value, pqi.expiration)
+		}
+	}
+	if lru.numEvictCB.Load() > 0 && !lru.execOnEvictContext(ctx, deathList) {
+		// the callbacks are still running, so the items aren't ours to reuse
+		return
+	}
+	if recyclable {
+		lru.recycle(deathList)
+	}
+}
+
 // IsRunning indicates whether the background reaper is active
 func (lru *LazyLRU[K, V]) IsRunning() bool {
 	lru.lock.RLock()
@@ -135,8 +220,8 @@ func (lru *LazyLRU[K, V]) IsRunning() bool {
 // on a regular basis and check them for expiry. This does not check the whole
 // list, but starts at a random point, looking for expired items.
 func (lru *LazyLRU[K, V]) reaper() {
-	if lru.ttl > 0 {
-		watchTime := lru.ttl / 10
+	if interval := lru.reapInterval(); interval > 0 {
+		watchTime := interval / 10
 		if watchTime < time.Millisecond {
 			watchTime = time.Millisecond
 		}
@@ -154,26 +239,22 @@ func (lru *LazyLRU[K, V]) reaper() {
 				select {
 				case <-lru.doneCh:
 					lru.lock.Lock()
-					// These triggered a race with the shouldBubble method. It
-					// shouldn't really matter, but there isn't much reason to
-					// worry about these things when the whole thing is going
-					// away. Putting a read lock around that first shouldBubble
-					// call had an 8.5% penalty on the read path, so leaving the
-					// data behind seemed like the better choice.
-					// Interestingly, the non-generic version of this code did
-					// not trigger the race condition.
-					// lru.items = nil
-					// lru.index = nil
-					// lru.maxItems = 0
+					// The items and index are left behind here because Close
+					// doesn't stop anyone from using the cache. CloseContext
+					// releases them once it is sure the reaper is gone.
 					lru.isRunning = false
 					lru.lock.Unlock()
 					keepGoing = false
 					break
 				case <-ticker.C:
 					lru.reap(-1, deathList)
+					if lru.lfu {
+						lru.age(time.Now())
+					}
 				}
 			}
 			ticker.Stop()
+			close(lru.reaperDone)
 		}()
 	}
 }
@@ -227,9 +308,9 @@ func (lru *LazyLRU[K, V]) reap(start int, deathList []*item[K, V]) {
 		// mark the expired candidates as dead, remove from index
 		for ix, pqi := range deathList {
 			// it may have been touched between the locks
-			if pqi.insertNumber > 0 && pqi.expiration.Before(timestamp) {
-				lru.items.update(pqi, 0)
-				delete(lru.index, pqi.key)
+			if pqi.insertNumber > 0 && pqi.index >= 0 && pqi.expiration.Before(timestamp) {
+				lru.markDead(pqi)
+				lru.unindex(pqi.key)
 				deathList[ix] = nil
 				lru.stats.KeysReaped++
 			}
@@ -240,6 +321,7 @@ func (lru *LazyLRU[K, V]) reap(start int, deathList []*item[K, V]) {
 		}
 		lru.lock.Unlock()
 	}
+	aggDeathList = lru.reapPinned(timestamp, aggDeathList)
 	atomic.AddUint32(&lru.stats.ReaperCycles, cycles)
 	if len(aggDeathList) > 0 && lru.numEvictCB.Load() > 0 {
 		lru.execOnEvict(aggDeathList)
@@ -250,13 +332,51 @@ func (lru *LazyLRU[K, V]) reap(start int, deathList []*item[K, V]) {
 // moved to the end of the queue. This is NOT thread safe and should only be
 // called with a lock in place.
 func (lru *LazyLRU[K, V]) shouldBubble(index int) bool {
-	return (index + (lru.maxItems - lru.items.Len())) < (lru.maxItems >> 2)
+	// pinned and removed items are not in the queue at all
+	if index < 0 {
+		return false
+	}
+	capacity := lru.maxItems - len(lru.pinned)
+	return (index + (capacity - lru.items.Len())) < (capacity*lru.bubbler.scale)>>bubbleScaleBits
+}
+
+// bubble moves an item to the end of the queue, or in LFU mode, to the place
+// in the queue matching its access count. This is NOT thread safe and should
+// only be called with a write lock.
+func (lru *LazyLRU[K, V]) bubble(pqi *item[K, V]) {
+	if lru.lfu {
+		pqi.freq = atomic.LoadUint32(&pqi.hits)
+	}
+	lru.items.update(pqi, atomic.AddUint64(lru.clock, 1))
+	lru.stats.Shuffles++
+	lru.adapt()
 }
 
 // Get retrieves a value from the cache. The returned bool indicates whether the
 // key was found in the cache.
 func (lru *LazyLRU[K, V]) Get(key K) (V, bool) {
-	lru.lock.RLock()
+	v, ok, _ := lru.getThrough(context.Background(), key)
+	return v, ok
+}
+
+// get retrieves a value from the cache, giving up if the context ends before
+// the value can be read. Once the value has been read, moving it in the queue
+// or removing it because it has expired is skipped if the context ends first.
+func (lru *LazyLRU[K, V]) get(ctx context.Context, key K) (V, bool, error) {
+	var zero V
+	if rp := lru.readPath.Load(); rp != nil {
+		if v, ok, done := lru.getLockFree(rp, key); done {
+			return v, ok, nil
+		}
+	}
+
+	if err := lru.rlockContext(ctx); err != nil {
+		return zero, false, err
+	}
+	if lru.isClosed {
+		lru.lock.RUnlock()
+		return zero, false, ErrClosed
+	}
 	// pqi may be touched between when we release this lock and the writer lock
 	// below, so we need to store the value we read in the stack before checking
 	// the expiration and such. It won't hurt anything because we will take a
@@ -266,12 +386,33 @@ func (lru *LazyLRU[K, V]) Get(key K) (V, bool) {
 	if !ok {
 		lru.lock.RUnlock()
 		atomic.AddUint32(&lru.stats.KeysReadNotFound, 1)
-		var zero V
-		return zero, false
+		return zero, false, nil
+	}
+	// copying the whole item would race with the atomic hit counter
+	qi := item[K, V]{value: pqi.value, expiration: pqi.expiration, index: pqi.index, pinned: pqi.pinned}
+	if lru.lfu {
+		atomic.AddUint32(&pqi.hits, 1)
 	}
-	qi := *pqi
 	lru.lock.RUnlock()
 
+	// pinned items are never shuffled, but they do expire
+	if qi.pinned {
+		if qi.expiration.Before(time.Now()) {
+			if lru.lockContext(ctx) != nil {
+				return zero, false, nil
+			}
+			// double check in case this has already been removed
+			if lru.index[key] == pqi && pqi.pinned && pqi.expiration.Before(time.Now()) {
+				lru.removePinned(pqi)
+				lru.stats.KeysReadExpired++
+			}
+			lru.lock.Unlock()
+			return zero, false, nil
+		}
+		atomic.AddUint32(&lru.stats.KeysReadOK, 1)
+		return qi.value, ok, nil
+	}
+
 	// there is a dangerous case if the read/lock/read pattern returns an
 	// unexpired key on the second read -- if we are not careful, we may end up
 	// trying to take the lock twice. Because "defer" can't help us here, I'm
@@ -279,22 +420,23 @@ func (lru *LazyLRU[K, V]) Get(key K) (V, bool) {
 	var locked bool
 	// if the item is expired, remove it
 	if qi.expiration.Before(time.Now()) && qi.index >= 0 {
-		lru.lock.Lock()
+		if lru.lockContext(ctx) != nil {
+			return zero, false, nil
+		}
 		locked = true
 
-		// double check in case this has already been removed
-		if pqi.expiration.Before(time.Now()) && pqi.index >= 0 {
+		// double check in case this has already been removed, or even reused
+		if lru.index[key] == pqi && pqi.expiration.Before(time.Now()) && pqi.index >= 0 {
 			// this will push the item to the end
-			lru.items.update(pqi, 0)
-			delete(lru.index, pqi.key)
+			lru.markDead(pqi)
+			lru.unindex(pqi.key)
 			// cut off all the expired items. should only be one
 			for lru.items.Len() > 0 && lru.items[0].insertNumber == 0 {
 				_ = heap.Pop(&lru.items)
 			}
 			lru.stats.KeysReadExpired++
 			lru.lock.Unlock()
-			var zero V
-			return zero, false
+			return zero, false, nil
 		}
 	}
 
@@ -302,77 +444,136 @@ func (lru *LazyLRU[K, V]) Get(key K) (V, bool) {
 	// it is at risk of being evicted. This will save us from exclusive locking
 	// 75% of the time.
 	if !locked {
-		lru.lock.RLock()
-		maybeShould := lru.shouldBubble(pqi.index)
+		if lru.rlockContext(ctx) != nil {
+			atomic.AddUint32(&lru.stats.KeysReadOK, 1)
+			return qi.value, ok, nil
+		}
+		maybeShould := lru.index[key] == pqi && lru.shouldBubble(pqi.index)
+		buffered := maybeShould && lru.promotions != nil
+		if buffered {
+			lru.enqueuePromotion(pqi)
+		}
 		lru.lock.RUnlock()
 		if !maybeShould {
 			atomic.AddUint32(&lru.stats.KeysReadOK, 1)
-			return qi.value, ok
+			return qi.value, ok, nil
+		}
+		if buffered {
+			lru.tryDrainPromotions()
+			atomic.AddUint32(&lru.stats.KeysReadOK, 1)
+			return qi.value, ok, nil
 		}
 	}
 
-	if !locked {
-		lru.lock.Lock()
-		// locked = true  // ineffectual
+	if !locked && lru.lockContext(ctx) != nil {
+		// we don't have time to shuffle, but we do have the value
+		atomic.AddUint32(&lru.stats.KeysReadOK, 1)
+		return qi.value, ok, nil
 	}
-	// double check because someone else may have shuffled
-	if lru.shouldBubble(pqi.index) {
-		lru.items.update(pqi, atomic.AddUint64(&(lru.itemIx), 1))
-		lru.stats.Shuffles++
+	// double check because someone else may have shuffled or removed it
+	if lru.index[key] == pqi && lru.shouldBubble(pqi.index) {
+		lru.bubble(pqi)
 	}
 
 	lru.lock.Unlock() // we will definitely be locked if we got here
 
 	atomic.AddUint32(&lru.stats.KeysReadOK, 1)
-	return qi.value, ok
+	return qi.value, ok, nil
 }
 
 // MGet retrieves values from the cache. Missing values will not be returned.
 func (lru *LazyLRU[K, V]) MGet(keys ...K) map[K]V {
-	retval := make(map[K]V, len(keys))
-	maybeExpired := make([]K, 0, len(keys))
-	needsShuffle := make([]K, 0, len(keys))
+	retval, _ := lru.mgetThrough(context.Background(), keys)
+	if retval == nil {
+		retval = map[K]V{}
+	}
+	return retval
+}
 
-	lru.lock.RLock()
-	notfound := uint32(0)
-	for _, key := range keys {
-		if pqi, found := lru.index[key]; found {
-			retval[key] = pqi.value
-			if pqi.expiration.Before(time.Now()) && pqi.index >= 0 {
-				maybeExpired = append(maybeExpired, key)
-			} else if lru.shouldBubble(pqi.index) {
-				needsShuffle = append(needsShuffle, key)
+// mgetEach reads many keys at once, calling emit with the position in keys of
+// each one that is found, and returns the number found. emit may be called
+// while a lock is held, so it must not call back into the cache. Expired items
+// are never emitted. Once the values have been read, moving items in the queue
+// or removing expired items is skipped if the context ends first.
+func (lru *LazyLRU[K, V]) mgetEach(ctx context.Context, keys []K, emit func(i int, value V)) (int, error) {
+	if lru.readPath.Load() != nil {
+		// without locks, there is nothing to be gained by batching
+		found := 0
+		for i, key := range keys {
+			v, ok, err := lru.get(ctx, key)
+			if err != nil {
+				return found, err
 			}
-		} else {
+			if ok {
+				emit(i, v)
+				found++
+			}
+		}
+		return found, nil
+	}
+
+	if err := lru.rlockContext(ctx); err != nil {
+		return 0, err
+	}
+	if lru.isClosed {
+		lru.lock.RUnlock()
+		return 0, ErrClosed
+	}
+	// Rather than keeping lists of the keys that need work, which would
+	// allocate, we note that there is work and look at every key again under
+	// the write lock.
+	now := time.Now()
+	found, notfound := 0, 0
+	needsWrite := false
+	for i, key := range keys {
+		pqi, ok := lru.index[key]
+		if !ok {
 			notfound++
+			continue
+		}
+		if lru.lfu {
+			atomic.AddUint32(&pqi.hits, 1)
 		}
+		if pqi.expiration.Before(now) && (pqi.index >= 0 || pqi.pinned) {
+			needsWrite = true
+			continue
+		}
+		if lru.shouldBubble(pqi.index) {
+			needsWrite = true
+		}
+		emit(i, pqi.value)
+		found++
 	}
 	lru.lock.RUnlock()
 	if notfound > 0 {
-		atomic.AddUint32(&lru.stats.KeysReadNotFound, notfound)
+		atomic.AddUint32(&lru.stats.KeysReadNotFound, uint32(notfound))
 	}
+	atomic.AddUint32(&lru.stats.KeysReadOK, uint32(found))
 
 	// if we are done, let's be done
-	if len(retval) == 0 || (len(maybeExpired) == 0 && len(needsShuffle) == 0) {
-		atomic.AddUint32(&lru.stats.KeysReadOK, uint32(len(retval)))
-		return retval
+	if !needsWrite || lru.lockContext(ctx) != nil {
+		return found, nil
 	}
-
-	// we're going to have to change _something_
-	lru.lock.Lock()
 	defer lru.lock.Unlock()
-	for _, key := range maybeExpired {
+	now = time.Now()
+	for _, key := range keys {
 		pqi, ok := lru.index[key]
 		if !ok {
 			continue
 		}
 		// if the item is expired, remove it
-		if pqi.expiration.Before(time.Now()) && pqi.index >= 0 {
+		if pqi.expiration.Before(now) && pqi.pinned {
+			lru.removePinned(pqi)
+			lru.stats.KeysReadExpired++
+		} else if pqi.expiration.Before(now) && pqi.index >= 0 {
 			// this will push the item to the end
-			lru.items.update(pqi, 0)
-			delete(lru.index, key)
-			delete(retval, key)
+			lru.markDead(pqi)
+			lru.unindex(key)
 			lru.stats.KeysReadExpired++
+		} else if lru.shouldBubble(pqi.index) {
+			// we only want to shuffle this item if it is far enough from the
+			// front that it is at risk of being evicted
+			lru.bubble(pqi)
 		}
 	}
 
@@ -380,22 +581,7 @@ func (lru *LazyLRU[K, V]) MGet(keys ...K) map[K]V {
 	for lru.items.Len() > 0 && lru.items[0].insertNumber == 0 {
 		_ = heap.Pop(&lru.items)
 	}
-
-	for _, key := range needsShuffle {
-		// we only want to shuffle this item if it is far
-		// enough from the front that it is at risk of being
-		// evicted. This will save us from locking 75% of
-		// the time
-		pqi, ok := lru.index[key]
-		if ok && lru.shouldBubble(pqi.index) {
-			lru.stats.Shuffles++
-			// double check because someone else may have shuffled
-			lru.items.update(pqi, atomic.AddUint64(&(lru.itemIx), 1))
-		}
-	}
-
-	atomic.AddUint32(&lru.stats.KeysReadOK, uint32(len(retval)))
-	return retval
+	return found, nil
 }
 
 // Set writes to the cache
@@ -405,43 +591,116 @@ func (lru *LazyLRU[K, V]) Set(key K, value V) {
 
 // SetTTL writes to the cache, expiring with the given time-to-live value
 func (lru *LazyLRU[K, V]) SetTTL(key K, value V, ttl time.Duration) {
-	lru.lock.Lock()
-	deathList := lru.setInternal(key, value, time.Now().Add(ttl))
-	lru.lock.Unlock()
-	if len(deathList) > 0 && lru.numEvictCB.Load() > 0 {
-		lru.execOnEvict(deathList)
+	lru.SetTTLPriority(key, value, ttl, PriorityNormal)
+}
+
+// SetTTLPriority writes to the cache, expiring with the given time-to-live
+// value. When the cache is full, items with a lower priority are evicted
+// before items with a higher priority. Within a priority, the least-recently
+// used item is evicted first.
+func (lru *LazyLRU[K, V]) SetTTLPriority(key K, value V, ttl time.Duration, priority Priority) {
+	_ = lru.set(context.Background(), key, value, ttl, priority)
+}
+
+// set writes to the cache, giving up if the context ends before the write lock
+// is available. Once the write is done, set stops waiting for eviction
+// callbacks if the context ends, but the callbacks are not interrupted.
+func (lru *LazyLRU[K, V]) set(ctx context.Context, key K, value V, ttl time.Duration, priority Priority) error {
+	priority = min(priority, PriorityHigh)
+	kl, err := lru.storeWrite(ctx, key, dirtyEntry[V]{value: value})
+	if err != nil {
+		return err
+	}
+	if err := lru.lockContext(ctx); err != nil {
+		kl.unlock()
+		return err
 	}
+	if lru.isClosed {
+		lru.lock.Unlock()
+		kl.unlock()
+		return ErrClosed
+	}
+	expiration := time.Now().Add(ttl)
+	deathList := lru.setInternal(key, value, expiration, priority, nil)
+	lru.logWrite(walRecord[K, V]{op: walOpSet, key: key, value: value, expiration: expiration, priority: priority})
+	lru.drainLocked()
+	lru.lock.Unlock()
+	kl.unlock()
+	lru.afterEvict(ctx, deathList)
+	return nil
 }
 
-// setInternal writes elements. This is NOT thread safe and should always be
-// called with a write lock
-func (lru *LazyLRU[K, V]) setInternal(key K, value V, expiration time.Time) []*item[K, V] {
+// setInternal writes elements, adding any evicted items to the death list.
+// This is NOT thread safe and should always be called with a write lock
+func (lru *LazyLRU[K, V]) setInternal(key K, value V, expiration time.Time, priority Priority, deathList []*item[K, V]) []*item[K, V] {
 	if lru.maxItems <= 0 {
-		return nil
+		return deathList
 	}
-	var deathList []*item[K, V]
 	lru.stats.KeysWritten++
-	if pqi, ok := lru.index[key]; ok {
+	if pqi, ok := lru.index[key]; ok && pqi.pinned {
+		// pinned items stay pinned until they are explicitly unpinned
+		lru.addWeight(pqi.value, -1)
 		pqi.expiration = expiration
 		pqi.value = value
-		lru.items.update(pqi, atomic.AddUint64(&(lru.itemIx), 1))
+		lru.addWeight(value, 1)
+		lru.publish(pqi)
+	} else if ok {
+		lru.addWeight(pqi.value, -1)
+		pqi.expiration = expiration
+		pqi.value = value
+		lru.addWeight(value, 1)
+		lru.classLen[pqi.priority]--
+		lru.classLen[priority]++
+		pqi.priority = priority
+		if lru.lfu {
+			pqi.freq = atomic.AddUint32(&pqi.hits, 1)
+		}
+		lru.items.update(pqi, atomic.AddUint64(lru.clock, 1))
+		lru.publish(pqi)
 	} else {
-		pqi := &item[K, V]{
+		pqi := lru.newItem()
+		*pqi = item[K, V]{
 			value:        value,
-			insertNumber: atomic.AddUint64(&(lru.itemIx), 1),
+			insertNumber: atomic.AddUint64(lru.clock, 1),
 			key:          key,
 			expiration:   expiration,
+			priority:     priority,
+		}
+		if lru.lfu {
+			pqi.hits, pqi.freq = 1, 1
 		}
+		lru.classLen[priority]++
 
 		// remove excess
-		for lru.items.Len() >= lru.maxItems {
-			deadGuy := heap.Pop(&lru.items)
-			delete(lru.index, deadGuy.key)
-			deathList = append(deathList, deadGuy)
-			lru.stats.Evictions++
-		}
+		deathList = lru.evictExcess(1, deathList)
 		heap.Push(&lru.items, pqi)
 		lru.index[key] = pqi
+		lru.countBudget(1)
+		lru.addWeight(value, 1)
+		lru.publish(pqi)
+	}
+	deathList = lru.evictOverweight(deathList)
+	lru.adapt()
+	return deathList
+}
+
+// evictExcess evicts items from the queue until there is room for the given
+// number of new items alongside the pinned items. This is NOT thread safe and
+// should always be called with a write lock
+func (lru *LazyLRU[K, V]) evictExcess(room int, deathList []*item[K, V]) []*item[K, V] {
+	if deathList == nil && lru.items.Len() > 0 && lru.items.Len()+room > lru.maxItems-len(lru.pinned) {
+		deathList = lru.newDeathList()
+	}
+	for lru.items.Len() > 0 && lru.items.Len()+room > lru.maxItems-len(lru.pinned) {
+		if lru.lfu {
+			lru.refreshHead()
+		}
+		deadGuy := heap.Pop(&lru.items)
+		lru.unindex(deadGuy.key)
+		deathList = append(deathList, deadGuy)
+		lru.classLen[deadGuy.priority]--
+		lru.stats.Evictions++
+		lru.stats.EvictionsByPriority[deadGuy.priority]++
 	}
 	return deathList
 }
@@ -464,48 +723,89 @@ func (lru *LazyLRU[K, V]) MSetTTL(keys []K, values []V, ttl time.Duration) error
 		return errors.New("Mismatch between number of keys and number of values")
 	}
 
+	if lru.backing.Load() != nil {
+		// each key is written to the store and then the cache before the next,
+		// which keeps them in step without holding more than one key at a time
+		for i := 0; i < len(keys); i++ {
+			if err := lru.set(context.Background(), keys[i], values[i], ttl, PriorityNormal); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	var deathList []*item[K, V]
 	lru.lock.Lock()
+	if lru.isClosed {
+		lru.lock.Unlock()
+		return ErrClosed
+	}
 	expiration := time.Now().Add(ttl)
 	for i := 0; i < len(keys); i++ {
-		deathList = append(deathList, lru.setInternal(keys[i], values[i], expiration)...)
+		deathList = lru.setInternal(keys[i], values[i], expiration, PriorityNormal, deathList)
+		lru.logWrite(walRecord[K, V]{op: walOpSet, key: keys[i], value: values[i], expiration: expiration, priority: PriorityNormal})
 	}
+	lru.drainLocked()
 	lru.lock.Unlock()
-	if len(deathList) > 0 && lru.numEvictCB.Load() > 0 {
-		lru.execOnEvict(deathList)
-	}
+	lru.afterEvict(context.Background(), deathList)
 	return nil
 }
 
 // Delete elimitates a key from the cache. Removing a key that is not in the index is safe.
+// If the cache fronts a store, the key is deleted from the store as well, and
+// if the store returns an error, the cache is not changed.
 func (lru *LazyLRU[K, V]) Delete(key K) {
-	// if the key isn't here, don't bother taking the exclusive lock
+	kl, err := lru.storeWrite(context.Background(), key, dirtyEntry[V]{deleted: true})
+	if err != nil {
+		return
+	}
+
+	// if the key isn't here, don't bother taking the exclusive lock, unless
+	// the delete has to be logged
 	lru.lock.RLock()
 	_, ok := lru.index[key]
+	logged := lru.wal != nil && !lru.isClosed
 	lru.lock.RUnlock()
-	if !ok {
+	if !ok && !logged {
+		kl.unlock()
 		return
 	}
 	lru.lock.Lock()
+	if !lru.isClosed {
+		// the key may have been evicted or reaped, but an older write to it
+		// can still be in the log
+		lru.logWrite(walRecord[K, V]{op: walOpDelete, key: key})
+	}
 	pqi, ok := lru.index[key]
 	if !ok {
 		lru.lock.Unlock()
+		kl.unlock()
 		return
 	}
-	delete(lru.index, pqi.key)      // remove from search index
-	lru.items.update(pqi, 0)        // move this item to the top of the heap
-	deadguy := heap.Pop(&lru.items) // pop item from the top of the heap
+	deadguy := pqi
+	if pqi.pinned {
+		lru.removePinned(pqi)
+	} else {
+		lru.unindex(pqi.key)           // remove from search index
+		lru.markDead(pqi)              // move this item to the top of the heap
+		deadguy = heap.Pop(&lru.items) // pop item from the top of the heap
+	}
+	recyclable := lru.promotions == nil
 	lru.lock.Unlock()
+	kl.unlock()
 	if lru.numEvictCB.Load() > 0 {
 		lru.execOnEvict([]*item[K, V]{deadguy})
 	}
+	if recyclable {
+		lru.recycle([]*item[K, V]{deadguy})
+	}
 }
 
-// Len returns the number of items in the cache
+// Len returns the number of items in the cache, including pinned items
 func (lru *LazyLRU[K, V]) Len() int {
 	lru.lock.RLock()
 	defer lru.lock.RUnlock()
-	return len(lru.items)
+	return len(lru.items) + len(lru.pinned)
 }
 
 // Scan returns an iterator that yields current non-expired items from the cache.
@@ -524,6 +824,37 @@ func (lru *LazyLRU[K, V]) Scan() iter.Seq2[K, V] {
 	}
 }
 
+// Keys returns a copy of the keys in the cache, including pinned items and
+// expired items that have not been removed yet
+func (lru *LazyLRU[K, V]) Keys() []K {
+	return lru.keys()
+}
+
+// PeekInfo describes an item found by Peek
+type PeekInfo struct {
+	TTL      time.Duration // how long the item has left to live
+	Priority Priority
+	Pinned   bool
+}
+
+// Peek reads a value without counting the read or moving the item in the
+// queue. Along with the value, it returns what it takes to copy the item into
+// another cache. Expired items are not returned.
+func (lru *LazyLRU[K, V]) Peek(key K) (V, PeekInfo, bool) {
+	var zero V
+	lru.lock.RLock()
+	defer lru.lock.RUnlock()
+	pqi, ok := lru.index[key]
+	if !ok || lru.isClosed {
+		return zero, PeekInfo{}, false
+	}
+	ttl := time.Until(pqi.expiration)
+	if ttl <= 0 {
+		return zero, PeekInfo{}, false
+	}
+	return pqi.value, PeekInfo{TTL: ttl, Priority: pqi.priority, Pinned: pqi.pinned}, true
+}
+
 // keys returns a copy of the cache's keys for the iterator.
 func (lru *LazyLRU[K, V]) keys() []K {
 	lru.lock.RLock()
@@ -535,19 +866,31 @@ func (lru *LazyLRU[K, V]) keys() []K {
 	return keys
 }
 
-// Close stops the reaper process. This is safe to call multiple times.
+// Close stops the reaper process and waits for any queued eviction callbacks.
+// If the cache fronts a store, any queued writes are flushed and the cache
+// stops using the store. It does not wait for the reaper to stop or release
+// any memory; see CloseContext for that. This is safe to call multiple times.
 func (lru *LazyLRU[K, V]) Close() {
 	lru.lock.Lock()
 	if !lru.isClosing {
 		close(lru.doneCh)
 		lru.isClosing = true
 	}
+	dispatcher := lru.dispatcher
 	lru.lock.Unlock()
+	if b := lru.backing.Swap(nil); b != nil {
+		_ = lru.stopBacking(context.Background(), b)
+	}
+	if dispatcher != nil {
+		dispatcher.flush()
+	}
 }
 
 // Stats gets a copy of the stats held by the cache. Note that this is a copy,
 // so returned objects will not update as the service continues to execute.
 func (lru *LazyLRU[K, V]) Stats() Stats {
 	// note that this returns a copy of stats, not a reference
-	return lru.stats
+	lru.lock.RLock()
+	defer lru.lock.RUnlock()
+	return lru.stats.load()
 }
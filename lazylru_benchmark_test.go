@@ -283,3 +283,233 @@ func BenchmarkScan(b *testing.B) {
 		b.Run(fmt.Sprintf("scan/generic/keys/%d", bc.keyCount), bc.ScanGenericValues)
 	}
 }
+
+type benchBubbleConfig struct {
+	policy   func(lru *lazylru.LazyLRU[string, int])
+	capacity int
+	keyCount int
+}
+
+// Run reads keys with a skewed distribution, writing any keys that are missing.
+// The hit rate and the shuffle rate show how well the bubble policy keeps the
+// popular keys in an undersized cache and what it costs in exclusive locks.
+func (bc benchBubbleConfig) Run(b *testing.B) {
+	lru := lazylru.NewT[string, int](bc.capacity, time.Minute)
+	defer lru.Close()
+	bc.policy(lru)
+	zipf := rand.NewZipf(rand.New(rand.NewPCG(1, 2)), 1.1, 1, uint64(bc.keyCount-1)) //nolint:gosec
+	runtime.GC()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ix := int(zipf.Uint64())
+		if _, ok := lru.Get(keys[ix]); !ok {
+			lru.Set(keys[ix], ix)
+		}
+	}
+	b.StopTimer()
+	stats := lru.Stats()
+	b.ReportMetric(float64(stats.KeysReadOK)/float64(b.N), "hits/op")
+	b.ReportMetric(float64(stats.Shuffles)/float64(b.N), "shuffles/op")
+}
+
+func BenchmarkBubble(b *testing.B) {
+	policies := []struct {
+		policy func(lru *lazylru.LazyLRU[string, int])
+		name   string
+	}{
+		{func(lru *lazylru.LazyLRU[string, int]) {}, "default"},
+		{func(lru *lazylru.LazyLRU[string, int]) { lru.SetBubbleFraction(0) }, "never"},
+		{func(lru *lazylru.LazyLRU[string, int]) { lru.SetBubbleFraction(1.0 / 16) }, "fixed1_16"},
+		{func(lru *lazylru.LazyLRU[string, int]) { lru.SetBubbleFraction(1) }, "always"},
+		{func(lru *lazylru.LazyLRU[string, int]) { lru.SetAdaptiveBubble(1.0/16, 1) }, "adaptive"},
+	}
+	for _, cfg := range []struct {
+		capacity int
+		keyCount int
+	}{
+		{100, 10000},
+		{1000, 10000},
+		{10000, 10000},
+	} {
+		for _, p := range policies {
+			bc := benchBubbleConfig{
+				policy:   p.policy,
+				capacity: cfg.capacity,
+				keyCount: cfg.keyCount,
+			}
+			b.Run(fmt.Sprintf("%d/%d/%s", cfg.capacity, cfg.keyCount, p.name), bc.Run)
+		}
+	}
+}
+
+// BenchmarkParallelGet reads from many goroutines at once, with and without the
+// lock-free read path and the promotion buffer, to show the cost of contention
+// on the lock.
+func BenchmarkParallelGet(b *testing.B) {
+	for _, mode := range []struct {
+		setup func(lru *lazylru.LazyLRU[string, int])
+		name  string
+	}{
+		{func(lru *lazylru.LazyLRU[string, int]) {}, "locked"},
+		{func(lru *lazylru.LazyLRU[string, int]) { lru.UseReadBuffers(0) }, "readbuffers"},
+		{func(lru *lazylru.LazyLRU[string, int]) { lru.UsePromotionBuffer(64) }, "promotions"},
+	} {
+		b.Run(mode.name, func(b *testing.B) {
+			lru := lazylru.NewT[string, int](1000, time.Minute)
+			defer lru.Close()
+			mode.setup(lru)
+			for i := 0; i < 1000; i++ {
+				lru.Set(keys[i], i)
+			}
+			runtime.GC()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.IntN(1000) //nolint:gosec
+				for pb.Next() {
+					i = (i + 1) % 1000
+					if v, ok := lru.Get(keys[i]); ok && v != i {
+						b.Errorf("expected %d, got %d", i, v)
+					}
+				}
+			})
+		})
+	}
+}
+
+// layoutCache is the part of the API that LazyLRU and SlabLRU share
+type layoutCache interface {
+	Get(key int) (int, bool)
+	Set(key int, value int)
+}
+
+// BenchmarkLayout compares the pointer-per-item layout of LazyLRU with the
+// slab layout of SlabLRU, in throughput and in how long a full garbage
+// collection takes with the cache full.
+func BenchmarkLayout(b *testing.B) {
+	for _, capacity := range []int{10000, 1000000} {
+		for _, layout := range []struct {
+			make func(capacity int) (layoutCache, func())
+			name string
+		}{
+			{func(capacity int) (layoutCache, func()) {
+				lru := lazylru.NewT[int, int](capacity, time.Hour)
+				return lru, lru.Close
+			}, "pointers"},
+			{func(capacity int) (layoutCache, func()) {
+				return lazylru.NewSlab[int, int](capacity, time.Hour), func() {}
+			}, "slab"},
+		} {
+			b.Run(fmt.Sprintf("%d/%s", capacity, layout.name), func(b *testing.B) {
+				lru, done := layout.make(capacity)
+				defer done()
+				for i := 0; i < capacity; i++ {
+					lru.Set(i, i)
+				}
+				keyCount := capacity * 2
+				runtime.GC()
+				var before runtime.MemStats
+				runtime.ReadMemStats(&before)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					ix := (i * 7919) % keyCount
+					if i%4 == 0 {
+						lru.Set(ix, ix)
+					} else if v, ok := lru.Get(ix); ok && v != ix {
+						b.Fatalf("expected %d, got %d", ix, v)
+					}
+				}
+				b.StopTimer()
+				var after runtime.MemStats
+				runtime.ReadMemStats(&after)
+				b.ReportMetric(float64(after.PauseTotalNs-before.PauseTotalNs)/float64(b.N), "gc-pause-ns/op")
+				start := time.Now()
+				runtime.GC()
+				b.ReportMetric(float64(time.Since(start).Nanoseconds()), "full-gc-ns")
+				runtime.KeepAlive(lru)
+			})
+		}
+	}
+}
+
+// BenchmarkSetAllocs writes new keys to a full cache, so every write evicts.
+// Evicted items are recycled, so once the cache is full, Set should not
+// allocate.
+func BenchmarkSetAllocs(b *testing.B) {
+	const capacity = 1000
+	lru := lazylru.NewT[string, int](capacity, time.Minute)
+	defer lru.Close()
+	for i := 0; i < capacity; i++ {
+		lru.Set(keys[i], i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ix := i % keycnt
+		lru.Set(keys[ix], ix)
+	}
+}
+
+// BenchmarkMSetAllocs writes batches of new keys to a full cache
+func BenchmarkMSetAllocs(b *testing.B) {
+	const capacity, batch = 1000, 10
+	lru := lazylru.NewT[string, int](capacity, time.Minute)
+	defer lru.Close()
+	for i := 0; i < capacity; i++ {
+		lru.Set(keys[i], i)
+	}
+	values := make([]int, batch)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := (i * batch) % (keycnt - batch)
+		if err := lru.MSet(keys[start:start+batch], values); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMGetAllocs compares reading a batch of keys into a new map with
+// reading into reused buffers
+func BenchmarkMGetAllocs(b *testing.B) {
+	const capacity, batch = 1000, 32
+	lru := lazylru.NewT[string, int](capacity, time.Minute)
+	defer lru.Close()
+	for i := 0; i < capacity; i++ {
+		lru.Set(keys[i], i)
+	}
+	batchKeys := func(i int) []string {
+		start := (i * batch) % (capacity - batch)
+		return keys[start : start+batch]
+	}
+	b.Run("MGet", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = lru.MGet(batchKeys(i)...)
+		}
+	})
+	b.Run("MGetInto", func(b *testing.B) {
+		dst := make(map[string]int, batch)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			clear(dst)
+			_ = lru.MGetInto(dst, batchKeys(i)...)
+		}
+	})
+	b.Run("MGetSlice", func(b *testing.B) {
+		vals, found := make([]int, batch), make([]bool, batch)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := lru.MGetSlice(batchKeys(i), vals, found); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("MGetSeq", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for range lru.MGetSeq(batchKeys(i)) {
+			}
+		}
+	})
+}
@@ -598,3 +598,31 @@ func TestScanWithExpiration(t *testing.T) {
 	require.Equal(t, []int{0, 1, 3, 5, 6}, keys)
 	require.Equal(t, []int{0, 16, 48, 80, 96}, values)
 }
+
+func TestPeekAndKeys(t *testing.T) {
+	doTest(t, 10, time.Hour, func(t *testing.T, lru *lazylru.LazyLRU[string, int]) {
+		lru.SetTTLPriority("a", 1, time.Minute, lazylru.PriorityHigh)
+		lru.SetTTL("b", 2, 0)
+		keys := lru.Keys()
+		sort.Strings(keys)
+		require.Equal(t, []string{"a", "b"}, keys)
+
+		v, info, ok := lru.Peek("a")
+		require.True(t, ok)
+		require.Equal(t, 1, v)
+		require.InDelta(t, time.Minute, info.TTL, float64(time.Second))
+		require.Equal(t, lazylru.PriorityHigh, info.Priority)
+		require.False(t, info.Pinned)
+
+		_, _, ok = lru.Peek("b") // expired
+		require.False(t, ok)
+		_, _, ok = lru.Peek("c")
+		require.False(t, ok)
+	},
+		// peeks are not counted as reads
+		ExpectedStats{}.
+			WithKeysWritten(2).
+			WithKeysReadOK(0).
+			WithKeysReadNotFound(0),
+	)
+}
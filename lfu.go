@@ -0,0 +1,75 @@
+package lazylru
+
+import (
+	"sync/atomic"
+	"time"
+
+	heap "github.com/TriggerMail/lazylru/containers/heap"
+)
+
+// NewLFU creates a LazyLRU that evicts the least-frequently-used items rather
+// than the least-recently-used. Ties in access frequency are broken by
+// recency. Every decay period, all access counts are halved so that items that
+// were popular long ago eventually give way to items that are popular now. If
+// decay is zero or fewer, access counts never decay.
+//
+// Reads are counted without an exclusive lock. As with the LRU ordering, an
+// item is only moved within the queue when it is close enough to the front to
+// be at risk of eviction, and any reads that have not been applied yet are
+// taken into account before an item is evicted.
+func NewLFU[K comparable, V any](maxItems int, ttl time.Duration, decay time.Duration) *LazyLRU[K, V] {
+	lru := newLazyLRU[K, V](maxItems, ttl)
+	lru.lfu = true
+	lru.decay = decay
+	lru.lastDecay = time.Now()
+	lru.startReaper()
+
+	return lru
+}
+
+// refreshHead applies any reads that have not yet been reflected in the
+// ordering of the item at the front of the queue, repeating until the front
+// item is up to date. This gives frequently-read items a second chance before
+// they are evicted. This is NOT thread safe and should only be called with a
+// write lock.
+func (lru *LazyLRU[K, V]) refreshHead() {
+	for len(lru.items) > 0 {
+		head := lru.items[0]
+		hits := atomic.LoadUint32(&head.hits)
+		if hits <= head.freq {
+			return
+		}
+		head.freq = hits
+		heap.Fix(&lru.items, 0)
+	}
+}
+
+// age halves the access count of every item if the decay period has elapsed.
+// Most ticks have nothing to do, so they only take the read lock.
+func (lru *LazyLRU[K, V]) age(now time.Time) {
+	if lru.decay <= 0 {
+		return
+	}
+	lru.lock.RLock()
+	due := now.Sub(lru.lastDecay) >= lru.decay
+	lru.lock.RUnlock()
+	if !due {
+		return
+	}
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	// someone else may have aged the items while we waited for the lock
+	if now.Sub(lru.lastDecay) < lru.decay {
+		return
+	}
+	lru.lastDecay = now
+	for _, pqi := range lru.items {
+		hits := atomic.LoadUint32(&pqi.hits) >> 1
+		atomic.StoreUint32(&pqi.hits, hits)
+		pqi.freq = hits
+	}
+	// halving can collapse frequencies together, so ties are now broken by
+	// recency in places the heap did not previously care about
+	heap.Init(&lru.items)
+	lru.stats.Decays++
+}
@@ -0,0 +1,31 @@
+package lazylru
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgeNotDueTakesReadLock(t *testing.T) {
+	lru := NewLFU[string, int](10, 0, time.Hour)
+	defer lru.Close()
+
+	// a reader holding the lock must not hold up a tick with nothing to do
+	lru.lock.RLock()
+	done := make(chan struct{})
+	go func() {
+		lru.age(time.Now())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("age waited for the write lock")
+	}
+	lru.lock.RUnlock()
+	require.Equal(t, uint32(0), lru.Stats().Decays)
+
+	lru.age(time.Now().Add(2 * time.Hour))
+	require.Equal(t, uint32(1), lru.Stats().Decays)
+}
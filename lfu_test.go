@@ -0,0 +1,80 @@
+package lazylru_test
+
+import (
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLFUKeepsFrequent(t *testing.T) {
+	lru := lazylru.NewLFU[string, int](4, time.Hour, time.Hour)
+	defer lru.Close()
+	require.NoError(t, lru.MSet([]string{"a", "b", "c", "d"}, []int{1, 2, 3, 4}))
+	for i := 0; i < 10; i++ {
+		_, ok := lru.Get("a")
+		require.True(t, ok)
+	}
+	_, ok := lru.Get("b")
+	require.True(t, ok)
+
+	// "a" is the oldest, but the most popular
+	require.NoError(t, lru.MSet([]string{"e", "f"}, []int{5, 6}))
+	found := lru.MGet("a", "b", "c", "d", "e", "f")
+	require.Equal(t, 4, len(found))
+	require.Contains(t, found, "a")
+	require.Contains(t, found, "b")
+	require.NotContains(t, found, "c")
+	require.NotContains(t, found, "d")
+
+	es := ExpectedStats{}.WithKeysWritten(6).WithEvictions(2)
+	es.Test(t, lru.Stats())
+}
+
+func TestLFUUnappliedReads(t *testing.T) {
+	lru := lazylru.NewLFU[int, int](8, time.Hour, 0)
+	defer lru.Close()
+	for i := 0; i < 8; i++ {
+		lru.Set(i, i)
+	}
+	// once a read has bubbled 7, it will be far enough back that later reads
+	// are not applied to the ordering until something tries to evict it
+	for i := 0; i < 20; i++ {
+		_, ok := lru.Get(7)
+		require.True(t, ok)
+	}
+	for i := 100; i < 120; i++ {
+		lru.Set(i, i)
+	}
+	v, ok := lru.Get(7)
+	require.True(t, ok)
+	require.Equal(t, 7, v)
+}
+
+func TestLFUDecay(t *testing.T) {
+	lru := lazylru.NewLFU[string, int](2, time.Hour, 5*time.Millisecond)
+	lru.Set("a", 1)
+	for i := 0; i < 4; i++ {
+		_, ok := lru.Get("a")
+		require.True(t, ok)
+	}
+
+	// popularity eventually decays to nothing
+	time.Sleep(50 * time.Millisecond)
+	lru.Close()
+	require.Eventually(t, func() bool { return !lru.IsRunning() }, time.Second, time.Millisecond)
+	require.GreaterOrEqual(t, lru.Stats().Decays, uint32(4))
+
+	lru.Set("b", 2)
+	lru.Set("c", 3)
+	_, ok := lru.Get("a")
+	require.False(t, ok)
+}
+
+func TestLFUNoTTLStillDecays(t *testing.T) {
+	lru := lazylru.NewLFU[string, int](2, 0, time.Millisecond)
+	require.True(t, lru.IsRunning())
+	lru.Close()
+	require.Eventually(t, func() bool { return !lru.IsRunning() }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,63 @@
+package lazylru
+
+import (
+	"context"
+	"errors"
+	"iter"
+)
+
+// ErrShortBuffer is returned by MGetSlice when vals or found is shorter than
+// keys
+var ErrShortBuffer = errors.New("buffer is shorter than the list of keys")
+
+// mgetSeqChunk is the number of keys MGetSeq reads under one lock. The chunk is
+// held on the stack, so it is kept small.
+const mgetSeqChunk = 32
+
+// MGetInto retrieves values from the cache, adding them to dst, and returns the
+// number of keys found. Missing values are not added and dst is not cleared
+// first, so a caller that reuses dst should clear it between calls. Unlike
+// MGet, MGetInto does not allocate unless dst has to grow.
+func (lru *LazyLRU[K, V]) MGetInto(dst map[K]V, keys ...K) int {
+	found, _ := lru.mgetEachThrough(context.Background(), keys, func(i int, v V) { dst[keys[i]] = v })
+	return found
+}
+
+// MGetSlice retrieves values from the cache by position: for each keys[i],
+// vals[i] is set to the value and found[i] to whether it was found. Values that
+// are not found are set to the zero value. It returns the number of keys
+// found, or ErrShortBuffer if vals or found is shorter than keys.
+func (lru *LazyLRU[K, V]) MGetSlice(keys []K, vals []V, found []bool) (int, error) {
+	if len(vals) < len(keys) || len(found) < len(keys) {
+		return 0, ErrShortBuffer
+	}
+	vals, found = vals[:len(keys)], found[:len(keys)]
+	clear(vals)
+	clear(found)
+	return lru.mgetEachThrough(context.Background(), keys, func(i int, v V) {
+		vals[i] = v
+		found[i] = true
+	})
+}
+
+// MGetSeq returns an iterator over the keys that are found in the cache and
+// their values, in the order of keys. Keys are read in small batches as the
+// iterator is used, so values later in the list are read later, and the loop
+// body never runs while the cache is locked.
+func (lru *LazyLRU[K, V]) MGetSeq(keys []K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		var vals [mgetSeqChunk]V
+		var found [mgetSeqChunk]bool
+		for start := 0; start < len(keys); start += mgetSeqChunk {
+			chunk := keys[start:min(start+mgetSeqChunk, len(keys))]
+			if _, err := lru.MGetSlice(chunk, vals[:], found[:]); err != nil {
+				return
+			}
+			for i, key := range chunk {
+				if found[i] && !yield(key, vals[i]) {
+					return
+				}
+			}
+		}
+	}
+}
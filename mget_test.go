@@ -0,0 +1,111 @@
+package lazylru_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMGetInto(t *testing.T) {
+	doTest(t, 10, time.Hour, func(t *testing.T, lru *lazylru.LazyLRU[string, int]) {
+		lru.Set("a", 1)
+		lru.Set("b", 2)
+		lru.SetTTL("c", 3, 0)
+		dst := map[string]int{"old": 0}
+		require.Equal(t, 2, lru.MGetInto(dst, "a", "b", "c", "d"))
+		require.Equal(t, map[string]int{"old": 0, "a": 1, "b": 2}, dst)
+		require.Equal(t, 2, lru.Len())
+	},
+		ExpectedStats{}.
+			WithKeysWritten(3).
+			WithKeysReadOK(2).
+			WithKeysReadNotFound(1).
+			WithKeysReadExpired(1),
+	)
+}
+
+func TestMGetSlice(t *testing.T) {
+	doTest(t, 10, time.Hour, func(t *testing.T, lru *lazylru.LazyLRU[string, int]) {
+		lru.Set("a", 1)
+		lru.Set("c", 3)
+		vals := []int{9, 9, 9, 9}
+		found := []bool{true, true, true, true}
+		n, err := lru.MGetSlice([]string{"a", "b", "c"}, vals, found)
+		require.NoError(t, err)
+		require.Equal(t, 2, n)
+		require.Equal(t, []int{1, 0, 3, 9}, vals)
+		require.Equal(t, []bool{true, false, true, true}, found)
+
+		_, err = lru.MGetSlice([]string{"a", "b"}, vals[:1], found)
+		require.ErrorIs(t, err, lazylru.ErrShortBuffer)
+		_, err = lru.MGetSlice([]string{"a", "b"}, vals, found[:1])
+		require.ErrorIs(t, err, lazylru.ErrShortBuffer)
+	},
+		ExpectedStats{}.
+			WithKeysWritten(2).
+			WithKeysReadOK(2).
+			WithKeysReadNotFound(1),
+	)
+}
+
+func TestMGetSeq(t *testing.T) {
+	doTest(t, 100, time.Hour, func(t *testing.T, lru *lazylru.LazyLRU[string, int]) {
+		keys := make([]string, 100)
+		for i := range keys {
+			keys[i] = strconv.Itoa(i)
+			if i%2 == 0 {
+				lru.Set(keys[i], i)
+			}
+		}
+		var got []int
+		for k, v := range lru.MGetSeq(keys) {
+			require.Equal(t, k, strconv.Itoa(v))
+			got = append(got, v)
+			// the cache is not locked while the loop runs
+			lru.Set("x", v)
+		}
+		require.Len(t, got, 50)
+		for i, v := range got {
+			require.Equal(t, i*2, v)
+		}
+
+		got = got[:0]
+		for _, v := range lru.MGetSeq(keys) {
+			if v >= 10 {
+				break
+			}
+			got = append(got, v)
+		}
+		require.Equal(t, []int{0, 2, 4, 6, 8}, got)
+	},
+		// the second loop stops partway through the first batch of 32 keys,
+		// but the whole batch has been read
+		ExpectedStats{}.
+			WithKeysWritten(100).
+			WithKeysReadOK(50+16).
+			WithKeysReadNotFound(50+16),
+	)
+}
+
+func TestMGetIntoStore(t *testing.T) {
+	store := newMapStore()
+	store.data["stored"] = 7
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	defer lru.Close()
+	lru.UseWriteThrough(store)
+	lru.Set("a", 1)
+
+	dst := map[string]int{}
+	require.Equal(t, 2, lru.MGetInto(dst, "a", "stored", "missing"))
+	require.Equal(t, map[string]int{"a": 1, "stored": 7}, dst)
+
+	vals, found := make([]int, 3), make([]bool, 3)
+	n, err := lru.MGetSlice([]string{"missing", "stored", "a"}, vals, found)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t, []int{0, 7, 1}, vals)
+	require.Equal(t, []bool{false, true, true}, found)
+}
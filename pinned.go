@@ -0,0 +1,155 @@
+package lazylru
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	heap "github.com/TriggerMail/lazylru/containers/heap"
+)
+
+// ErrPinLimit is returned when pinning an item would exceed the number of
+// items that may be pinned in the cache.
+var ErrPinLimit = errors.New("pinned item limit reached")
+
+// SetPinned writes to the cache and pins the item so that it will never be
+// evicted to make room for other items. Pinned items still count against the
+// capacity of the cache and still expire with the default TTL. If the key is
+// already in the cache, it is pinned in place. If the pin limit has been
+// reached, nothing is written and ErrPinLimit is returned.
+func (lru *LazyLRU[K, V]) SetPinned(key K, value V) error {
+	return lru.SetPinnedTTL(key, value, lru.ttl)
+}
+
+// SetPinnedTTL writes to the cache and pins the item, expiring with the given
+// time-to-live value. See SetPinned.
+func (lru *LazyLRU[K, V]) SetPinnedTTL(key K, value V, ttl time.Duration) error {
+	kl, err := lru.storeWrite(context.Background(), key, dirtyEntry[V]{value: value})
+	if err != nil {
+		return err
+	}
+	expiration := time.Now().Add(ttl)
+	lru.lock.Lock()
+	deathList, err := lru.setPinnedInternal(key, value, expiration)
+	if err == nil {
+		// a pinned item keeps the priority it had before it was pinned
+		lru.logWrite(walRecord[K, V]{op: walOpSetPinned, key: key, value: value, expiration: expiration, priority: lru.index[key].priority})
+	}
+	lru.lock.Unlock()
+	kl.unlock()
+	lru.afterEvict(context.Background(), deathList)
+	return err
+}
+
+// setPinnedInternal writes and pins elements. This is NOT thread safe and
+// should always be called with a write lock
+func (lru *LazyLRU[K, V]) setPinnedInternal(key K, value V, expiration time.Time) ([]*item[K, V], error) {
+	if lru.isClosed {
+		return nil, ErrClosed
+	}
+	pqi, ok := lru.index[key]
+	if ok && pqi.pinned {
+		lru.stats.KeysWritten++
+		lru.addWeight(pqi.value, -1)
+		pqi.value = value
+		pqi.expiration = expiration
+		lru.addWeight(value, 1)
+		lru.publish(pqi)
+		return lru.evictOverweight(nil), nil
+	}
+	if len(lru.pinned) >= lru.maxPinned {
+		return nil, ErrPinLimit
+	}
+
+	lru.stats.KeysWritten++
+	if ok {
+		// take it out of the queue, which leaves room for the pin
+		heap.Remove(&lru.items, pqi.index)
+		lru.classLen[pqi.priority]--
+		lru.addWeight(pqi.value, -1)
+	} else {
+		pqi = lru.newItem()
+		*pqi = item[K, V]{key: key, priority: PriorityNormal}
+		lru.index[key] = pqi
+		lru.countBudget(1)
+	}
+	pqi.value = value
+	pqi.expiration = expiration
+	pqi.pinned = true
+	lru.addWeight(value, 1)
+	lru.pinned[key] = pqi
+	lru.publish(pqi)
+	return lru.evictOverweight(lru.evictExcess(0, nil)), nil
+}
+
+// Unpin returns a pinned item to the regular eviction order as the most
+// recently used item. Unpinning a key that is not pinned is safe.
+func (lru *LazyLRU[K, V]) Unpin(key K) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	pqi, ok := lru.pinned[key]
+	if !ok {
+		return
+	}
+	delete(lru.pinned, key)
+	pqi.pinned = false
+	pqi.insertNumber = atomic.AddUint64(lru.clock, 1)
+	heap.Push(&lru.items, pqi)
+	lru.classLen[pqi.priority]++
+	lru.logWrite(walRecord[K, V]{op: walOpUnpin, key: key})
+}
+
+// removePinned takes a pinned item out of the cache. This is NOT thread safe
+// and should always be called with a write lock
+func (lru *LazyLRU[K, V]) removePinned(pqi *item[K, V]) {
+	delete(lru.pinned, pqi.key)
+	lru.unindex(pqi.key)
+	pqi.pinned = false
+}
+
+// reapPinned removes expired pinned items, adding them to the death list.
+// There are few enough pinned items that all of them are checked each time.
+func (lru *LazyLRU[K, V]) reapPinned(timestamp time.Time, deathList []*item[K, V]) []*item[K, V] {
+	lru.lock.RLock()
+	expired := 0
+	if lru.isRunning {
+		for _, pqi := range lru.pinned {
+			if pqi.expiration.Before(timestamp) {
+				expired++
+			}
+		}
+	}
+	lru.lock.RUnlock()
+	if expired == 0 {
+		return deathList
+	}
+
+	lru.lock.Lock()
+	for _, pqi := range lru.pinned {
+		if pqi.expiration.Before(timestamp) {
+			lru.removePinned(pqi)
+			deathList = append(deathList, pqi)
+			lru.stats.KeysReaped++
+		}
+	}
+	lru.lock.Unlock()
+	return deathList
+}
+
+// PinnedLen returns the number of pinned items in the cache
+func (lru *LazyLRU[K, V]) PinnedLen() int {
+	lru.lock.RLock()
+	defer lru.lock.RUnlock()
+	return len(lru.pinned)
+}
+
+// SetPinLimit sets the maximum number of items that may be pinned. By default,
+// up to half of the capacity of the cache may be pinned. At least one slot is
+// always left for unpinned items. Lowering the limit does not unpin any items
+// that are already pinned.
+func (lru *LazyLRU[K, V]) SetPinLimit(maxPinned int) {
+	lru.lock.Lock()
+	lru.maxPinned = max(0, min(maxPinned, lru.maxItems-1))
+	lru.lock.Unlock()
+}
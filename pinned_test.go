@@ -0,0 +1,103 @@
+package lazylru_test
+
+import (
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinnedSurvivesEviction(t *testing.T) {
+	doTest(t, 4, time.Hour, func(t *testing.T, lru *lazylru.LazyLRU[int, int]) {
+		require.NoError(t, lru.SetPinned(0, 0))
+		for i := 1; i < 100; i++ {
+			lru.Set(i, i)
+		}
+		require.Equal(t, 4, lru.Len())
+		require.Equal(t, 1, lru.PinnedLen())
+		v, ok := lru.Get(0)
+		require.True(t, ok)
+		require.Equal(t, 0, v)
+
+		// unpinned, it is now the newest item, but no longer protected
+		lru.Unpin(0)
+		require.Equal(t, 0, lru.PinnedLen())
+		for i := 100; i < 104; i++ {
+			lru.Set(i, i)
+		}
+		_, ok = lru.Get(0)
+		require.False(t, ok)
+	},
+		ExpectedStats{}.WithKeysWritten(104).WithEvictions(100).WithKeysReadOK(1).WithKeysReadNotFound(1),
+	)
+}
+
+func TestPinExisting(t *testing.T) {
+	doTest(t, 4, time.Hour, func(t *testing.T, lru *lazylru.LazyLRU[int, int]) {
+		for i := 0; i < 4; i++ {
+			lru.Set(i, i)
+		}
+		require.NoError(t, lru.SetPinned(0, 10))
+		require.Equal(t, 4, lru.Len())
+		lru.Set(0, 20) // stays pinned
+		lru.Set(4, 4)
+		require.Equal(t, 4, lru.Len())
+		found := lru.MGet(0, 1, 2, 3, 4)
+		require.Equal(t, map[int]int{0: 20, 2: 2, 3: 3, 4: 4}, found)
+	},
+		ExpectedStats{}.WithKeysWritten(7).WithEvictions(1),
+	)
+}
+
+func TestPinLimit(t *testing.T) {
+	doTest(t, 4, time.Hour, func(t *testing.T, lru *lazylru.LazyLRU[int, int]) {
+		require.NoError(t, lru.SetPinned(0, 0))
+		require.NoError(t, lru.SetPinned(1, 1))
+		require.ErrorIs(t, lru.SetPinned(2, 2), lazylru.ErrPinLimit)
+		require.NoError(t, lru.SetPinned(1, 11)) // updates are fine
+
+		lru.SetPinLimit(100) // clamped to leave room for one regular item
+		require.NoError(t, lru.SetPinned(2, 2))
+		require.ErrorIs(t, lru.SetPinned(3, 3), lazylru.ErrPinLimit)
+		require.Equal(t, 3, lru.PinnedLen())
+
+		lru.Set(3, 3)
+		lru.Set(4, 4)
+		require.Equal(t, 4, lru.Len())
+		require.Equal(t, map[int]int{0: 0, 1: 11, 2: 2, 4: 4}, lru.MGet(0, 1, 2, 3, 4))
+	},
+		ExpectedStats{}.WithKeysWritten(6).WithEvictions(1),
+	)
+}
+
+func TestPinnedExpires(t *testing.T) {
+	doTest(t, 4, time.Hour, func(t *testing.T, lru *lazylru.LazyLRU[int, int]) {
+		require.NoError(t, lru.SetPinnedTTL(0, 0, 0))
+		_, ok := lru.Get(0)
+		require.False(t, ok)
+		require.NoError(t, lru.SetPinnedTTL(1, 1, 0))
+		require.Empty(t, lru.MGet(1))
+		require.NoError(t, lru.SetPinnedTTL(2, 2, time.Millisecond))
+		time.Sleep(2 * time.Millisecond)
+		lru.Reap()
+		require.Equal(t, 0, lru.Len())
+		require.Equal(t, 0, lru.PinnedLen())
+	},
+		ExpectedStats{}.WithKeysWritten(3).WithKeysReadExpired(2).WithKeysReaped(1),
+	)
+}
+
+func TestPinnedDelete(t *testing.T) {
+	var evicted []int
+	lru := lazylru.NewT[int, int](4, time.Hour)
+	defer lru.Close()
+	lru.OnEvict(func(k, v int) {
+		evicted = append(evicted, k)
+	})
+	require.NoError(t, lru.SetPinned(0, 0))
+	lru.Delete(0)
+	require.Equal(t, []int{0}, evicted)
+	require.Equal(t, 0, lru.Len())
+	require.Equal(t, 0, lru.PinnedLen())
+}
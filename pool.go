@@ -0,0 +1,62 @@
+package lazylru
+
+// maxFreeItems bounds the free list. Recycled items keep their old key and
+// value reachable until they are reused, so the list is kept short.
+const maxFreeItems = 1024
+
+// maxFreeLists bounds the number of spare death lists
+const maxFreeLists = 16
+
+// newItem takes an item from the free list, or allocates one if the list is
+// empty. The caller must overwrite every field. This is NOT thread safe and
+// should always be called with a write lock, so that nobody holding a read
+// lock can see the old fields being overwritten.
+func (lru *LazyLRU[K, V]) newItem() *item[K, V] {
+	lru.freeLock.Lock()
+	n := len(lru.free)
+	if n == 0 {
+		lru.freeLock.Unlock()
+		return new(item[K, V])
+	}
+	pqi := lru.free[n-1]
+	lru.free[n-1] = nil
+	lru.free = lru.free[:n-1]
+	lru.freeLock.Unlock()
+	return pqi
+}
+
+// newDeathList takes an empty death list from the free list, or returns nil,
+// which append will grow as usual
+func (lru *LazyLRU[K, V]) newDeathList() []*item[K, V] {
+	lru.freeLock.Lock()
+	defer lru.freeLock.Unlock()
+	n := len(lru.freeLists)
+	if n == 0 {
+		return nil
+	}
+	deathList := lru.freeLists[n-1]
+	lru.freeLists[n-1] = nil
+	lru.freeLists = lru.freeLists[:n-1]
+	return deathList
+}
+
+// recycle puts items that have left the cache, and the list that held them,
+// on the free lists. It must only be given items that nothing else can reach:
+// not the read path or the promotion buffer, which hold on to items, and not
+// callbacks that might still be running.
+func (lru *LazyLRU[K, V]) recycle(deathList []*item[K, V]) {
+	if lru.readPath.Load() != nil {
+		return
+	}
+	lru.freeLock.Lock()
+	for i, pqi := range deathList {
+		if len(lru.free) < maxFreeItems {
+			lru.free = append(lru.free, pqi)
+		}
+		deathList[i] = nil
+	}
+	if len(lru.freeLists) < maxFreeLists {
+		lru.freeLists = append(lru.freeLists, deathList[:0])
+	}
+	lru.freeLock.Unlock()
+}
@@ -0,0 +1,90 @@
+package lazylru
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func freeLen[K comparable, V any](lru *LazyLRU[K, V]) int {
+	lru.freeLock.Lock()
+	defer lru.freeLock.Unlock()
+	return len(lru.free)
+}
+
+func TestRecycleEvicted(t *testing.T) {
+	lru := NewT[string, int](2, time.Hour)
+	defer lru.Close()
+	var evicted []string
+	lru.OnEvict(func(k string, v int) {
+		require.Equal(t, k, strconv.Itoa(v))
+		evicted = append(evicted, k)
+	})
+	lru.Set("0", 0)
+	lru.Set("1", 1)
+	lru.Set("2", 2) // evicts 0
+	require.Equal(t, 1, freeLen(lru))
+	lru.Set("3", 3) // reuses 0's item and evicts 1
+	require.Equal(t, 1, freeLen(lru))
+	require.Equal(t, []string{"0", "1"}, evicted)
+
+	for _, key := range []string{"2", "3"} {
+		v, ok := lru.Get(key)
+		require.True(t, ok)
+		require.Equal(t, key, strconv.Itoa(v))
+	}
+
+	lru.Delete("2")
+	require.Equal(t, 2, freeLen(lru))
+	require.NoError(t, lru.MSet([]string{"4", "5", "6"}, []int{4, 5, 6}))
+	require.Equal(t, 2, lru.Len())
+	for _, key := range []string{"5", "6"} {
+		v, ok := lru.Get(key)
+		require.True(t, ok)
+		require.Equal(t, key, strconv.Itoa(v))
+	}
+}
+
+func TestRecycleSkipsRunningCallbacks(t *testing.T) {
+	lru := NewT[string, int](1, time.Hour)
+	defer lru.Close()
+	release := make(chan struct{})
+	lru.OnEvict(func(string, int) { <-release })
+	lru.Set("a", 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.NoError(t, lru.SetCtx(ctx, "b", 2)) // evicts a, but stops waiting
+	require.Equal(t, 0, freeLen(lru))
+	close(release)
+}
+
+func TestRecycleSkipsReadPaths(t *testing.T) {
+	for _, setup := range []func(lru *LazyLRU[string, int]){
+		func(lru *LazyLRU[string, int]) { lru.UseReadBuffers(0) },
+		func(lru *LazyLRU[string, int]) { lru.UsePromotionBuffer(8) },
+	} {
+		lru := NewT[string, int](1, time.Hour)
+		setup(lru)
+		lru.Set("a", 1)
+		lru.Set("b", 2)
+		lru.Delete("b")
+		require.Equal(t, 0, freeLen(lru))
+		lru.Close()
+	}
+}
+
+func TestRecycleBounded(t *testing.T) {
+	lru := NewT[int, int](maxFreeItems*2, time.Hour)
+	defer lru.Close()
+	for i := 0; i < maxFreeItems*2; i++ {
+		lru.Set(i, i)
+	}
+	for i := 0; i < maxFreeItems*2; i++ {
+		lru.Delete(i)
+	}
+	require.Equal(t, maxFreeItems, freeLen(lru))
+}
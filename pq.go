@@ -14,6 +14,11 @@ type item[K any, V any] struct {
 	key          K
 	insertNumber uint64
 	index        int
+	freq         uint32 // LFU only: access count used for ordering
+	hits         uint32 // LFU only: access count, updated atomically on read
+	list         uint8  // which ARC list holds the item; unused by LazyLRU
+	priority     Priority
+	pinned       bool // pinned items are not in the queue at all
 }
 
 // itemPQ isn't thread safe, so it is the responsibility of the containing
@@ -23,6 +28,15 @@ type itemPQ[K any, V any] []*item[K, V]
 func (pq itemPQ[K, V]) Len() int { return len(pq) }
 
 func (pq itemPQ[K, V]) Less(i, j int) bool {
+	// Lower priorities are always evicted first
+	if pq[i].priority != pq[j].priority {
+		return pq[i].priority < pq[j].priority
+	}
+	// Frequency is always zero outside of LFU mode, so this is a pure LRU
+	// unless the caller has asked for something else.
+	if pq[i].freq != pq[j].freq {
+		return pq[i].freq < pq[j].freq
+	}
 	// We want Pop to give us the lowest, not highest insertNumber so we use less than here.
 	return pq[i].insertNumber < pq[j].insertNumber
 }
@@ -52,8 +66,14 @@ func (pq *itemPQ[K, V]) Pop() *item[K, V] {
 	return pqi
 }
 
-// update modifies the insertNumber and value of an item in the queue.
+// update modifies the insertNumber and value of an item in the queue. An
+// insertNumber of zero marks the item as dead, so it must sort ahead of
+// everything else regardless of its priority or frequency.
 func (pq *itemPQ[K, V]) update(pqi *item[K, V], insertNumber uint64) {
 	pqi.insertNumber = insertNumber
+	if insertNumber == 0 {
+		pqi.priority = 0
+		pqi.freq = 0
+	}
 	heap.Fix[*item[K, V]](pq, pqi.index)
 }
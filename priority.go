@@ -0,0 +1,32 @@
+package lazylru
+
+// Priority is the eviction class of an item. When the cache is full, items in
+// lower classes are evicted before items in higher classes, regardless of how
+// recently they were used. Within a class, eviction is approximately LRU.
+type Priority uint8
+
+// Priorities, from first-evicted to last-evicted. Items written without a
+// priority are PriorityNormal.
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+// markDead moves an item to the front of the queue so that it can be popped.
+// This is NOT thread safe and should always be called with a write lock
+func (lru *LazyLRU[K, V]) markDead(pqi *item[K, V]) {
+	lru.classLen[pqi.priority]--
+	lru.items.update(pqi, 0)
+}
+
+// PriorityLen returns the number of unpinned items in the cache with the given
+// priority
+func (lru *LazyLRU[K, V]) PriorityLen(priority Priority) int {
+	if priority > PriorityHigh {
+		return 0
+	}
+	lru.lock.RLock()
+	defer lru.lock.RUnlock()
+	return lru.classLen[priority]
+}
@@ -0,0 +1,54 @@
+package lazylru_test
+
+import (
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriorityEvictionOrder(t *testing.T) {
+	doTest(t, 4, time.Hour, func(t *testing.T, lru *lazylru.LazyLRU[string, int]) {
+		lru.SetTTLPriority("high", 0, time.Hour, lazylru.PriorityHigh)
+		lru.Set("normal", 1)
+		lru.SetTTLPriority("low0", 2, time.Hour, lazylru.PriorityLow)
+		lru.SetTTLPriority("low1", 3, time.Hour, lazylru.PriorityLow)
+		require.Equal(t, 2, lru.PriorityLen(lazylru.PriorityLow))
+		require.Equal(t, 1, lru.PriorityLen(lazylru.PriorityNormal))
+		require.Equal(t, 1, lru.PriorityLen(lazylru.PriorityHigh))
+
+		// low items go first, even though they are newer
+		lru.Set("a", 4)
+		lru.Set("b", 5)
+		require.Equal(t, 0, lru.PriorityLen(lazylru.PriorityLow))
+		require.Equal(t, 3, lru.PriorityLen(lazylru.PriorityNormal))
+
+		// then the oldest normal item
+		lru.Set("c", 6)
+		found := lru.MGet("high", "normal", "low0", "low1", "a", "b", "c")
+		require.Equal(t, map[string]int{"high": 0, "a": 4, "b": 5, "c": 6}, found)
+	},
+		ExpectedStats{}.WithKeysWritten(7).WithEvictions(3),
+	)
+}
+
+func TestPriorityChange(t *testing.T) {
+	lru := lazylru.NewT[string, int](2, time.Hour)
+	defer lru.Close()
+	lru.Set("a", 0)
+	lru.Set("b", 1)
+	lru.SetTTLPriority("a", 0, time.Hour, lazylru.PriorityLow)
+	lru.Delete("b")
+	require.Equal(t, 1, lru.PriorityLen(lazylru.PriorityLow))
+	require.Equal(t, 0, lru.PriorityLen(lazylru.PriorityNormal))
+	lru.Set("c", 2)
+	lru.Set("d", 3)
+	_, ok := lru.Get("a")
+	require.False(t, ok)
+	stats := lru.Stats()
+	require.Equal(t, uint32(1), stats.EvictionsByPriority[lazylru.PriorityLow])
+	require.Equal(t, uint32(0), stats.EvictionsByPriority[lazylru.PriorityNormal])
+	require.Equal(t, 0, lru.PriorityLen(lazylru.PriorityLow))
+	require.Equal(t, 2, lru.PriorityLen(lazylru.PriorityNormal))
+}
@@ -0,0 +1,73 @@
+package lazylru
+
+import "sync/atomic"
+
+// UsePromotionBuffer makes reads that need to move an item in the queue
+// enqueue that item rather than waiting for the exclusive lock. Whichever
+// goroutine can take the lock without waiting applies all of the pending moves
+// in one critical section, as do writers. The buffer holds up to size items;
+// moves that arrive while it is full are dropped rather than blocking the
+// reader, as counted by Stats().PromotionsDropped. If size is zero or fewer,
+// the buffer is removed and reads take the lock to move items, as before.
+// Moves already in a buffer that is replaced or removed are applied first.
+//
+// The average number of moves applied per lock is
+// Stats().PromotionsApplied / Stats().PromotionBatches.
+func (lru *LazyLRU[K, V]) UsePromotionBuffer(size int) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	lru.drainPromotionsLocked()
+	if size <= 0 {
+		lru.promotions = nil
+		return
+	}
+	lru.promotions = make(chan *item[K, V], size)
+}
+
+// enqueuePromotion adds an item to the moves to be applied. This should always
+// be called with at least a read lock, so that UsePromotionBuffer cannot swap
+// the buffer out from under it and lose the move.
+func (lru *LazyLRU[K, V]) enqueuePromotion(pqi *item[K, V]) {
+	select {
+	case lru.promotions <- pqi:
+	default:
+		atomic.AddUint32(&lru.stats.PromotionsDropped, 1)
+	}
+}
+
+// tryDrainPromotions applies the pending moves if nobody else is holding the
+// lock
+func (lru *LazyLRU[K, V]) tryDrainPromotions() {
+	if lru.lock.TryLock() {
+		lru.drainPromotionsLocked()
+		lru.lock.Unlock()
+	}
+}
+
+// drainPromotionsLocked applies the pending moves. This is NOT thread safe and
+// should always be called with a write lock
+func (lru *LazyLRU[K, V]) drainPromotionsLocked() {
+	// Only the holder of the write lock receives, so everything counted here
+	// is there to be read. Anything added after counting waits for the next
+	// batch, so readers can't keep us here forever.
+	n := len(lru.promotions)
+	if n == 0 {
+		return
+	}
+	for ; n > 0; n-- {
+		pqi := <-lru.promotions
+		// double check because the item may have been moved or removed since
+		if lru.index[pqi.key] == pqi && lru.shouldBubble(pqi.index) {
+			lru.bubble(pqi)
+			lru.stats.PromotionsApplied++
+		}
+	}
+	lru.stats.PromotionBatches++
+}
+
+// drainLocked applies any reads that were recorded without the exclusive lock.
+// This is NOT thread safe and should always be called with a write lock
+func (lru *LazyLRU[K, V]) drainLocked() {
+	lru.drainReadsLocked()
+	lru.drainPromotionsLocked()
+}
@@ -0,0 +1,72 @@
+package lazylru_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromotionBuffer(t *testing.T) {
+	lru := lazylru.NewT[int, int](20, time.Hour)
+	defer lru.Close()
+	lru.UsePromotionBuffer(4)
+	for i := 0; i < 20; i++ {
+		lru.Set(i, i)
+	}
+	// nobody else holds the lock, so the read applies its own promotion
+	v, ok := lru.Get(0)
+	require.True(t, ok)
+	require.Equal(t, 0, v)
+	stats := lru.Stats()
+	require.Equal(t, uint32(1), stats.PromotionBatches)
+	require.Equal(t, uint32(1), stats.PromotionsApplied)
+	require.Equal(t, uint32(1), stats.Shuffles)
+
+	// so it survives the next write
+	lru.Set(20, 20)
+	_, ok = lru.Get(0)
+	require.True(t, ok)
+	_, ok = lru.Get(1)
+	require.False(t, ok)
+
+	// without the buffer, reads shuffle under the lock
+	lru.UsePromotionBuffer(0)
+	_, ok = lru.Get(2)
+	require.True(t, ok)
+	stats = lru.Stats()
+	require.Equal(t, uint32(1), stats.PromotionsApplied)
+	require.Equal(t, uint32(2), stats.Shuffles)
+}
+
+func TestPromotionBufferRace(t *testing.T) {
+	lru := lazylru.NewT[int, int](1000, time.Hour)
+	defer lru.Close()
+	lru.UsePromotionBuffer(2)
+	lru.SetBubbleFraction(1)
+	for i := 0; i < 1000; i++ {
+		lru.Set(i, i)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if g == 0 {
+					lru.Set(i, i)
+				} else if v, ok := lru.Get(i); !ok || v != i {
+					t.Errorf("expected %d for key %d, got %d, %v", i, i, v, ok)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	lru.Set(0, 0) // writers apply anything left over
+	stats := lru.Stats()
+	require.Equal(t, uint32(7000), stats.KeysReadOK)
+	require.LessOrEqual(t, stats.PromotionsApplied+stats.PromotionsDropped, uint32(7000))
+	require.Equal(t, stats.Shuffles, stats.PromotionsApplied)
+}
@@ -0,0 +1,28 @@
+package lazylru
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromotionBufferReplaced(t *testing.T) {
+	lru := NewT[int, int](20, time.Hour)
+	defer lru.Close()
+	lru.UsePromotionBuffer(4)
+	for i := 0; i < 20; i++ {
+		lru.Set(i, i)
+	}
+
+	// another reader holds the lock, so the move waits in the buffer
+	lru.lock.RLock()
+	_, ok := lru.Get(0)
+	require.True(t, ok)
+	lru.lock.RUnlock()
+	require.Len(t, lru.promotions, 1)
+
+	lru.UsePromotionBuffer(8)
+	require.Len(t, lru.promotions, 0)
+	require.Equal(t, uint32(1), lru.Stats().PromotionsApplied)
+}
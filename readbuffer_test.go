@@ -0,0 +1,43 @@
+package lazylru
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadBuffersDrainAfterBlockedFill(t *testing.T) {
+	lru := NewT[string, int](100, time.Hour)
+	defer lru.Close()
+	lru.UseReadBuffers(1)
+	for i := 0; i < 100; i++ {
+		lru.Set(strconv.Itoa(i), i)
+	}
+
+	// a writer holds the lock while the buffer fills, so the reader that fills
+	// it can't drain it
+	lru.lock.Lock()
+	for i := 0; i < readBufferSize+4; i++ {
+		_, ok := lru.Get("0")
+		require.True(t, ok)
+	}
+	lru.lock.Unlock()
+	stats := lru.Stats()
+	require.Equal(t, uint32(0), stats.ReadBufferDrains)
+	require.Equal(t, uint32(4), stats.ReadBufferDrops)
+
+	// with no more writes, the next read drains the full buffer
+	_, ok := lru.Get("0")
+	require.True(t, ok)
+	stats = lru.Stats()
+	require.Equal(t, uint32(1), stats.ReadBufferDrains)
+	require.Equal(t, uint32(5), stats.ReadBufferDrops)
+
+	// and later reads are recorded again
+	for i := 0; i < readBufferSize-1; i++ {
+		lru.Get("0")
+	}
+	require.Equal(t, uint32(5), lru.Stats().ReadBufferDrops)
+}
@@ -0,0 +1,161 @@
+package lazylru
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// readBufferSize is the number of accesses each stripe can hold before it must
+// be drained. Accesses recorded while a stripe is full are dropped.
+const readBufferSize = 16
+
+// readEntry is an immutable copy of an item that can be read without a lock.
+// A new entry is published every time the item is written.
+type readEntry[K comparable, V any] struct {
+	expiration time.Time
+	value      V
+	item       *item[K, V]
+}
+
+// readBuffer is a lossy ring of recent accesses. Readers claim slots with an
+// atomic increment and a single drainer applies them to the queue.
+type readBuffer[K comparable, V any] struct {
+	n     atomic.Uint32
+	_     [60]byte // keep the counters of neighboring stripes on separate cache lines
+	slots [readBufferSize]atomic.Pointer[item[K, V]]
+}
+
+// readPath holds the lock-free index and the striped access buffers
+type readPath[K comparable, V any] struct {
+	index   sync.Map // K -> *readEntry[K, V]
+	buffers []readBuffer[K, V]
+}
+
+// UseReadBuffers switches the cache to a mode where Get and MGet do not take
+// any locks. Every write publishes an immutable copy of the item to a
+// concurrent index, which readers use instead of the locked index. Rather than
+// reordering the queue on read, readers record accesses into one of the given
+// number of striped, lossy buffers. When a buffer fills, whichever reader can
+// take the exclusive lock without waiting applies all of the recorded accesses
+// in one batch. Writers also apply any recorded accesses. If stripes is zero or
+// fewer, a stripe per processor is used.
+//
+// Accesses that arrive while a buffer is full are dropped, as counted by
+// Stats().ReadBufferDrops. This makes the ordering of the queue somewhat more
+// approximate, but under heavy read loads, the items that are read often will
+// still be recorded often.
+//
+// Each write allocates a new copy of the item, so this mode only makes sense
+// for caches that are read far more often than they are written. Calling this
+// more than once has no effect.
+func (lru *LazyLRU[K, V]) UseReadBuffers(stripes int) {
+	if stripes <= 0 {
+		stripes = runtime.GOMAXPROCS(0)
+	}
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	if lru.readPath.Load() != nil || lru.isClosed {
+		return
+	}
+	rp := &readPath[K, V]{buffers: make([]readBuffer[K, V], stripes)}
+	for key, pqi := range lru.index {
+		rp.index.Store(key, &readEntry[K, V]{expiration: pqi.expiration, value: pqi.value, item: pqi})
+	}
+	lru.readPath.Store(rp)
+}
+
+// publish makes the current state of an item visible to lock-free readers.
+// This is NOT thread safe and should always be called with a write lock
+func (lru *LazyLRU[K, V]) publish(pqi *item[K, V]) {
+	if rp := lru.readPath.Load(); rp != nil {
+		rp.index.Store(pqi.key, &readEntry[K, V]{expiration: pqi.expiration, value: pqi.value, item: pqi})
+	}
+}
+
+// unindex removes a key from the index and from the lock-free index. This is
+// NOT thread safe and should always be called with a write lock
+func (lru *LazyLRU[K, V]) unindex(key K) {
+	if lru.budget != nil || lru.weigh != nil {
+		if pqi, ok := lru.index[key]; ok {
+			lru.countBudget(-1)
+			lru.addWeight(pqi.value, -1)
+		}
+	}
+	delete(lru.index, key)
+	if rp := lru.readPath.Load(); rp != nil {
+		rp.index.Delete(key)
+	}
+}
+
+// getLockFree reads from the lock-free index. Expired items need to be removed
+// under the lock, so they are left for the regular read path, as indicated by
+// done being false.
+func (lru *LazyLRU[K, V]) getLockFree(rp *readPath[K, V], key K) (value V, ok bool, done bool) {
+	v, found := rp.index.Load(key)
+	if !found {
+		atomic.AddUint32(&lru.stats.KeysReadNotFound, 1)
+		return value, false, true
+	}
+	entry := v.(*readEntry[K, V])
+	if entry.expiration.Before(time.Now()) {
+		return value, false, false
+	}
+	if lru.lfu {
+		atomic.AddUint32(&entry.item.hits, 1)
+	}
+	lru.recordAccess(rp, entry.item)
+	atomic.AddUint32(&lru.stats.KeysReadOK, 1)
+	return entry.value, true, true
+}
+
+// recordAccess adds an item to a randomly-chosen read buffer, draining the
+// buffers if that one is full and nobody else is holding the lock. The reader
+// that fills a buffer may find the lock taken, so readers that find it already
+// full try again; otherwise the buffer could stay full until the next write.
+func (lru *LazyLRU[K, V]) recordAccess(rp *readPath[K, V], pqi *item[K, V]) {
+	buf := &rp.buffers[rand.IntN(len(rp.buffers))] //nolint:gosec
+	slot := buf.n.Add(1) - 1
+	if slot >= readBufferSize {
+		atomic.AddUint32(&lru.stats.ReadBufferDrops, 1)
+		if lru.lock.TryLock() {
+			lru.drainReadsLocked()
+			lru.lock.Unlock()
+		}
+		return
+	}
+	buf.slots[slot].Store(pqi)
+	if slot == readBufferSize-1 && lru.lock.TryLock() {
+		lru.drainReadsLocked()
+		lru.lock.Unlock()
+	}
+}
+
+// drainReadsLocked applies all of the recorded accesses to the queue. This is
+// NOT thread safe and should always be called with a write lock
+func (lru *LazyLRU[K, V]) drainReadsLocked() {
+	rp := lru.readPath.Load()
+	if rp == nil {
+		return
+	}
+	for i := range rp.buffers {
+		buf := &rp.buffers[i]
+		n := min(buf.n.Load(), readBufferSize)
+		if n == 0 {
+			continue
+		}
+		for s := uint32(0); s < n; s++ {
+			// A reader may have claimed a slot but not filled it yet, or may
+			// fill it after we reset the count. Either way, the access is
+			// lost or applied late, which is fine for an approximate LRU.
+			pqi := buf.slots[s].Swap(nil)
+			if pqi != nil && lru.index[pqi.key] == pqi && lru.shouldBubble(pqi.index) {
+				lru.bubble(pqi)
+			}
+		}
+		buf.n.Store(0)
+		lru.stats.ReadBufferDrains++
+	}
+}
@@ -0,0 +1,112 @@
+package lazylru_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadBuffersGetSet(t *testing.T) {
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	defer lru.Close()
+	lru.Set("existing", 1)
+	lru.UseReadBuffers(2)
+
+	v, ok := lru.Get("existing")
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+
+	lru.Set("existing", 2)
+	lru.Set("new", 3)
+	v, ok = lru.Get("existing")
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+	require.Equal(t, map[string]int{"existing": 2, "new": 3}, lru.MGet("existing", "new", "missing"))
+
+	lru.Delete("new")
+	_, ok = lru.Get("new")
+	require.False(t, ok)
+
+	stats := lru.Stats()
+	require.Equal(t, uint32(4), stats.KeysReadOK)
+	require.Equal(t, uint32(2), stats.KeysReadNotFound)
+}
+
+func TestReadBuffersEviction(t *testing.T) {
+	lru := lazylru.NewT[int, int](10, time.Hour)
+	defer lru.Close()
+	lru.UseReadBuffers(1)
+	for i := 0; i < 20; i++ {
+		lru.Set(i, i)
+	}
+	for i := 0; i < 10; i++ {
+		_, ok := lru.Get(i)
+		require.False(t, ok, "evicted items should not be visible without a lock")
+	}
+	for i := 10; i < 20; i++ {
+		_, ok := lru.Get(i)
+		require.True(t, ok)
+	}
+}
+
+func TestReadBuffersExpired(t *testing.T) {
+	lru := lazylru.NewT[int, int](10, time.Hour)
+	defer lru.Close()
+	lru.UseReadBuffers(1)
+	lru.SetTTL(1, 1, -time.Second)
+	_, ok := lru.Get(1)
+	require.False(t, ok)
+	require.Equal(t, 0, lru.Len())
+	require.Equal(t, uint32(1), lru.Stats().KeysReadExpired)
+}
+
+func TestReadBuffersBubble(t *testing.T) {
+	lru := lazylru.NewT[int, int](20, time.Hour)
+	defer lru.Close()
+	lru.UseReadBuffers(1)
+	for i := 0; i < 20; i++ {
+		lru.Set(i, i)
+	}
+	// reading the oldest item fills the buffer, which gets drained
+	for i := 0; i < 16; i++ {
+		_, ok := lru.Get(0)
+		require.True(t, ok)
+	}
+	stats := lru.Stats()
+	require.Equal(t, uint32(1), stats.ReadBufferDrains)
+	require.Equal(t, uint32(1), stats.Shuffles)
+
+	// so it survives the next write
+	lru.Set(20, 20)
+	_, ok := lru.Get(0)
+	require.True(t, ok)
+	_, ok = lru.Get(1)
+	require.False(t, ok)
+}
+
+func TestReadBuffersRace(t *testing.T) {
+	lru := lazylru.NewT[string, int](100, time.Hour)
+	defer lru.Close()
+	lru.UseReadBuffers(4)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := strconv.Itoa(i % 150)
+				if g%4 == 0 {
+					lru.Set(key, i)
+				} else if v, ok := lru.Get(key); ok && v%150 != i%150 {
+					t.Errorf("wrong value %d for key %s", v, key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	require.LessOrEqual(t, lru.Len(), 100)
+}
@@ -0,0 +1,86 @@
+package sharded_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TriggerMail/lazylru/sharded"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudgetSkewedKeys(t *testing.T) {
+	// every key goes to the same shard
+	skewed := func(string) uint64 { return 0 }
+	perShard := sharded.NewT[string, int](25, time.Hour, 4, skewed)
+	defer perShard.Close()
+	budgeted := sharded.NewWithBudget[string, int](100, time.Hour, 4, skewed)
+	defer budgeted.Close()
+	for i := 0; i < 200; i++ {
+		perShard.Set(strconv.Itoa(i), i)
+		budgeted.Set(strconv.Itoa(i), i)
+	}
+	require.Equal(t, 25, perShard.Len())
+	require.Equal(t, 100, budgeted.Len())
+
+	// the newest items are the ones kept
+	for i := 100; i < 200; i++ {
+		v, ok := budgeted.Get(strconv.Itoa(i))
+		require.True(t, ok)
+		require.Equal(t, i, v)
+	}
+	require.Equal(t, uint32(100), budgeted.Stats().Evictions)
+}
+
+func TestBudgetEvictsAcrossShards(t *testing.T) {
+	lru := sharded.NewWithBudget[string, int](50, time.Hour, 4, sharded.StringSharder)
+	defer lru.Close()
+	for i := 0; i < 50; i++ {
+		lru.Set(strconv.Itoa(i), i)
+	}
+	// each new key pushes out the oldest, whichever shard it is in
+	for i := 50; i < 60; i++ {
+		lru.Set(strconv.Itoa(i), i)
+		_, ok := lru.Get(strconv.Itoa(i - 50))
+		require.False(t, ok, i-50)
+		require.Equal(t, 50, lru.Len())
+	}
+}
+
+func TestBudgetReshard(t *testing.T) {
+	lru := sharded.NewWithBudget[string, int](100, time.Hour, 4, sharded.StringSharder)
+	defer lru.Close()
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				lru.Set(strconv.Itoa(g*1000+i), i)
+			}
+		}(g)
+	}
+	require.NoError(t, lru.Reshard(7))
+	require.NoError(t, lru.Reshard(2))
+	wg.Wait()
+	require.Equal(t, 100, lru.Len())
+}
+
+func TestConsistentWithBudget(t *testing.T) {
+	lru := sharded.NewConsistentWithBudget[string, int](100, time.Hour, 4, sharded.StringSharder)
+	defer lru.Close()
+	for i := 0; i < 200; i++ {
+		lru.Set(strconv.Itoa(i), i)
+	}
+	require.Equal(t, 100, lru.Len())
+
+	// growing moves only the keys the new shards take, and keeps them all
+	require.NoError(t, lru.Reshard(5))
+	require.Equal(t, 100, lru.Len())
+	for i := 100; i < 200; i++ {
+		v, ok := lru.Get(strconv.Itoa(i))
+		require.True(t, ok)
+		require.Equal(t, i, v)
+	}
+}
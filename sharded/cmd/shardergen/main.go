@@ -0,0 +1,276 @@
+// Shardergen writes sharder functions for composite key types, so that they
+// can be used with sharded.NewT without writing a HashingSharder by hand or
+// paying for reflection. Given
+//
+//	//go:generate go run github.com/TriggerMail/lazylru/sharded/cmd/shardergen -type=Key
+//
+// in a package that declares the struct type Key, go generate writes
+// key_sharder.go, which declares KeySharder, a func(Key) uint64 that writes
+// each field of a key to a sharded.H.
+//
+// Fields may be booleans, numbers, strings, time.Time, netip.Addr, arrays of
+// any of these, structs whose fields are all any of these, or types with a
+// Hash(sharded.H) method. Keys that are == hash the same: negative zero is
+// written as zero, and blank fields are skipped. Times are hashed by instant,
+// and so are the same for times that are Equal.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// shardedPath is the import path of the package that declares H
+const shardedPath = "github.com/TriggerMail/lazylru/sharded"
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of key type names; must be set")
+	output    = flag.String("output", "", "output file name; default srcdir/<type>_sharder.go")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of shardergen:\n")
+	fmt.Fprintf(os.Stderr, "\tshardergen -type T [directory]\n")
+	fmt.Fprintf(os.Stderr, "Flags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("shardergen: ")
+	flag.Usage = usage
+	flag.Parse()
+	if *typeNames == "" || flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+	names := strings.Split(*typeNames, ",")
+	outputName := *output
+	if outputName == "" {
+		outputName = filepath.Join(dir, strings.ToLower(names[0])+"_sharder.go")
+	}
+
+	src, err := generate(dir, names, filepath.Base(outputName), strings.Join(os.Args[1:], " "))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(outputName, src, 0o644); err != nil {
+		log.Fatalf("writing output: %v", err)
+	}
+}
+
+// generate returns the formatted source of sharders for the named types in the
+// package in dir. The file named skip, which is usually the output of an
+// earlier run, is left out of the package so that it can't get in the way.
+func generate(dir string, names []string, skip string, args string) ([]byte, error) {
+	pkg, err := loadPackage(dir, skip)
+	if err != nil {
+		return nil, err
+	}
+	g := generator{pkg: pkg}
+	for _, name := range names {
+		if err := g.sharder(name); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by \"shardergen %s\"; DO NOT EDIT.\n\n", args)
+	fmt.Fprintf(&buf, "package %s\n\n", pkg.Name())
+	fmt.Fprintf(&buf, "import %q\n", shardedPath)
+	buf.Write(g.buf.Bytes())
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting output: %w", err)
+	}
+	return src, nil
+}
+
+// loadPackage parses and type-checks the non-test Go files in dir. Type errors
+// are ignored, since the package may not build until its sharders have been
+// generated; the key types only need to be resolved.
+func loadPackage(dir string, skip string) (*types.Package, error) {
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		if name == skip {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(error) {},
+	}
+	pkg, _ := conf.Check(bp.ImportPath, fset, files, nil)
+	return pkg, nil
+}
+
+// generator accumulates the sharders for a package
+type generator struct {
+	pkg *types.Package
+	buf bytes.Buffer
+}
+
+// sharder writes the sharder for the named type
+func (g *generator) sharder(name string) error {
+	obj, ok := g.pkg.Scope().Lookup(name).(*types.TypeName)
+	if !ok {
+		return fmt.Errorf("no type %s in package %s", name, g.pkg.Name())
+	}
+	hashName := "hash" + strings.ToUpper(name[:1]) + name[1:]
+	fmt.Fprintf(&g.buf, "\n// %sSharder shards %s keys. It can be passed to sharded.NewT.\n", name, name)
+	fmt.Fprintf(&g.buf, "var %sSharder = sharded.HashingSharder(%s)\n\n", name, hashName)
+	fmt.Fprintf(&g.buf, "// %s writes each field of a %s to h\n", hashName, name)
+	fmt.Fprintf(&g.buf, "func %s(k %s, h sharded.H) {\n", hashName, name)
+	if err := g.write("k", obj.Type(), 0); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	fmt.Fprintf(&g.buf, "}\n")
+	return nil
+}
+
+// basicWriters maps the kinds of basic types to the H method that writes them
+// and the type that method takes
+var basicWriters = map[types.BasicKind]struct {
+	method string
+	arg    types.BasicKind
+}{
+	types.Bool:       {"WriteBool", types.Bool},
+	types.Int:        {"WriteInt64", types.Int64},
+	types.Int8:       {"WriteInt8", types.Int8},
+	types.Int16:      {"WriteInt16", types.Int16},
+	types.Int32:      {"WriteInt32", types.Int32},
+	types.Int64:      {"WriteInt64", types.Int64},
+	types.Uint:       {"WriteUint64", types.Uint64},
+	types.Uint8:      {"WriteUint8", types.Uint8},
+	types.Uint16:     {"WriteUint16", types.Uint16},
+	types.Uint32:     {"WriteUint32", types.Uint32},
+	types.Uint64:     {"WriteUint64", types.Uint64},
+	types.Uintptr:    {"WriteUint64", types.Uint64},
+	types.Float32:    {"WriteFloat32", types.Float32},
+	types.Float64:    {"WriteFloat64", types.Float64},
+	types.Complex64:  {"WriteComplex64", types.Complex64},
+	types.Complex128: {"WriteComplex128", types.Complex128},
+}
+
+// write writes the code to hash expr, which has type t. depth is the number of
+// loops the code is nested in, to keep their index variables apart.
+func (g *generator) write(expr string, t types.Type, depth int) error {
+	if isHashable(t) {
+		fmt.Fprintf(&g.buf, "%s.Hash(h)\n", expr)
+		return nil
+	}
+	if isNamed(t, "time", "Time") {
+		fmt.Fprintf(&g.buf, "h.WriteTime(%s)\n", expr)
+		return nil
+	}
+	if isNamed(t, "net/netip", "Addr") {
+		fmt.Fprintf(&g.buf, "h.WriteAddr(%s)\n", expr)
+		return nil
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		if u.Info()&types.IsString != 0 {
+			fmt.Fprintf(&g.buf, "h.WriteUint64(uint64(len(%s)))\n", expr)
+			fmt.Fprintf(&g.buf, "_, _ = h.WriteString(%s)\n", convert(expr, t, types.Typ[types.String]))
+			return nil
+		}
+		w, ok := basicWriters[u.Kind()]
+		if !ok {
+			return fmt.Errorf("%s: unsupported type %s", expr, t)
+		}
+		arg := convert(expr, t, types.Typ[w.arg])
+		if u.Info()&(types.IsFloat|types.IsComplex) != 0 {
+			// adding zero turns negative zero into zero, since they are ==
+			arg += " + 0"
+		}
+		fmt.Fprintf(&g.buf, "h.%s(%s)\n", w.method, arg)
+		return nil
+
+	case *types.Array:
+		if u.Len() == 16 && types.Identical(u.Elem(), types.Typ[types.Byte]) {
+			fmt.Fprintf(&g.buf, "h.WriteUUID(%s)\n", convert(expr, t, types.NewArray(u.Elem(), 16)))
+			return nil
+		}
+		// other byte arrays are written a byte at a time: slicing the key to
+		// pass to Write would move it to the heap
+		ix := fmt.Sprintf("i%d", depth)
+		fmt.Fprintf(&g.buf, "for %s := range %s {\n", ix, expr)
+		if err := g.write(fmt.Sprintf("%s[%s]", expr, ix), u.Elem(), depth+1); err != nil {
+			return err
+		}
+		fmt.Fprintf(&g.buf, "}\n")
+		return nil
+
+	case *types.Struct:
+		for i := range u.NumFields() {
+			f := u.Field(i)
+			if f.Name() == "_" {
+				continue
+			}
+			if !f.Exported() && f.Pkg() != g.pkg {
+				return fmt.Errorf("%s: field %s of %s is not exported", expr, f.Name(), t)
+			}
+			if err := g.write(expr+"."+f.Name(), f.Type(), depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%s: unsupported type %s", expr, t)
+}
+
+// convert returns expr converted to the type to, if it isn't already
+func convert(expr string, t types.Type, to types.Type) string {
+	if types.Identical(t, to) {
+		return expr
+	}
+	// byte reads better than uint8 in [16]byte
+	return strings.ReplaceAll(types.TypeString(to, nil), "uint8", "byte") + "(" + expr + ")"
+}
+
+// isHashable reports whether t has a Hash(sharded.H) method
+func isHashable(t types.Type) bool {
+	if _, ok := t.(*types.Named); !ok {
+		return false
+	}
+	sel := types.NewMethodSet(types.NewPointer(t)).Lookup(nil, "Hash")
+	if sel == nil {
+		return false
+	}
+	sig := sel.Type().(*types.Signature)
+	return sig.Params().Len() == 1 && sig.Results().Len() == 0 &&
+		isNamed(sig.Params().At(0).Type(), shardedPath, "H")
+}
+
+// isNamed reports whether t is the type name declared in the package at path
+func isNamed(t types.Type, path, name string) bool {
+	n, ok := t.(*types.Named)
+	return ok && n.Obj().Pkg() != nil && n.Obj().Pkg().Path() == path && n.Obj().Name() == name
+}
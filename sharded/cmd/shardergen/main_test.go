@@ -0,0 +1,46 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	src, err := generate("testdata/keys", []string{"Key", "Point"}, "key_sharder.go", "-type=Key,Point")
+	require.NoError(t, err)
+
+	golden, err := os.ReadFile("testdata/keys/key_sharder.go.golden")
+	require.NoError(t, err)
+	require.Equal(t, string(golden), string(src))
+
+	// the package must build with the generated file
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range []string{"testdata/keys/keys.go", "testdata/keys/key_sharder.go.golden"} {
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		require.NoError(t, err)
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	_, err = conf.Check("keys", fset, files, nil)
+	require.NoError(t, err)
+}
+
+func TestGenerateErrors(t *testing.T) {
+	_, err := generate("testdata/keys", []string{"Missing"}, "", "")
+	require.ErrorContains(t, err, "no type Missing")
+
+	_, err = generate("testdata/keys", []string{"bad"}, "", "")
+	require.ErrorContains(t, err, "k.next: unsupported type")
+
+	_, err = generate(filepath.Join("testdata", "nothing here"), []string{"Key"}, "", "")
+	require.Error(t, err)
+}
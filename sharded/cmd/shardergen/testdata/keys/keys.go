@@ -0,0 +1,45 @@
+// Package keys declares key types for the shardergen tests
+package keys
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/TriggerMail/lazylru/sharded"
+)
+
+type UUID [16]byte
+
+type Celsius float64
+
+type Point struct{ X, Y int32 }
+
+func (p Point) Hash(h sharded.H) {
+	h.WriteInt32(p.X)
+	h.WriteInt32(p.Y)
+}
+
+type inner struct {
+	name  string
+	flags [4]bool
+}
+
+type Key struct {
+	ID      int
+	Tenant  string
+	Session UUID
+	When    time.Time
+	From    netip.Addr
+	Temp    Celsius
+	Z       complex64
+	Where   Point
+	Digest  [8]byte
+	_       int
+	in      inner
+	Grid    [2][3]uint16
+}
+
+type bad struct {
+	name string
+	next *bad
+}
@@ -0,0 +1,94 @@
+package sharded
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// valueWriter writes a value of one particular type to a hasher
+type valueWriter func(h H, v reflect.Value)
+
+// reflectSharder derives a sharder for K from its type, for toolchains that do
+// not have maphash.Comparable. It panics if K holds anything other than
+// booleans, numbers, strings, and arrays and structs of those.
+func reflectSharder[K comparable]() func(K) uint64 {
+	w, err := writerFor(reflect.TypeFor[K]())
+	if err != nil {
+		panic(err)
+	}
+	return HashingSharder(func(key K, h H) {
+		w(h, reflect.ValueOf(&key).Elem())
+	})
+}
+
+// writerFor builds a valueWriter for t. Values that are == must be written the
+// same way, so negative zero is written as zero, and blank struct fields, which
+// == ignores, are skipped. Strings are written with their lengths so that
+// neighboring strings can't run together.
+func writerFor(t reflect.Type) (valueWriter, error) {
+	switch t.Kind() {
+	case reflect.Bool:
+		return func(h H, v reflect.Value) { h.WriteBool(v.Bool()) }, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(h H, v reflect.Value) { h.WriteUint64(uint64(v.Int())) }, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return func(h H, v reflect.Value) { h.WriteUint64(v.Uint()) }, nil
+	case reflect.Float32, reflect.Float64:
+		return func(h H, v reflect.Value) {
+			f := v.Float()
+			if f == 0 {
+				f = 0
+			}
+			h.WriteFloat64(f)
+		}, nil
+	case reflect.Complex64, reflect.Complex128:
+		return func(h H, v reflect.Value) {
+			c := v.Complex()
+			re, im := real(c), imag(c)
+			if re == 0 {
+				re = 0
+			}
+			if im == 0 {
+				im = 0
+			}
+			h.WriteFloat64(re)
+			h.WriteFloat64(im)
+		}, nil
+	case reflect.String:
+		return func(h H, v reflect.Value) {
+			s := v.String()
+			h.WriteUint64(uint64(len(s)))
+			_, _ = h.WriteString(s)
+		}, nil
+	case reflect.Array:
+		elem, err := writerFor(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return func(h H, v reflect.Value) {
+			for i := range v.Len() {
+				elem(h, v.Index(i))
+			}
+		}, nil
+	case reflect.Struct:
+		var fields []int
+		var writers []valueWriter
+		for i := range t.NumField() {
+			if t.Field(i).Name == "_" {
+				continue
+			}
+			w, err := writerFor(t.Field(i).Type)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, i)
+			writers = append(writers, w)
+		}
+		return func(h H, v reflect.Value) {
+			for i, w := range writers {
+				w(h, v.Field(fields[i]))
+			}
+		}, nil
+	}
+	return nil, fmt.Errorf("sharded: cannot derive a sharder for keys of type %v", t)
+}
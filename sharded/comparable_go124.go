@@ -0,0 +1,23 @@
+//go:build go1.24
+
+package sharded
+
+import "hash/maphash"
+
+// comparableSeed is shared by every ComparableSharder so that their hashes are
+// the same for the life of the process
+var comparableSeed = maphash.MakeSeed()
+
+// ComparableSharder returns a sharder for any comparable key type, hashing keys
+// with maphash.Comparable. Keys that are == always hash the same, so pointers,
+// channels, and interfaces hash by identity, just as they would as map keys.
+// Hashes are seeded randomly, so they differ from one process to the next.
+//
+// Before Go 1.24, the sharder is derived from the key type with reflection
+// instead. It is slower, and only booleans, numbers, strings, and arrays and
+// structs of those are supported; ComparableSharder panics for other types.
+func ComparableSharder[K comparable]() func(K) uint64 {
+	return func(key K) uint64 {
+		return maphash.Comparable(comparableSeed, key)
+	}
+}
@@ -0,0 +1,61 @@
+package sharded
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReflectSharder(t *testing.T) {
+	type inner struct {
+		f float64
+		b bool
+	}
+	type key struct {
+		s   [2]string
+		n   int8
+		u   uint
+		_   int
+		in  inner
+		f32 float32
+	}
+
+	sharder := reflectSharder[key]()
+	k := key{s: [2]string{"a", "bc"}, n: -1, u: 7, in: inner{1.5, true}, f32: 2}
+	require.Equal(t, sharder(k), sharder(k))
+
+	// keys that are == hash the same
+	negZero := k
+	negZero.in.f = math.Copysign(0, -1)
+	posZero := k
+	posZero.in.f = 0
+	require.Equal(t, posZero, negZero)
+	require.Equal(t, sharder(posZero), sharder(negZero))
+
+	// strings don't run together
+	moved := k
+	moved.s = [2]string{"ab", "c"}
+	require.NotEqual(t, sharder(k), sharder(moved))
+
+	for _, change := range []func(*key){
+		func(k *key) { k.n = 1 },
+		func(k *key) { k.u = 8 },
+		func(k *key) { k.in.b = false },
+		func(k *key) { k.f32 = 3 },
+	} {
+		k2 := k
+		change(&k2)
+		require.NotEqual(t, sharder(k), sharder(k2))
+	}
+}
+
+func TestReflectSharderUnsupported(t *testing.T) {
+	type withPointer struct {
+		name string
+		p    *int
+	}
+	require.Panics(t, func() { reflectSharder[withPointer]() })
+	require.Panics(t, func() { reflectSharder[any]() })
+	require.NotPanics(t, func() { reflectSharder[[4]uint16]() })
+}
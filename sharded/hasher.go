@@ -3,7 +3,9 @@ package sharded
 import (
 	"encoding/binary"
 	"math"
+	"net/netip"
 	"sync"
+	"time"
 
 	"github.com/zeebo/xxh3"
 )
@@ -76,3 +78,53 @@ func (h *hasher) WriteBool(v bool) {
 	}
 	h.WriteUint8(b)
 }
+
+func (h *hasher) WriteInt64(v int64) {
+	h.WriteUint64(uint64(v))
+}
+
+func (h *hasher) WriteInt32(v int32) {
+	h.WriteUint32(uint32(v))
+}
+
+func (h *hasher) WriteInt16(v int16) {
+	h.WriteUint16(uint16(v))
+}
+
+func (h *hasher) WriteInt8(v int8) {
+	h.WriteUint8(uint8(v))
+}
+
+func (h *hasher) WriteComplex64(v complex64) {
+	h.WriteFloat32(real(v))
+	h.WriteFloat32(imag(v))
+}
+
+func (h *hasher) WriteComplex128(v complex128) {
+	h.WriteFloat64(real(v))
+	h.WriteFloat64(imag(v))
+}
+
+func (h *hasher) WriteTime(v time.Time) {
+	h.WriteUint64(uint64(v.Unix()))
+	h.WriteUint32(uint32(v.Nanosecond()))
+}
+
+func (h *hasher) WriteUUID(v [16]byte) {
+	_, _ = h.Write(v[:])
+}
+
+func (h *hasher) WriteAddr(v netip.Addr) {
+	// the bit length tells an IPv4 address from the same address mapped into
+	// IPv6, which are not ==
+	b := v.As16()
+	_, _ = h.Write(b[:])
+	h.WriteUint8(uint8(v.BitLen()))
+	zone := v.Zone()
+	h.WriteUint64(uint64(len(zone)))
+	_, _ = h.WriteString(zone)
+}
+
+func (h *hasher) WriteHashable(v Hashable) {
+	v.Hash(h)
+}
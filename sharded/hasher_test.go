@@ -1,7 +1,9 @@
 package sharded
 
 import (
+	"net/netip"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/zeebo/xxh3"
@@ -129,3 +131,146 @@ func TestBool(t *testing.T) {
 	require.Equal(t, v1, v2)
 	require.NotEqual(t, v1, v3)
 }
+
+func TestInt8(t *testing.T) {
+	h := (*hasher)(xxh3.New())
+	h.WriteInt8(-1)
+	v1 := h.Sum64()
+	h.Reset()
+	h.WriteInt8(-1)
+	v2 := h.Sum64()
+	h.WriteInt8(-1)
+	v3 := h.Sum64()
+	require.Equal(t, v1, v2)
+	require.NotEqual(t, v1, v3)
+}
+
+func TestInt16(t *testing.T) {
+	h := (*hasher)(xxh3.New())
+	h.WriteInt16(-1)
+	v1 := h.Sum64()
+	h.Reset()
+	h.WriteInt16(-1)
+	v2 := h.Sum64()
+	h.WriteInt16(-1)
+	v3 := h.Sum64()
+	require.Equal(t, v1, v2)
+	require.NotEqual(t, v1, v3)
+}
+
+func TestInt32(t *testing.T) {
+	h := (*hasher)(xxh3.New())
+	h.WriteInt32(-1)
+	v1 := h.Sum64()
+	h.Reset()
+	h.WriteInt32(-1)
+	v2 := h.Sum64()
+	h.WriteInt32(-1)
+	v3 := h.Sum64()
+	require.Equal(t, v1, v2)
+	require.NotEqual(t, v1, v3)
+}
+
+func TestInt64(t *testing.T) {
+	h := (*hasher)(xxh3.New())
+	h.WriteInt64(-1)
+	v1 := h.Sum64()
+	h.Reset()
+	h.WriteInt64(-1)
+	v2 := h.Sum64()
+	h.WriteInt64(-1)
+	v3 := h.Sum64()
+	require.Equal(t, v1, v2)
+	require.NotEqual(t, v1, v3)
+}
+
+func TestComplex64(t *testing.T) {
+	h := (*hasher)(xxh3.New())
+	h.WriteComplex64(1 + 2i)
+	v1 := h.Sum64()
+	h.Reset()
+	h.WriteComplex64(1 + 2i)
+	v2 := h.Sum64()
+	h.WriteComplex64(1 + 2i)
+	v3 := h.Sum64()
+	require.Equal(t, v1, v2)
+	require.NotEqual(t, v1, v3)
+}
+
+func TestComplex128(t *testing.T) {
+	h := (*hasher)(xxh3.New())
+	h.WriteComplex128(1 + 2i)
+	v1 := h.Sum64()
+	h.Reset()
+	h.WriteComplex128(1 + 2i)
+	v2 := h.Sum64()
+	h.WriteComplex128(1 + 2i)
+	v3 := h.Sum64()
+	require.Equal(t, v1, v2)
+	require.NotEqual(t, v1, v3)
+}
+
+func TestUUID(t *testing.T) {
+	h := (*hasher)(xxh3.New())
+	h.WriteUUID([16]byte{1, 2, 3})
+	v1 := h.Sum64()
+	h.Reset()
+	h.WriteUUID([16]byte{1, 2, 3})
+	v2 := h.Sum64()
+	h.WriteUUID([16]byte{1, 2, 3})
+	v3 := h.Sum64()
+	require.Equal(t, v1, v2)
+	require.NotEqual(t, v1, v3)
+}
+
+func TestTime(t *testing.T) {
+	h := (*hasher)(xxh3.New())
+	now := time.Now()
+	h.WriteTime(now)
+	v1 := h.Sum64()
+	h.Reset()
+	// the same instant in another location, without a monotonic reading
+	h.WriteTime(now.In(time.FixedZone("elsewhere", 3600)).Round(0))
+	v2 := h.Sum64()
+	h.Reset()
+	h.WriteTime(now.Add(time.Nanosecond))
+	v3 := h.Sum64()
+	require.Equal(t, v1, v2)
+	require.NotEqual(t, v1, v3)
+}
+
+func TestAddr(t *testing.T) {
+	sum := func(a netip.Addr) uint64 {
+		h := (*hasher)(xxh3.New())
+		h.WriteAddr(a)
+		return h.Sum64()
+	}
+	v4 := netip.MustParseAddr("10.0.0.1")
+	require.Equal(t, sum(v4), sum(netip.MustParseAddr("10.0.0.1")))
+	require.NotEqual(t, sum(v4), sum(netip.MustParseAddr("10.0.0.2")))
+	require.NotEqual(t, sum(v4), sum(netip.AddrFrom16(v4.As16())))
+	require.NotEqual(t, sum(netip.MustParseAddr("fe80::1")), sum(netip.MustParseAddr("fe80::1%eth0")))
+	require.NotEqual(t, sum(netip.Addr{}), sum(netip.IPv6Unspecified()))
+}
+
+type hashablePoint struct{ x, y int32 }
+
+func (p hashablePoint) Hash(h H) {
+	h.WriteInt32(p.x)
+	h.WriteInt32(p.y)
+}
+
+func TestHashable(t *testing.T) {
+	h := (*hasher)(xxh3.New())
+	h.WriteHashable(hashablePoint{1, 2})
+	v1 := h.Sum64()
+	h.Reset()
+	h.WriteInt32(1)
+	h.WriteInt32(2)
+	v2 := h.Sum64()
+	h.Reset()
+	h.WriteHashable(hashablePoint{2, 1})
+	v3 := h.Sum64()
+	require.Equal(t, v1, v2)
+	require.NotEqual(t, v1, v3)
+}
@@ -113,3 +113,117 @@ func Benchmark(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkSetAllocs writes new keys to a full sharded cache, so every write
+// evicts. Evicted items are recycled, so Set should not allocate.
+func BenchmarkSetAllocs(b *testing.B) {
+	const capacity, shards = 1 << 10, 16
+	lru := sharded.NewT[string, int](capacity/shards, time.Minute, shards, sharded.StringSharder)
+	defer lru.Close()
+	for i := 0; i < capacity; i++ {
+		lru.Set(keys[i], i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ix := i % keycnt
+		lru.Set(keys[ix], ix)
+	}
+}
+
+// BenchmarkMSetAllocs writes batches of new keys to a full sharded cache.
+// Evicted items are recycled and the keys are grouped by shard on the stack,
+// so MSet should not allocate.
+func BenchmarkMSetAllocs(b *testing.B) {
+	const capacity, shards, batch = 1 << 10, 16, 32
+	lru := sharded.NewT[string, int](capacity/shards, time.Minute, shards, sharded.StringSharder)
+	defer lru.Close()
+	for i := 0; i < capacity; i++ {
+		lru.Set(keys[i], i)
+	}
+	values := make([]int, batch)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := (i * batch) % (keycnt - batch)
+		if err := lru.MSet(keys[start:start+batch], values); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMGetAllocs compares reading a batch of keys into a new map with
+// reading into reused buffers. Grouping the keys by shard does not allocate.
+func BenchmarkMGetAllocs(b *testing.B) {
+	const capacity, shards, batch = 1 << 10, 16, 32
+	lru := sharded.NewT[string, int](capacity/shards, time.Minute, shards, sharded.StringSharder)
+	defer lru.Close()
+	for i := 0; i < capacity; i++ {
+		lru.Set(keys[i], i)
+	}
+	batchKeys := func(i int) []string {
+		start := (i * batch) % (capacity - batch)
+		return keys[start : start+batch]
+	}
+	b.Run("MGet", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = lru.MGet(batchKeys(i)...)
+		}
+	})
+	b.Run("MGetInto", func(b *testing.B) {
+		dst := make(map[string]int, batch)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			clear(dst)
+			_ = lru.MGetInto(dst, batchKeys(i)...)
+		}
+	})
+	b.Run("MGetSlice", func(b *testing.B) {
+		vals, found := make([]int, batch), make([]bool, batch)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := lru.MGetSlice(batchKeys(i), vals, found); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("MGetSeq", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for range lru.MGetSeq(batchKeys(i)) {
+			}
+		}
+	})
+}
+
+// BenchmarkParallelBatches compares large MGet and MSet batches handled
+// serially with the same batches fanned out across the shards
+func BenchmarkParallelBatches(b *testing.B) {
+	const shards = 16
+	for _, batch := range []int{100, 1000, 10000} {
+		for _, parallel := range []bool{false, true} {
+			lru := sharded.NewT[string, int](keycnt/shards, time.Minute, shards, sharded.StringSharder)
+			if parallel {
+				lru.UseParallelBatches(1, 0)
+			}
+			values := make([]int, batch)
+			name := fmt.Sprintf("batch=%d/parallel=%v", batch, parallel)
+			b.Run("MSet/"+name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					start := (i * batch) % (keycnt - batch)
+					if err := lru.MSet(keys[start:start+batch], values); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.Run("MGet/"+name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					start := (i * batch) % (keycnt - batch)
+					_ = lru.MGet(keys[start : start+batch]...)
+				}
+			})
+			lru.Close()
+		}
+	}
+}
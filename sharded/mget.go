@@ -0,0 +1,113 @@
+package sharded
+
+import (
+	"iter"
+
+	lazylru "github.com/TriggerMail/lazylru"
+)
+
+// groupChunk is the number of keys grouped by shard at a time by MGet and
+// MSet. The grouping is done in arrays on the stack, so it is kept small.
+const groupChunk = 64
+
+// mgetEach reads keys a chunk at a time, sending each chunk to the shards as
+// one batch per shard, and calls emit with the position in keys of each key
+// that is found. emit is never called while a shard is locked. If emit returns
+// false, mgetEach stops. Unlike the keyShardHelper, this does not allocate.
+// While Reshard is moving items, keys are read one at a time instead.
+func (slru *LazyLRU[K, V]) mgetEach(keys []K, emit func(i int, value V) bool) {
+	l := slru.layout.Load()
+	if l.old != nil {
+		for i, key := range keys {
+			if v, ok := slru.Get(key); ok && !emit(i, v) {
+				return
+			}
+		}
+		return
+	}
+	var (
+		shardIxs [groupChunk]int
+		taken    [groupChunk]bool
+		skeys    [groupChunk]K
+		spos     [groupChunk]int
+		svals    [groupChunk]V
+		sfound   [groupChunk]bool
+	)
+	for start := 0; start < len(keys); start += groupChunk {
+		chunk := keys[start:min(start+groupChunk, len(keys))]
+		for i, key := range chunk {
+			shardIxs[i] = l.ix(slru.sharder(key))
+			taken[i] = false
+		}
+		for i := range chunk {
+			if taken[i] {
+				continue
+			}
+			shardIx, n := shardIxs[i], 0
+			for j := i; j < len(chunk); j++ {
+				if !taken[j] && shardIxs[j] == shardIx {
+					taken[j] = true
+					skeys[n], spos[n] = chunk[j], start+j
+					n++
+				}
+			}
+			if _, err := l.shards[shardIx].MGetSlice(skeys[:n], svals[:n], sfound[:n]); err != nil {
+				if !slru.shardRetired(l, err) {
+					continue
+				}
+				clear(sfound[:n])
+			}
+			for j := 0; j < n; j++ {
+				if !sfound[j] && slru.layout.Load() != l {
+					// a reshard may have moved it
+					svals[j], sfound[j] = slru.Get(skeys[j])
+				}
+				if sfound[j] && !emit(spos[j], svals[j]) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// MGetInto retrieves values from the cache, adding them to dst, and returns the
+// number of keys found. See lazylru.LazyLRU.MGetInto.
+func (slru *LazyLRU[K, V]) MGetInto(dst map[K]V, keys ...K) int {
+	found := 0
+	slru.mgetEach(keys, func(i int, v V) bool {
+		dst[keys[i]] = v
+		found++
+		return true
+	})
+	return found
+}
+
+// MGetSlice retrieves values from the cache by position. See
+// lazylru.LazyLRU.MGetSlice.
+func (slru *LazyLRU[K, V]) MGetSlice(keys []K, vals []V, found []bool) (int, error) {
+	if len(vals) < len(keys) || len(found) < len(keys) {
+		return 0, lazylru.ErrShortBuffer
+	}
+	vals, found = vals[:len(keys)], found[:len(keys)]
+	clear(vals)
+	clear(found)
+	n := 0
+	slru.mgetEach(keys, func(i int, v V) bool {
+		vals[i], found[i] = v, true
+		n++
+		return true
+	})
+	return n, nil
+}
+
+// MGetSeq returns an iterator over the keys that are found in the cache and
+// their values. Keys are grouped by shard in small batches, so within a batch
+// the values come in shard order rather than the order of keys. See
+// lazylru.LazyLRU.MGetSeq.
+func (slru *LazyLRU[K, V]) MGetSeq(keys []K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		slru.mgetEach(keys, func(i int, v V) bool {
+			return yield(keys[i], v)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package sharded_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/TriggerMail/lazylru/sharded"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMGetInto(t *testing.T) {
+	doShardedTest(t, 10, time.Hour, 10, sharded.StringSharder, func(t *testing.T, lru *sharded.LazyLRU[string, int]) {
+		lru.Set("a", 1)
+		lru.Set("b", 2)
+		lru.SetTTL("c", 3, 0)
+		dst := map[string]int{"old": 0}
+		require.Equal(t, 2, lru.MGetInto(dst, "a", "b", "c", "d"))
+		require.Equal(t, map[string]int{"old": 0, "a": 1, "b": 2}, dst)
+		require.Equal(t, 2, lru.Len())
+	},
+		ExpectedStats{}.
+			WithKeysWritten(3).
+			WithKeysReadOK(2).
+			WithKeysReadNotFound(1).
+			WithKeysReadExpired(1),
+	)
+}
+
+func TestMGetSlice(t *testing.T) {
+	// more keys than fit in one batch, spread over all the shards
+	keys := make([]string, 200)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	doShardedTest(t, 100, time.Hour, 7, sharded.StringSharder, func(t *testing.T, lru *sharded.LazyLRU[string, int]) {
+		for i := 0; i < len(keys); i += 3 {
+			lru.Set(keys[i], i)
+		}
+		vals := make([]int, len(keys))
+		found := make([]bool, len(keys))
+		n, err := lru.MGetSlice(keys, vals, found)
+		require.NoError(t, err)
+		require.Equal(t, 67, n)
+		for i := range keys {
+			require.Equal(t, i%3 == 0, found[i], i)
+			if found[i] {
+				require.Equal(t, i, vals[i])
+			} else {
+				require.Equal(t, 0, vals[i])
+			}
+		}
+
+		_, err = lru.MGetSlice(keys, vals[:1], found)
+		require.ErrorIs(t, err, lazylru.ErrShortBuffer)
+	},
+		ExpectedStats{}.
+			WithKeysWritten(67).
+			WithKeysReadOK(67).
+			WithKeysReadNotFound(133),
+	)
+}
+
+func TestMGetSeq(t *testing.T) {
+	keys := make([]string, 200)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	doShardedTest(t, 200, time.Hour, 7, sharded.StringSharder, func(t *testing.T, lru *sharded.LazyLRU[string, int]) {
+		for i := 0; i < len(keys); i += 2 {
+			lru.Set(keys[i], i)
+		}
+		got := map[string]int{}
+		for k, v := range lru.MGetSeq(keys) {
+			got[k] = v
+		}
+		require.Len(t, got, 100)
+		for k, v := range got {
+			require.Equal(t, k, strconv.Itoa(v))
+		}
+
+		n := 0
+		for range lru.MGetSeq(keys) {
+			n++
+			if n == 5 {
+				break
+			}
+		}
+		require.Equal(t, 5, n)
+	},
+		ExpectedStats{}.
+			WithKeysWritten(100),
+	)
+}
+
+func TestMSetChunks(t *testing.T) {
+	doShardedTest(t, 100, time.Hour, 10, sharded.StringSharder, func(t *testing.T, lru *sharded.LazyLRU[string, int]) {
+		// enough keys to be grouped in several chunks, with a repeat at the end
+		keys := make([]string, 0, 201)
+		values := make([]int, 0, 201)
+		for i := 0; i < 200; i++ {
+			keys = append(keys, strconv.Itoa(i))
+			values = append(values, i)
+		}
+		keys, values = append(keys, "0"), append(values, -1)
+		require.NoError(t, lru.MSet(keys, values))
+		require.Equal(t, 200, lru.Len())
+		for i := 1; i < 200; i++ {
+			v, ok := lru.Get(strconv.Itoa(i))
+			require.True(t, ok, i)
+			require.Equal(t, i, v)
+		}
+		v, ok := lru.Get("0")
+		require.True(t, ok)
+		require.Equal(t, -1, v)
+	},
+		ExpectedStats{}.
+			WithKeysWritten(201).
+			WithKeysReadOK(200),
+	)
+}
@@ -0,0 +1,105 @@
+package sharded
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// parallelConfig controls when batch operations fan out across shards
+type parallelConfig struct {
+	minBatch int
+	workers  int
+}
+
+// UseParallelBatches makes MGet, MGetCtx, MSet, and MSetTTL send their shard
+// groups to the shards concurrently when a batch has at least minBatch keys,
+// using at most workers goroutines at a time. Smaller batches are handled
+// serially, because starting goroutines costs more than it saves until the
+// batch is large. If workers is not positive, GOMAXPROCS is used. If minBatch
+// is not positive, batches are always handled serially, which is the default.
+// This is safe to call at any time.
+func (slru *LazyLRU[K, V]) UseParallelBatches(minBatch, workers int) {
+	if minBatch <= 0 {
+		slru.parallel.Store(nil)
+		return
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	slru.parallel.Store(&parallelConfig{minBatch: minBatch, workers: workers})
+}
+
+// parallelFor returns the parallel settings if a batch of n keys should fan out
+// across the shards in l, or nil if it should be handled serially. While
+// Reshard is moving items, batches are never fanned out.
+func (slru *LazyLRU[K, V]) parallelFor(l *shardLayout[K, V], n int) *parallelConfig {
+	cfg := slru.parallel.Load()
+	if cfg == nil || n < cfg.minBatch || cfg.workers < 2 || l.old != nil || len(l.shards) < 2 {
+		return nil
+	}
+	return cfg
+}
+
+// mgetParallel reads each shard's keys in its own goroutine and merges the
+// results once every shard is done
+func (slru *LazyLRU[K, V]) mgetParallel(ctx context.Context, l *shardLayout[K, V], keys []K, cfg *parallelConfig) (map[K]V, error) {
+	type group struct {
+		shardIx int
+		keys    []K
+		vals    map[K]V
+	}
+	var groups []group
+	shardMapper := newKeyShardHelper(keys, func(key K) int { return l.ix(slru.sharder(key)) })
+	for {
+		shardIx, skeys := shardMapper.TakeGroup()
+		if shardIx < 0 {
+			break
+		}
+		groups = append(groups, group{shardIx: shardIx, keys: skeys})
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(cfg.workers)
+	for i := range groups {
+		g.Go(func() error {
+			vals, err := l.shards[groups[i].shardIx].MGetCtx(gctx, groups[i].keys...)
+			if slru.shardRetired(l, err) {
+				return nil
+			}
+			groups[i].vals = vals
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	retval := make(map[K]V, len(keys))
+	for _, grp := range groups {
+		for k, v := range grp.vals {
+			retval[k] = v
+		}
+	}
+	return retval, slru.relookup(ctx, l, keys, retval)
+}
+
+// msetParallel writes each shard's keys in its own goroutine, returning the
+// first error once every shard is done
+func (slru *LazyLRU[K, V]) msetParallel(l *shardLayout[K, V], keys []K, values []V, ttl time.Duration, cfg *parallelConfig) error {
+	var g errgroup.Group
+	g.SetLimit(cfg.workers)
+	shardMapper := newKVShardHelper(keys, values, func(key K) int { return l.ix(slru.sharder(key)) })
+	for {
+		shardIx, skeys, svals := shardMapper.TakeGroup()
+		if shardIx < 0 {
+			break
+		}
+		g.Go(func() error {
+			return l.shards[shardIx].MSetTTL(skeys, svals, ttl)
+		})
+	}
+	return g.Wait()
+}
@@ -0,0 +1,65 @@
+package sharded_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/TriggerMail/lazylru/sharded"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParallelBatches(t *testing.T) {
+	keys := make([]string, 1000)
+	values := make([]int, len(keys))
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		values[i] = i
+	}
+	doShardedTest(t, 1000, time.Hour, 8, sharded.StringSharder, func(t *testing.T, lru *sharded.LazyLRU[string, int]) {
+		lru.UseParallelBatches(100, 3)
+		require.NoError(t, lru.MSet(keys, values))
+		require.Equal(t, len(keys), lru.Len())
+
+		vals := lru.MGet(append(keys, "missing")...)
+		require.Len(t, vals, len(keys))
+		for i, key := range keys {
+			require.Equal(t, i, vals[key])
+		}
+
+		vals, err := lru.MGetCtx(context.Background(), keys...)
+		require.NoError(t, err)
+		require.Len(t, vals, len(keys))
+
+		// below the threshold, batches are handled serially
+		vals = lru.MGet(keys[:10]...)
+		require.Len(t, vals, 10)
+
+		require.ErrorContains(t, lru.MSet(keys, values[:1]), "Mismatch")
+	},
+		ExpectedStats{}.
+			WithKeysWritten(1000).
+			WithKeysReadOK(2010).
+			WithKeysReadNotFound(1),
+	)
+}
+
+func TestParallelBatchesClosed(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	lru := sharded.NewT[string, int](10, time.Hour, 4, sharded.StringSharder)
+	lru.UseParallelBatches(2, 2)
+	require.NoError(t, lru.MSet(keys, []int{1, 2, 3, 4, 5, 6}))
+	require.Len(t, lru.MGet(keys...), len(keys))
+	require.NoError(t, lru.CloseContext(context.Background()))
+
+	_, err := lru.MGetCtx(context.Background(), keys...)
+	require.ErrorIs(t, err, lazylru.ErrClosed)
+	require.Empty(t, lru.MGet(keys...))
+
+	// turning it off goes back to the serial path, which fails the same way
+	lru.UseParallelBatches(0, 0)
+	_, err = lru.MGetCtx(context.Background(), keys...)
+	require.ErrorIs(t, err, lazylru.ErrClosed)
+}
@@ -0,0 +1,236 @@
+package sharded
+
+import (
+	"context"
+	"errors"
+
+	lazylru "github.com/TriggerMail/lazylru"
+)
+
+// reshardBatch is the number of keys Reshard moves while holding writers off
+const reshardBatch = 256
+
+// errNoShards is returned by Reshard when asked for fewer than one shard
+var errNoShards = errors.New("number of shards must be positive")
+
+// shardLayout is the set of shards in use. While Reshard is moving items, old
+// points at the layout being moved away from, and keys that are not found in
+// their new shard are looked for in their old one.
+type shardLayout[K comparable, V any] struct {
+	shards     []*lazylru.LazyLRU[K, V]
+	old        *shardLayout[K, V]
+	consistent bool
+}
+
+// ix determines the target shard for a hashed key
+func (l *shardLayout[K, V]) ix(hash uint64) int {
+	if l.consistent {
+		return JumpHash(hash, len(l.shards))
+	}
+	return int(hash % uint64(len(l.shards)))
+}
+
+// shard returns the target shard for a hashed key
+func (l *shardLayout[K, V]) shard(hash uint64) *lazylru.LazyLRU[K, V] {
+	return l.shards[l.ix(hash)]
+}
+
+// all returns every shard in the layout, including the ones being moved away
+// from. Shards that are in both are only returned once.
+func (l *shardLayout[K, V]) all() []*lazylru.LazyLRU[K, V] {
+	if l.old == nil || len(l.old.shards) <= len(l.shards) {
+		// shards are only ever added or removed at the end
+		return l.shards
+	}
+	return l.old.shards
+}
+
+// lookup reads a key from its shard. While Reshard is moving items, a key that
+// is not in its new shard is looked for in its old shard, then in its new
+// shard again, because Reshard copies each item to its new shard before
+// deleting it from the old one. If the layout changed during a read that
+// missed, the read is tried again against the new layout, since the item may
+// have moved out from under it.
+func (slru *LazyLRU[K, V]) lookup(key K, get func(s *lazylru.LazyLRU[K, V]) (V, bool, error)) (V, bool, error) {
+	h := slru.sharder(key)
+	l := slru.layout.Load()
+	for {
+		v, ok, err := lookupIn(l, h, get)
+		if ok || err != nil {
+			return v, ok, err
+		}
+		l2 := slru.layout.Load()
+		if l2 == l {
+			return v, false, nil
+		}
+		l = l2
+	}
+}
+
+// lookupIn reads a hashed key from its shard in l, and from its old shard if
+// items are moving
+func lookupIn[K comparable, V any](l *shardLayout[K, V], h uint64, get func(s *lazylru.LazyLRU[K, V]) (V, bool, error)) (V, bool, error) {
+	s := l.shard(h)
+	v, ok, err := get(s)
+	if ok || err != nil || l.old == nil {
+		return v, ok, err
+	}
+	o := l.old.shard(h)
+	if o == s {
+		return v, false, nil
+	}
+	if v, ok, err = get(o); ok || err != nil {
+		return v, ok, err
+	}
+	return get(s)
+}
+
+// relookup reads again any keys that are missing from found if a reshard
+// started since l was loaded, so that items moved out from under a batch read
+// are not reported missing
+func (slru *LazyLRU[K, V]) relookup(ctx context.Context, l *shardLayout[K, V], keys []K, found map[K]V) error {
+	if slru.layout.Load() == l {
+		return nil
+	}
+	for _, key := range keys {
+		if _, ok := found[key]; ok {
+			continue
+		}
+		v, ok, err := slru.GetCtx(ctx, key)
+		if err != nil {
+			return err
+		}
+		if ok {
+			found[key] = v
+		}
+	}
+	return nil
+}
+
+// shardRetired reports whether err came from reading a shard in l that has since
+// been closed by Reshard. Its items have moved, so relookup will find them.
+func (slru *LazyLRU[K, V]) shardRetired(l *shardLayout[K, V], err error) bool {
+	return errors.Is(err, lazylru.ErrClosed) && slru.layout.Load() != l
+}
+
+// write runs a write against a key's shard. Outside of a reshard, this is just
+// the write. If a reshard is moving items, or started while the write ran, the
+// write is done again the slow way; see writeMoving.
+func (slru *LazyLRU[K, V]) write(key K, set func(s *lazylru.LazyLRU[K, V]) error) error {
+	h := slru.sharder(key)
+	l := slru.layout.Load()
+	if l.old != nil {
+		return slru.writeMoving(h, key, nil, set)
+	}
+	s := l.shard(h)
+	err := set(s)
+	if err != nil || slru.layout.Load() == l {
+		// if the reshard starts after this point, it will find the item where
+		// we left it and move it
+		return err
+	}
+	return slru.writeMoving(h, key, s, set)
+}
+
+// writeMoving writes to a key's shard, keeping Reshard from moving items at
+// the same time, then deletes the key from its old shard and from the shard
+// wrote, if it was written there first. Otherwise Reshard could later move an
+// older value over this one, or leave it behind where reads won't look.
+func (slru *LazyLRU[K, V]) writeMoving(h uint64, key K, wrote *lazylru.LazyLRU[K, V], set func(s *lazylru.LazyLRU[K, V]) error) error {
+	slru.reshardLock.RLock()
+	defer slru.reshardLock.RUnlock()
+	l := slru.layout.Load()
+	s := l.shard(h)
+	if err := set(s); err != nil {
+		return err
+	}
+	if l.old != nil {
+		if o := l.old.shard(h); o != s {
+			o.Delete(key)
+		}
+	}
+	if wrote != nil && wrote != s {
+		wrote.Delete(key)
+	}
+	return nil
+}
+
+// Reshard changes the number of shards and moves each item whose shard has
+// changed. Items are moved a few hundred at a time, and reads and writes keep
+// working while they move: a read that misses the new shard also checks the
+// old one, and a write removes any older copy that has not been moved yet.
+// Moved items keep their remaining time to live and their priority, and count
+// as writes to their new shard. New shards are created with the same capacity
+// as the others, so the total capacity changes along with the number of
+// shards, unless the cache was created by NewWithBudget.
+//
+// With NewT, nearly every item moves. Caches created with NewConsistent move
+// only the items that have to. Reshard blocks until every item has moved, and
+// calls to Reshard wait for each other.
+func (slru *LazyLRU[K, V]) Reshard(numShards int) error {
+	if numShards <= 0 {
+		return errNoShards
+	}
+	slru.reshardMu.Lock()
+	defer slru.reshardMu.Unlock()
+	cur := slru.layout.Load()
+	if numShards == len(cur.shards) {
+		return nil
+	}
+
+	shards := make([]*lazylru.LazyLRU[K, V], numShards)
+	copy(shards, cur.shards)
+	for i := len(cur.shards); i < numShards; i++ {
+		shards[i] = slru.newShard()
+	}
+	next := &shardLayout[K, V]{shards: shards, old: cur, consistent: cur.consistent}
+	slru.reshardLock.Lock()
+	slru.layout.Store(next)
+	slru.reshardLock.Unlock()
+
+	for _, s := range cur.shards {
+		keys := s.Keys()
+		for start := 0; start < len(keys); start += reshardBatch {
+			slru.moveKeys(next, s, keys[start:min(start+reshardBatch, len(keys))])
+		}
+	}
+
+	slru.reshardLock.Lock()
+	slru.layout.Store(&shardLayout[K, V]{shards: shards, consistent: cur.consistent})
+	for _, s := range cur.shards[min(numShards, len(cur.shards)):] {
+		addStats(&slru.retired, s.Stats())
+	}
+	slru.reshardLock.Unlock()
+	for _, s := range cur.shards[min(numShards, len(cur.shards)):] {
+		// everything has moved out, so this mostly waits for the reaper to stop
+		_ = s.CloseContext(context.Background())
+	}
+	return nil
+}
+
+// moveKeys copies each key that no longer belongs in from to its new shard,
+// then deletes it from from. Writers wait while this runs. Pinned items stay
+// pinned unless the new shard has no room for another pin. A shared budget is
+// paused so that the copies don't push out other items.
+func (slru *LazyLRU[K, V]) moveKeys(l *shardLayout[K, V], from *lazylru.LazyLRU[K, V], keys []K) {
+	slru.reshardLock.Lock()
+	defer slru.reshardLock.Unlock()
+	if slru.budget != nil {
+		slru.budget.Pause()
+		defer slru.budget.Resume()
+	}
+	for _, key := range keys {
+		to := l.shard(slru.sharder(key))
+		if to == from {
+			continue
+		}
+		if v, info, ok := from.Peek(key); ok {
+			to.SetTTLPriority(key, v, info.TTL, info.Priority)
+			if info.Pinned {
+				// this pins it in place, so it keeps its priority
+				_ = to.SetPinnedTTL(key, v, info.TTL)
+			}
+		}
+		from.Delete(key)
+	}
+}
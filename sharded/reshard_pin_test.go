@@ -0,0 +1,39 @@
+package sharded
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReshardKeepsPins(t *testing.T) {
+	lru := NewT[string, int](100, time.Hour, 2, StringSharder)
+	defer lru.Close()
+	keys := make([]string, 20)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		shard := lru.layout.Load().shard(StringSharder(keys[i]))
+		shard.SetTTLPriority(keys[i], i, time.Hour, lazylru.PriorityHigh)
+		require.NoError(t, shard.SetPinned(keys[i], i))
+	}
+	moved := 0
+	before := map[string]int{}
+	for _, key := range keys {
+		before[key] = lru.ShardIx(key)
+	}
+	require.NoError(t, lru.Reshard(7))
+	for i, key := range keys {
+		if lru.ShardIx(key) != before[key] {
+			moved++
+		}
+		v, info, ok := lru.layout.Load().shard(StringSharder(key)).Peek(key)
+		require.True(t, ok, key)
+		require.Equal(t, i, v)
+		require.True(t, info.Pinned, key)
+		require.Equal(t, lazylru.PriorityHigh, info.Priority, key)
+	}
+	require.Positive(t, moved)
+}
@@ -0,0 +1,143 @@
+package sharded_test
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TriggerMail/lazylru/sharded"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJumpHash(t *testing.T) {
+	const keyCount = 10000
+	moved := 0
+	for i := 0; i < keyCount; i++ {
+		h := sharded.StringSharder(strconv.Itoa(i))
+		before, after := sharded.JumpHash(h, 10), sharded.JumpHash(h, 11)
+		require.GreaterOrEqual(t, before, 0)
+		require.Less(t, before, 10)
+		if before != after {
+			// keys only ever move to the new bucket
+			require.Equal(t, 10, after)
+			moved++
+		}
+		require.Equal(t, 0, sharded.JumpHash(h, 1))
+	}
+	require.InDelta(t, keyCount/11, moved, keyCount/50)
+}
+
+func TestReshard(t *testing.T) {
+	for name, factory := range map[string]func() *sharded.LazyLRU[string, int]{
+		"modulo": func() *sharded.LazyLRU[string, int] {
+			return sharded.NewT[string, int](1000, time.Hour, 4, sharded.StringSharder)
+		},
+		"consistent": func() *sharded.LazyLRU[string, int] {
+			return sharded.NewConsistent[string, int](1000, time.Hour, 4, sharded.StringSharder)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			lru := factory()
+			defer lru.Close()
+			keys := make([]string, 1000)
+			for i := range keys {
+				keys[i] = strconv.Itoa(i)
+				lru.SetTTL(keys[i], i, time.Duration(i+1)*time.Hour)
+			}
+			for _, numShards := range []int{7, 2, 4, 4} {
+				require.NoError(t, lru.Reshard(numShards))
+				require.Equal(t, len(keys), lru.Len())
+				for i, key := range keys {
+					require.Less(t, lru.ShardIx(key), numShards)
+					v, ok := lru.Get(key)
+					require.True(t, ok, key)
+					require.Equal(t, i, v)
+				}
+			}
+			require.Error(t, lru.Reshard(0))
+
+			// the stats of removed shards are kept
+			stats := lru.Stats()
+			require.GreaterOrEqual(t, stats.KeysWritten, uint32(len(keys)))
+			require.Equal(t, uint32(4*len(keys)), stats.KeysReadOK)
+		})
+	}
+}
+
+func TestReshardConsistentMovesFewer(t *testing.T) {
+	moved := func(lru *sharded.LazyLRU[string, int]) uint32 {
+		for i := 0; i < 1000; i++ {
+			lru.Set(strconv.Itoa(i), i)
+		}
+		before := lru.Stats().KeysWritten
+		require.NoError(t, lru.Reshard(5))
+		return lru.Stats().KeysWritten - before
+	}
+	modulo := moved(sharded.NewT[string, int](1000, time.Hour, 4, sharded.StringSharder))
+	consistent := moved(sharded.NewConsistent[string, int](1000, time.Hour, 4, sharded.StringSharder))
+	// growing from 4 to 5 shards, about 1/5 of the keys have to move
+	require.InDelta(t, 200, consistent, 50)
+	require.Greater(t, modulo, 2*consistent)
+}
+
+func TestReshardConcurrent(t *testing.T) {
+	const keyCount = 2000
+	lru := sharded.NewConsistent[string, int](keyCount, time.Hour, 3, sharded.StringSharder)
+	defer lru.Close()
+	keys := make([]string, keyCount)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		lru.Set(keys[i], 0)
+	}
+
+	// writers bump the values of their own keys while readers check that every
+	// key can always be found
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	latest := make([]int, keyCount)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for n := 1; !stop.Load(); n++ {
+				for i := w; i < keyCount; i += 4 {
+					if i%8 == w {
+						require.NoError(t, lru.MSet(keys[i:i+1], []int{n}))
+					} else {
+						lru.Set(keys[i], n)
+					}
+					latest[i] = n
+				}
+			}
+		}(w)
+	}
+	for r := 0; r < 2; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				for _, key := range keys {
+					if _, ok := lru.Get(key); !ok {
+						t.Errorf("missing %s", key)
+						return
+					}
+				}
+				require.Equal(t, keyCount, len(lru.MGet(keys...)))
+			}
+		}()
+	}
+	for _, numShards := range []int{8, 5, 2, 6} {
+		require.NoError(t, lru.Reshard(numShards))
+	}
+	stop.Store(true)
+	wg.Wait()
+
+	require.Equal(t, keyCount, lru.Len())
+	for i, key := range keys {
+		v, ok := lru.Get(key)
+		require.True(t, ok)
+		require.Equal(t, latest[i], v, key)
+	}
+}
@@ -83,3 +83,34 @@ func TestKVShardHelper(t *testing.T) {
 	require.Equal(t, 0, len(keys))
 	require.Equal(t, 0, len(vals))
 }
+
+func BenchmarkKeyShardHelperAllocs(b *testing.B) {
+	keys := make([]int, 64)
+	for i := range keys {
+		keys[i] = i
+	}
+	fIx := func(k int) int { return k % 8 }
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		helper := newKeyShardHelper(keys, fIx)
+		for shardIx, _ := helper.TakeGroup(); shardIx >= 0; shardIx, _ = helper.TakeGroup() {
+		}
+	}
+}
+
+func BenchmarkKVShardHelperAllocs(b *testing.B) {
+	keys := make([]int, 64)
+	values := make([]int, 64)
+	for i := range keys {
+		keys[i] = i
+	}
+	fIx := func(k int) int { return k % 8 }
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		helper := newKVShardHelper(keys, values, fIx)
+		for shardIx, _, _ := helper.TakeGroup(); shardIx >= 0; shardIx, _, _ = helper.TakeGroup() {
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package sharded
 
 import (
+	"context"
 	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	lazylru "github.com/TriggerMail/lazylru"
@@ -20,9 +23,15 @@ import (
 // undersized and churning a lot, this implementation will perform worse than an
 // LRU that updates on every read.
 type LazyLRU[K comparable, V any] struct {
-	sharder func(K) uint64
-	shards  []*lazylru.LazyLRU[K, V]
-	ttl     time.Duration
+	sharder     func(K) uint64
+	layout      atomic.Pointer[shardLayout[K, V]]
+	ttl         time.Duration
+	newShard    func() *lazylru.LazyLRU[K, V]
+	parallel    atomic.Pointer[parallelConfig]
+	reshardMu   sync.Mutex   // one Reshard at a time
+	reshardLock sync.RWMutex // held by writers while items are moving
+	budget      *lazylru.Budget
+	retired     lazylru.Stats
 }
 
 // New creates a new sharded cache with strings for keys and any (interface{})
@@ -39,23 +48,73 @@ func New(maxItemsPerShard int, ttl time.Duration, numShards int) *LazyLRU[string
 // BytesSharder are appropriate. These are both based on the HashingSharder,
 // which callers can use to create sharder functions for custom types.
 func NewT[K comparable, V any](maxItemsPerShard int, ttl time.Duration, numShards int, sharder func(K) uint64) *LazyLRU[K, V] {
+	return newSharded(ttl, numShards, sharder, false, func() *lazylru.LazyLRU[K, V] {
+		return lazylru.NewT[K, V](maxItemsPerShard, ttl)
+	})
+}
+
+// NewConsistent creates a new sharded cache that assigns keys to shards with
+// JumpHash instead of taking the hash modulo the number of shards. Lookups
+// cost a little more, but when Reshard changes the number of shards, only the
+// keys that have to move do: growing from n to m shards moves (m-n)/m of the
+// keys, all into the new shards, rather than nearly all of them.
+func NewConsistent[K comparable, V any](maxItemsPerShard int, ttl time.Duration, numShards int, sharder func(K) uint64) *LazyLRU[K, V] {
+	return newSharded(ttl, numShards, sharder, true, func() *lazylru.LazyLRU[K, V] {
+		return lazylru.NewT[K, V](maxItemsPerShard, ttl)
+	})
+}
+
+// NewWithBudget creates a new sharded cache that holds at most maxItems items
+// across all of its shards, rather than a fixed number per shard. A shard that
+// gets more than its share of the keys borrows room from the others, and when
+// the cache is full, the item evicted is the least recently used one at the
+// tail of any shard. Keeping the shards' clocks in step costs writers one
+// shared counter. See lazylru.Budget.
+func NewWithBudget[K comparable, V any](maxItems int, ttl time.Duration, numShards int, sharder func(K) uint64) *LazyLRU[K, V] {
+	return newBudgeted[K, V](maxItems, ttl, numShards, sharder, false)
+}
+
+// NewConsistentWithBudget creates a sharded cache like NewWithBudget that
+// assigns keys to shards with JumpHash, like NewConsistent
+func NewConsistentWithBudget[K comparable, V any](maxItems int, ttl time.Duration, numShards int, sharder func(K) uint64) *LazyLRU[K, V] {
+	return newBudgeted[K, V](maxItems, ttl, numShards, sharder, true)
+}
+
+// NewAuto creates a new sharded cache like NewT, sharding keys with the
+// ComparableSharder so that no sharder needs to be written for the key type
+func NewAuto[K comparable, V any](maxItemsPerShard int, ttl time.Duration, numShards int) *LazyLRU[K, V] {
+	return NewT[K, V](maxItemsPerShard, ttl, numShards, ComparableSharder[K]())
+}
+
+func newBudgeted[K comparable, V any](maxItems int, ttl time.Duration, numShards int, sharder func(K) uint64, consistent bool) *LazyLRU[K, V] {
+	budget := lazylru.NewBudget(maxItems)
+	slru := newSharded(ttl, numShards, sharder, consistent, func() *lazylru.LazyLRU[K, V] {
+		return lazylru.NewBudgeted[K, V](budget, ttl)
+	})
+	slru.budget = budget
+	return slru
+}
+
+func newSharded[K comparable, V any](ttl time.Duration, numShards int, sharder func(K) uint64, consistent bool, newShard func() *lazylru.LazyLRU[K, V]) *LazyLRU[K, V] {
 	shards := make([]*lazylru.LazyLRU[K, V], numShards)
 	for i := 0; i < numShards; i++ {
-		shards[i] = lazylru.NewT[K, V](maxItemsPerShard, ttl)
+		shards[i] = newShard()
 	}
 
-	return &LazyLRU[K, V]{sharder, shards, ttl}
+	slru := &LazyLRU[K, V]{sharder: sharder, ttl: ttl, newShard: newShard}
+	slru.layout.Store(&shardLayout[K, V]{shards: shards, consistent: consistent})
+	return slru
 }
 
 // ShardIx determines the target shard for the provided key
 func (slru *LazyLRU[K, V]) ShardIx(key K) int {
-	return int(slru.sharder(key) % uint64(len(slru.shards)))
+	return slru.layout.Load().ix(slru.sharder(key))
 }
 
 // IsRunning indicates whether the background reaper is active on at least one
 // of the shards
 func (slru *LazyLRU[K, V]) IsRunning() bool {
-	for _, s := range slru.shards {
+	for _, s := range slru.layout.Load().all() {
 		if s.IsRunning() {
 			return true
 		}
@@ -65,7 +124,7 @@ func (slru *LazyLRU[K, V]) IsRunning() bool {
 
 // Reap removes all expired items from the cache
 func (slru *LazyLRU[K, V]) Reap() {
-	for _, s := range slru.shards {
+	for _, s := range slru.layout.Load().all() {
 		s.Reap()
 	}
 }
@@ -73,42 +132,111 @@ func (slru *LazyLRU[K, V]) Reap() {
 // Get retrieves a value from the cache. The returned bool indicates whether the
 // key was found in the cache.
 func (slru *LazyLRU[K, V]) Get(key K) (V, bool) {
-	return slru.shards[slru.ShardIx(key)].Get(key)
+	v, ok, _ := slru.lookup(key, func(s *lazylru.LazyLRU[K, V]) (V, bool, error) {
+		v, ok := s.Get(key)
+		return v, ok, nil
+	})
+	return v, ok
 }
 
 // MGet retrieves values from the cache. Missing values will not be returned.
 func (slru *LazyLRU[K, V]) MGet(keys ...K) map[K]V {
+	l := slru.layout.Load()
+	if cfg := slru.parallelFor(l, len(keys)); cfg != nil {
+		if retval, err := slru.mgetParallel(context.Background(), l, keys, cfg); err == nil {
+			return retval
+		}
+	}
+	retval := make(map[K]V, len(keys))
+	slru.MGetInto(retval, keys...)
+	return retval
+}
+
+// GetCtx retrieves a value from the cache, giving up if the context ends
+// before the value can be read. See lazylru.LazyLRU.GetCtx.
+func (slru *LazyLRU[K, V]) GetCtx(ctx context.Context, key K) (V, bool, error) {
+	return slru.lookup(key, func(s *lazylru.LazyLRU[K, V]) (V, bool, error) {
+		return s.GetCtx(ctx, key)
+	})
+}
+
+// MGetCtx retrieves values from the cache, giving up if the context ends
+// before the values can be read. Missing values will not be returned. See
+// lazylru.LazyLRU.MGetCtx.
+func (slru *LazyLRU[K, V]) MGetCtx(ctx context.Context, keys ...K) (map[K]V, error) {
 	retval := map[K]V{}
 	if len(keys) == 0 {
-		return retval
+		return retval, nil
 	}
-	if len(keys) == 1 {
-		v, ok := slru.Get(keys[0])
-		if ok {
-			retval[keys[0]] = v
+	l := slru.layout.Load()
+	if cfg := slru.parallelFor(l, len(keys)); cfg != nil {
+		return slru.mgetParallel(ctx, l, keys, cfg)
+	}
+	if l.old != nil {
+		// items are moving, so every key may need a second look
+		for _, key := range keys {
+			v, ok, err := slru.GetCtx(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				retval[key] = v
+			}
 		}
-		return retval
+		return retval, nil
 	}
-	shardMapper := newKeyShardHelper(keys, slru.ShardIx)
+	shardMapper := newKeyShardHelper(keys, func(key K) int { return l.ix(slru.sharder(key)) })
 	for {
 		shardIx, skeys := shardMapper.TakeGroup()
 		if shardIx < 0 {
-			return retval
+			return retval, slru.relookup(ctx, l, keys, retval)
+		}
+		svals, err := l.shards[shardIx].MGetCtx(ctx, skeys...)
+		if err != nil && !slru.shardRetired(l, err) {
+			return nil, err
 		}
-		for k, v := range slru.shards[shardIx].MGet(skeys...) {
+		for k, v := range svals {
 			retval[k] = v
 		}
 	}
 }
 
+// SetCtx writes to the cache, giving up if the context ends before the write
+// can happen. See lazylru.LazyLRU.SetCtx.
+func (slru *LazyLRU[K, V]) SetCtx(ctx context.Context, key K, value V) error {
+	return slru.write(key, func(s *lazylru.LazyLRU[K, V]) error {
+		return s.SetCtx(ctx, key, value)
+	})
+}
+
+// SetTTLCtx writes to the cache, expiring with the given time-to-live value.
+// See lazylru.LazyLRU.SetCtx.
+func (slru *LazyLRU[K, V]) SetTTLCtx(ctx context.Context, key K, value V, ttl time.Duration) error {
+	return slru.write(key, func(s *lazylru.LazyLRU[K, V]) error {
+		return s.SetTTLCtx(ctx, key, value, ttl)
+	})
+}
+
 // Set writes to the cache
 func (slru *LazyLRU[K, V]) Set(key K, value V) {
-	slru.shards[slru.ShardIx(key)].Set(key, value)
+	slru.SetTTL(key, value, slru.ttl)
 }
 
 // SetTTL writes to the cache, expiring with the given time-to-live value
 func (slru *LazyLRU[K, V]) SetTTL(key K, value V, ttl time.Duration) {
-	slru.shards[slru.ShardIx(key)].SetTTL(key, value, ttl)
+	_ = slru.write(key, func(s *lazylru.LazyLRU[K, V]) error {
+		s.SetTTL(key, value, ttl)
+		return nil
+	})
+}
+
+// SetTTLPriority writes to the cache, expiring with the given time-to-live
+// value. Within each shard, items with a lower priority are evicted first.
+func (slru *LazyLRU[K, V]) SetTTLPriority(key K, value V, ttl time.Duration, priority lazylru.Priority) {
+	_ = slru.write(key, func(s *lazylru.LazyLRU[K, V]) error {
+		s.SetTTLPriority(key, value, ttl, priority)
+		return nil
+	})
 }
 
 // MSet writes multiple keys and values to the cache. If the "key" and "value"
@@ -136,22 +264,73 @@ func (slru *LazyLRU[K, V]) MSetTTL(keys []K, values []V, ttl time.Duration) erro
 		slru.SetTTL(keys[0], values[0], ttl)
 		return nil
 	}
-	shardMapper := newKVShardHelper(keys, values, slru.ShardIx)
-	for {
-		shardIx, skeys, svals := shardMapper.TakeGroup()
-		if shardIx < 0 {
-			return nil
+	l := slru.layout.Load()
+	if l.old != nil {
+		// items are moving, so every key has to be cleared from its old shard
+		for i, key := range keys {
+			slru.SetTTL(key, values[i], ttl)
 		}
-		if err := slru.shards[shardIx].MSetTTL(skeys, svals, ttl); err != nil {
-			return err
+		return nil
+	}
+	var err error
+	if cfg := slru.parallelFor(l, len(keys)); cfg != nil {
+		err = slru.msetParallel(l, keys, values, ttl, cfg)
+	} else {
+		err = slru.msetSerial(l, keys, values, ttl)
+	}
+	if err == nil && slru.layout.Load() != l {
+		// a reshard started while we were writing, so write again the slow way
+		for i, key := range keys {
+			h := slru.sharder(key)
+			_ = slru.writeMoving(h, key, l.shard(h), func(s *lazylru.LazyLRU[K, V]) error {
+				s.SetTTL(key, values[i], ttl)
+				return nil
+			})
+		}
+	}
+	return err
+}
+
+// msetSerial writes keys a chunk at a time, sending each chunk to the shards
+// as one batch per shard. As in mgetEach, the grouping is done in arrays on the
+// stack, so this does not allocate.
+func (slru *LazyLRU[K, V]) msetSerial(l *shardLayout[K, V], keys []K, values []V, ttl time.Duration) error {
+	var (
+		shardIxs [groupChunk]int
+		taken    [groupChunk]bool
+		skeys    [groupChunk]K
+		svals    [groupChunk]V
+	)
+	for start := 0; start < len(keys); start += groupChunk {
+		chunk := keys[start:min(start+groupChunk, len(keys))]
+		for i, key := range chunk {
+			shardIxs[i] = l.ix(slru.sharder(key))
+			taken[i] = false
+		}
+		for i := range chunk {
+			if taken[i] {
+				continue
+			}
+			shardIx, n := shardIxs[i], 0
+			for j := i; j < len(chunk); j++ {
+				if !taken[j] && shardIxs[j] == shardIx {
+					taken[j] = true
+					skeys[n], svals[n] = chunk[j], values[start+j]
+					n++
+				}
+			}
+			if err := l.shards[shardIx].MSetTTL(skeys[:n], svals[:n], ttl); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
 }
 
 // Len returns the number of items in the cache
 func (slru *LazyLRU[K, V]) Len() int {
 	retval := 0
-	for _, s := range slru.shards {
+	for _, s := range slru.layout.Load().all() {
 		retval += s.Len()
 	}
 	return retval
@@ -159,26 +338,67 @@ func (slru *LazyLRU[K, V]) Len() int {
 
 // Close stops the reaper process. This is safe to call multiple times.
 func (slru *LazyLRU[K, V]) Close() {
-	for _, s := range slru.shards {
+	for _, s := range slru.layout.Load().all() {
 		s.Close()
 	}
 }
 
+// CloseContext stops the reapers, waits for them to exit, and releases the
+// items in every shard. See lazylru.LazyLRU.CloseContext.
+func (slru *LazyLRU[K, V]) CloseContext(ctx context.Context) error {
+	shards := slru.layout.Load().all()
+	// signal every reaper before waiting on any of them
+	for _, s := range shards {
+		s.Close()
+	}
+	for _, s := range shards {
+		if err := s.CloseContext(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Stats gets a copy of the stats held by the cache. Note that this is a copy,
 // so returned objects will not update as the service continues to execute. The
-// returned value is a sum of each statistic across all shards.
+// returned value is a sum of each statistic across all shards, including
+// shards that have been removed by Reshard.
 func (slru *LazyLRU[K, V]) Stats() lazylru.Stats {
-	stats := slru.shards[0].Stats()
-	for i := 1; i < len(slru.shards); i++ {
-		lstats := slru.shards[i].Stats()
-		stats.KeysWritten += lstats.KeysWritten
-		stats.KeysReadOK += lstats.KeysReadOK
-		stats.KeysReadNotFound += lstats.KeysReadNotFound
-		stats.KeysReadExpired += lstats.KeysReadExpired
-		stats.Shuffles += lstats.Shuffles
-		stats.Evictions += lstats.Evictions
-		stats.KeysReaped += lstats.KeysReaped
-		stats.ReaperCycles += lstats.ReaperCycles
+	slru.reshardLock.RLock()
+	defer slru.reshardLock.RUnlock()
+	stats := slru.retired
+	for _, s := range slru.layout.Load().all() {
+		addStats(&stats, s.Stats())
 	}
 	return stats
 }
+
+// addStats adds each statistic in src to dst
+func addStats(dst *lazylru.Stats, src lazylru.Stats) {
+	dst.KeysWritten += src.KeysWritten
+	dst.KeysReadOK += src.KeysReadOK
+	dst.KeysReadNotFound += src.KeysReadNotFound
+	dst.KeysReadExpired += src.KeysReadExpired
+	dst.Shuffles += src.Shuffles
+	dst.Evictions += src.Evictions
+	dst.KeysReaped += src.KeysReaped
+	dst.ReaperCycles += src.ReaperCycles
+	dst.Decays += src.Decays
+	dst.GhostHits += src.GhostHits
+	dst.AdaptiveTarget += src.AdaptiveTarget
+	dst.ReadBufferDrains += src.ReadBufferDrains
+	dst.ReadBufferDrops += src.ReadBufferDrops
+	dst.PromotionBatches += src.PromotionBatches
+	dst.PromotionsApplied += src.PromotionsApplied
+	dst.PromotionsDropped += src.PromotionsDropped
+	dst.EvictNotesQueued += src.EvictNotesQueued
+	dst.EvictNotesDropped += src.EvictNotesDropped
+	dst.StoreLoads += src.StoreLoads
+	dst.StoreWrites += src.StoreWrites
+	dst.StoreErrors += src.StoreErrors
+	dst.StoreFlushes += src.StoreFlushes
+	dst.WALErrors += src.WALErrors
+	for p := range dst.EvictionsByPriority {
+		dst.EvictionsByPriority[p] += src.EvictionsByPriority[p]
+	}
+}
@@ -1,10 +1,12 @@
 package sharded_test
 
 import (
+	"context"
 	"strconv"
 	"testing"
 	"time"
 
+	lazylru "github.com/TriggerMail/lazylru"
 	"github.com/TriggerMail/lazylru/sharded"
 	"github.com/stretchr/testify/require"
 )
@@ -415,3 +417,30 @@ func TestMSetZeroTTL(t *testing.T) {
 			WithKeysReadNotFound(2),
 	)
 }
+
+func TestContext(t *testing.T) {
+	doShardedTest(t, 10, time.Hour, 10, sharded.StringSharder, func(t *testing.T, lru *sharded.LazyLRU[string, string]) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, lru.SetCtx(ctx, "abloy", "medeco"))
+		require.NoError(t, lru.SetTTLCtx(ctx, "schlage", "kwikset", time.Hour))
+		v, ok, err := lru.GetCtx(ctx, "abloy")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, "medeco", v)
+		found, err := lru.MGetCtx(ctx, "abloy", "schlage", "yale")
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"abloy": "medeco", "schlage": "kwikset"}, found)
+	},
+		ExpectedStats{}.WithKeysWritten(2).WithKeysReadOK(3).WithKeysReadNotFound(1),
+	)
+}
+
+func TestCloseContext(t *testing.T) {
+	lru := sharded.NewT[string, int](10, time.Hour, 4, sharded.StringSharder)
+	require.NoError(t, lru.MSet([]string{"a", "b", "c", "d"}, []int{1, 2, 3, 4}))
+	require.NoError(t, lru.CloseContext(context.Background()))
+	require.False(t, lru.IsRunning())
+	require.Equal(t, 0, lru.Len())
+	require.ErrorIs(t, lru.SetCtx(context.Background(), "a", 1), lazylru.ErrClosed)
+}
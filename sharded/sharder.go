@@ -1,7 +1,9 @@
 package sharded
 
 import (
+	"net/netip"
 	"sync"
+	"time"
 
 	"github.com/zeebo/xxh3"
 )
@@ -17,6 +19,26 @@ type H interface {
 	WriteFloat32(float32)
 	WriteFloat64(float64)
 	WriteBool(bool)
+	WriteInt64(int64)
+	WriteInt32(int32)
+	WriteInt16(int16)
+	WriteInt8(int8)
+	WriteComplex64(complex64)
+	WriteComplex128(complex128)
+	// WriteTime writes the instant, so times that are Equal hash the same
+	// whatever their location or monotonic clock reading
+	WriteTime(time.Time)
+	// WriteUUID writes 16 bytes. UUID types declared as [16]byte, such as
+	// github.com/google/uuid.UUID, can be passed without conversion.
+	WriteUUID([16]byte)
+	WriteAddr(netip.Addr)
+	WriteHashable(Hashable)
+}
+
+// Hashable is implemented by key types, or parts of key types, that know how
+// to write themselves to a hasher
+type Hashable interface {
+	Hash(H)
 }
 
 // these pools allow the sharding operations to amortize to zero allocations
@@ -46,3 +68,18 @@ func HashingSharder[K any](f func(K, H)) func(K) uint64 {
 		return retval
 	}
 }
+
+// JumpHash maps a hash to one of numBuckets buckets with the jump consistent
+// hash of Lamping and Veach. When the number of buckets grows from n to n+1,
+// the only hashes that change buckets are the 1/(n+1) that move to the new
+// bucket. The hash should already be well mixed, like the output of the
+// HashingSharder.
+func JumpHash(hash uint64, numBuckets int) int {
+	b, j := int64(-1), int64(0)
+	for j < int64(numBuckets) {
+		b = j
+		hash = hash*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((hash>>33)+1)))
+	}
+	return int(b)
+}
@@ -5,6 +5,7 @@ import (
 	"sort"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/TriggerMail/lazylru/sharded"
 	"github.com/stretchr/testify/require"
@@ -201,3 +202,74 @@ func BenchmarkCustomSharder(b *testing.B) {
 		sharder(sources[i%len(sources)])
 	}
 }
+
+func TestComparableSharder(t *testing.T) {
+	type MyStruct struct {
+		name     string
+		category string
+		count    int
+	}
+
+	structSharder := sharded.ComparableSharder[MyStruct]()
+	require.Equal(t,
+		structSharder(MyStruct{"foo", "cat1", 0}),
+		structSharder(MyStruct{"foo", "cat1", 0}),
+	)
+
+	testData := []MyStruct{
+		{"foo", "cat1", 0},
+		{"foo", "cat2", 0},
+		{"foo", "cat1", 1},
+		{"foo", "cat2", 1},
+		{"bar", "cat1", 0},
+		{"bar", "cat2", 0},
+		{"bar", "cat1", 1},
+		{"bar", "cat2", 1},
+	}
+	shards := make([]int, len(testData))
+	for i, td := range testData {
+		shards[i] = int(structSharder(td))
+	}
+	sort.Ints(shards)
+	for i := 1; i < len(shards); i++ {
+		require.NotEqual(t, shards[i-1], shards[i])
+	}
+}
+
+func TestNewAuto(t *testing.T) {
+	type point struct{ x, y int }
+	lru := sharded.NewAuto[point, string](10, time.Hour, 4)
+	defer lru.Close()
+
+	for i := 0; i < 20; i++ {
+		lru.Set(point{i, -i}, strconv.Itoa(i))
+	}
+	for i := 0; i < 20; i++ {
+		v, ok := lru.Get(point{i, -i})
+		require.True(t, ok)
+		require.Equal(t, strconv.Itoa(i), v)
+	}
+	_, ok := lru.Get(point{1, 1})
+	require.False(t, ok)
+	require.Equal(t, 20, lru.Len())
+}
+
+func BenchmarkComparableSharder(b *testing.B) {
+	type Custom struct {
+		a string
+		b string
+		c int
+	}
+
+	sources := make([]Custom, 1000)
+	for i := 0; i < 1000; i++ {
+		s := strconv.Itoa(rand.Int())
+		sources[i] = Custom{a: s, b: s, c: i}
+	}
+	sharder := sharded.ComparableSharder[Custom]()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sharder(sources[i%len(sources)])
+	}
+}
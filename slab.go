@@ -0,0 +1,244 @@
+package lazylru
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	heap "github.com/TriggerMail/lazylru/containers/heap"
+)
+
+// slabItem is an item held in place in the slab rather than behind a pointer
+type slabItem[K comparable, V any] struct {
+	expiration   time.Time
+	value        V
+	key          K
+	insertNumber uint64
+	index        int32 // position in the heap, or -1 if the slot is free
+}
+
+// slabPQ is a heap of positions in the slab, so swaps move 4-byte integers
+// and never touch the items themselves
+type slabPQ[K comparable, V any] struct {
+	order []int32
+	items []slabItem[K, V]
+}
+
+func (pq *slabPQ[K, V]) Len() int { return len(pq.order) }
+
+func (pq *slabPQ[K, V]) Less(i, j int) bool {
+	return pq.items[pq.order[i]].insertNumber < pq.items[pq.order[j]].insertNumber
+}
+
+func (pq *slabPQ[K, V]) Swap(i, j int) {
+	pq.order[i], pq.order[j] = pq.order[j], pq.order[i]
+	pq.items[pq.order[i]].index = int32(i)
+	pq.items[pq.order[j]].index = int32(j)
+}
+
+func (pq *slabPQ[K, V]) Push(ix int32) {
+	pq.items[ix].index = int32(len(pq.order))
+	pq.order = append(pq.order, ix)
+}
+
+func (pq *slabPQ[K, V]) Pop() int32 {
+	n := len(pq.order) - 1
+	ix := pq.order[n]
+	pq.order = pq.order[:n]
+	pq.items[ix].index = -1
+	return ix
+}
+
+// SlabLRU is a lazy LRU like LazyLRU, but with its items stored in one
+// contiguous slab and the queue holding int32 positions in the slab instead of
+// pointers. A new key reuses a free slot rather than allocating, and the
+// garbage collector has one slice to look at instead of one object per item.
+// If neither K nor V holds pointers, the slab is not scanned at all. It holds
+// at most math.MaxInt32 items.
+//
+// SlabLRU is a layout to benchmark against, not a drop-in replacement. It has
+// only Get, Set, SetTTL, Delete, Len, and Stats, and leaves out the rest of
+// the LazyLRU API:
+//
+//   - there is no reaper, so expired items are removed only when they are read
+//     or evicted, and there is no Close, Reap, or IsRunning
+//   - no batch or context calls: MGet, MSet, Scan, Keys, Peek, GetCtx, SetCtx
+//   - no eviction callbacks, priorities, pins, or LFU ordering
+//   - the bubble fraction is fixed at the default, with no SetBubbleFraction
+//     or adaptive bubbling
+//   - no read buffers, promotion buffers, or async eviction
+//   - no write-through or write-behind store, write-ahead log, or snapshots
+//   - it cannot share a Budget, be sharded, or front a second tier
+//
+// Code that needs any of these should use LazyLRU.
+type SlabLRU[K comparable, V any] struct {
+	index    map[K]int32
+	pq       slabPQ[K, V]
+	free     []int32
+	maxItems int
+	itemIx   uint64
+	ttl      time.Duration
+	stats    Stats
+	lock     sync.RWMutex
+}
+
+// NewSlab creates a SlabLRU with the given capacity and default expiration.
+// The capacity is limited to math.MaxInt32 items, since items are found by
+// int32 position, and larger values are lowered to that. The slab starts empty
+// and grows as items are added, so a generous capacity costs nothing up front.
+func NewSlab[K comparable, V any](maxItems int, ttl time.Duration) *SlabLRU[K, V] {
+	maxItems = min(max(maxItems, 0), math.MaxInt32)
+	return &SlabLRU[K, V]{
+		index:    map[K]int32{},
+		maxItems: maxItems,
+		itemIx:   1,
+		ttl:      ttl,
+	}
+}
+
+// shouldBubble decides whether an item is close enough to the front of the
+// queue to be moved to the back, the same way LazyLRU does by default
+func (lru *SlabLRU[K, V]) shouldBubble(index int32) bool {
+	if index < 0 {
+		return false
+	}
+	return (int(index) + (lru.maxItems - lru.pq.Len())) < (lru.maxItems*defaultBubbleScale)>>bubbleScaleBits
+}
+
+// Get retrieves a value from the cache. The returned bool indicates whether the
+// key was found in the cache.
+func (lru *SlabLRU[K, V]) Get(key K) (V, bool) {
+	var zero V
+	lru.lock.RLock()
+	ix, ok := lru.index[key]
+	if !ok {
+		lru.lock.RUnlock()
+		atomic.AddUint32(&lru.stats.KeysReadNotFound, 1)
+		return zero, false
+	}
+	si := &lru.pq.items[ix]
+	value, expiration, bubble := si.value, si.expiration, lru.shouldBubble(si.index)
+	lru.lock.RUnlock()
+
+	if expiration.Before(time.Now()) {
+		lru.lock.Lock()
+		// double check in case the slot has been reused
+		if lru.index[key] == ix && lru.pq.items[ix].expiration.Before(time.Now()) {
+			lru.remove(ix)
+			lru.stats.KeysReadExpired++
+		}
+		lru.lock.Unlock()
+		return zero, false
+	}
+	if bubble {
+		lru.lock.Lock()
+		if lru.index[key] == ix && lru.shouldBubble(lru.pq.items[ix].index) {
+			lru.pq.items[ix].insertNumber = atomic.AddUint64(&lru.itemIx, 1)
+			heap.Fix[int32](&lru.pq, int(lru.pq.items[ix].index))
+			lru.stats.Shuffles++
+		}
+		lru.lock.Unlock()
+	}
+	atomic.AddUint32(&lru.stats.KeysReadOK, 1)
+	return value, true
+}
+
+// Set writes to the cache
+func (lru *SlabLRU[K, V]) Set(key K, value V) {
+	lru.SetTTL(key, value, lru.ttl)
+}
+
+// SetTTL writes to the cache, expiring with the given time-to-live value
+func (lru *SlabLRU[K, V]) SetTTL(key K, value V, ttl time.Duration) {
+	expiration := time.Now().Add(ttl)
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	if lru.maxItems <= 0 {
+		return
+	}
+	lru.stats.KeysWritten++
+	if ix, ok := lru.index[key]; ok {
+		si := &lru.pq.items[ix]
+		si.value = value
+		si.expiration = expiration
+		si.insertNumber = atomic.AddUint64(&lru.itemIx, 1)
+		heap.Fix[int32](&lru.pq, int(si.index))
+		return
+	}
+	for lru.pq.Len() >= lru.maxItems {
+		ix := heap.Pop[int32](&lru.pq)
+		delete(lru.index, lru.pq.items[ix].key)
+		lru.release(ix)
+		lru.stats.Evictions++
+	}
+	ix := lru.alloc()
+	lru.pq.items[ix] = slabItem[K, V]{
+		expiration:   expiration,
+		value:        value,
+		key:          key,
+		insertNumber: atomic.AddUint64(&lru.itemIx, 1),
+	}
+	heap.Push[int32](&lru.pq, ix)
+	lru.index[key] = ix
+}
+
+// alloc finds a free slot, growing the slab if there isn't one. This is NOT
+// thread safe and should always be called with a write lock
+func (lru *SlabLRU[K, V]) alloc() int32 {
+	if n := len(lru.free); n > 0 {
+		ix := lru.free[n-1]
+		lru.free = lru.free[:n-1]
+		return ix
+	}
+	lru.pq.items = append(lru.pq.items, slabItem[K, V]{})
+	return int32(len(lru.pq.items) - 1)
+}
+
+// release clears a slot so that its key and value can be collected and puts
+// it on the free list. This is NOT thread safe and should always be called
+// with a write lock
+func (lru *SlabLRU[K, V]) release(ix int32) {
+	lru.pq.items[ix] = slabItem[K, V]{index: -1}
+	lru.free = append(lru.free, ix)
+}
+
+// remove takes an item out of the queue and the index. This is NOT thread
+// safe and should always be called with a write lock
+func (lru *SlabLRU[K, V]) remove(ix int32) {
+	heap.Remove[int32](&lru.pq, int(lru.pq.items[ix].index))
+	delete(lru.index, lru.pq.items[ix].key)
+	lru.release(ix)
+}
+
+// Delete removes a key from the cache. Removing a key that is not in the cache
+// is safe.
+func (lru *SlabLRU[K, V]) Delete(key K) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	if ix, ok := lru.index[key]; ok {
+		lru.remove(ix)
+	}
+}
+
+// Len returns the number of items in the cache
+func (lru *SlabLRU[K, V]) Len() int {
+	lru.lock.RLock()
+	defer lru.lock.RUnlock()
+	return lru.pq.Len()
+}
+
+// Stats gets a copy of the stats held by the cache. Only the fields that apply
+// to a SlabLRU are filled in.
+func (lru *SlabLRU[K, V]) Stats() Stats {
+	lru.lock.RLock()
+	defer lru.lock.RUnlock()
+	return Stats{
+		KeysWritten:      lru.stats.KeysWritten,
+		KeysReadOK:       atomic.LoadUint32(&lru.stats.KeysReadOK),
+		KeysReadNotFound: atomic.LoadUint32(&lru.stats.KeysReadNotFound),
+		KeysReadExpired:  lru.stats.KeysReadExpired,
+		Shuffles:         lru.stats.Shuffles,
+		Evictions:        lru.stats.Evictions,
+	}
+}
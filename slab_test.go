@@ -0,0 +1,138 @@
+package lazylru_test
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlabGetSetDelete(t *testing.T) {
+	lru := lazylru.NewSlab[string, int](10, time.Hour)
+	lru.Set("a", 1)
+	lru.Set("b", 2)
+	lru.Set("a", 3)
+	require.Equal(t, 2, lru.Len())
+
+	v, ok := lru.Get("a")
+	require.True(t, ok)
+	require.Equal(t, 3, v)
+	_, ok = lru.Get("c")
+	require.False(t, ok)
+
+	lru.Delete("a")
+	lru.Delete("c")
+	_, ok = lru.Get("a")
+	require.False(t, ok)
+	require.Equal(t, 1, lru.Len())
+
+	stats := lru.Stats()
+	require.Equal(t, uint32(3), stats.KeysWritten)
+	require.Equal(t, uint32(1), stats.KeysReadOK)
+	require.Equal(t, uint32(2), stats.KeysReadNotFound)
+}
+
+func TestSlabEvictsOldest(t *testing.T) {
+	lru := lazylru.NewSlab[int, int](4, time.Hour)
+	for i := 0; i < 4; i++ {
+		lru.Set(i, i)
+	}
+	// 0 is at the front of the queue, so reading it moves it to the back
+	_, ok := lru.Get(0)
+	require.True(t, ok)
+	lru.Set(4, 4) // evicts 1
+	_, ok = lru.Get(1)
+	require.False(t, ok)
+	for _, key := range []int{0, 2, 3, 4} {
+		v, ok := lru.Get(key)
+		require.True(t, ok, key)
+		require.Equal(t, key, v)
+	}
+	stats := lru.Stats()
+	require.Equal(t, uint32(1), stats.Evictions)
+	require.Positive(t, stats.Shuffles)
+}
+
+func TestSlabReusesSlots(t *testing.T) {
+	lru := lazylru.NewSlab[int, string](3, time.Hour)
+	for i := 0; i < 100; i++ {
+		lru.Set(i, strconv.Itoa(i))
+		if i%7 == 0 {
+			lru.Delete(i)
+		}
+	}
+	require.LessOrEqual(t, lru.Len(), 3)
+	for i := 97; i < 100; i++ {
+		v, ok := lru.Get(i)
+		if i%7 == 0 {
+			require.False(t, ok)
+			continue
+		}
+		require.True(t, ok)
+		require.Equal(t, strconv.Itoa(i), v)
+	}
+}
+
+func TestSlabExpiration(t *testing.T) {
+	lru := lazylru.NewSlab[string, int](10, time.Hour)
+	lru.SetTTL("a", 1, 10*time.Millisecond)
+	lru.Set("b", 2)
+	time.Sleep(20 * time.Millisecond)
+	_, ok := lru.Get("a")
+	require.False(t, ok)
+	_, ok = lru.Get("b")
+	require.True(t, ok)
+	require.Equal(t, 1, lru.Len())
+	require.Equal(t, uint32(1), lru.Stats().KeysReadExpired)
+}
+
+func TestSlabZeroCapacity(t *testing.T) {
+	lru := lazylru.NewSlab[string, int](0, time.Hour)
+	lru.Set("a", 1)
+	_, ok := lru.Get("a")
+	require.False(t, ok)
+	require.Equal(t, 0, lru.Len())
+}
+
+func TestSlabHugeCapacity(t *testing.T) {
+	// a generous bound must not allocate the whole slab up front
+	allocs := testing.AllocsPerRun(1, func() {
+		lazylru.NewSlab[string, int](math.MaxInt64, time.Hour)
+	})
+	require.Less(t, allocs, float64(10))
+	lru := lazylru.NewSlab[string, int](math.MaxInt64, time.Hour)
+	for i := 0; i < 100; i++ {
+		lru.Set(strconv.Itoa(i), i)
+	}
+	require.Equal(t, 100, lru.Len())
+	v, ok := lru.Get("42")
+	require.True(t, ok)
+	require.Equal(t, 42, v)
+}
+
+func TestSlabConcurrent(t *testing.T) {
+	lru := lazylru.NewSlab[int, int](100, time.Hour)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := g*1000 + i%200
+				lru.Set(key, key)
+				if v, ok := lru.Get(key); ok && v != key {
+					t.Errorf("got %d for %d", v, key)
+				}
+				if i%10 == 0 {
+					lru.Delete(key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	require.LessOrEqual(t, lru.Len(), 100)
+}
@@ -1,5 +1,7 @@
 package lazylru
 
+import "sync/atomic"
+
 // Stats represends counts of actions against the cache.
 type Stats struct {
 	KeysWritten      uint32
@@ -10,4 +12,62 @@ type Stats struct {
 	Evictions        uint32
 	KeysReaped       uint32
 	ReaperCycles     uint32
+	Decays           uint32 // LFU only: times the access counts were halved
+	GhostHits        uint32 // ARC only: writes to keys found in a ghost list
+	AdaptiveTarget   uint32 // ARC only: current target size of the recency list
+	ReadBufferDrains uint32 // read buffers only: buffers applied to the queue
+	ReadBufferDrops  uint32 // read buffers only: accesses dropped because a buffer was full
+
+	PromotionBatches  uint32 // promotion buffer only: times pending moves were applied
+	PromotionsApplied uint32 // promotion buffer only: moves applied from the buffer
+	PromotionsDropped uint32 // promotion buffer only: moves dropped because the buffer was full
+
+	EvictNotesQueued  uint32 // async evict only: notifications handed to the workers
+	EvictNotesDropped uint32 // async evict only: notifications dropped because the queue was full
+
+	StoreLoads   uint32 // backing store only: values loaded after a miss
+	StoreWrites  uint32 // backing store only: writes and deletes sent to the store
+	StoreErrors  uint32 // backing store only: errors returned by the store
+	StoreFlushes uint32 // write-behind only: batches of writes flushed
+
+	WALErrors uint32 // write-ahead log only: records that could not be written
+
+	// EvictionsByPriority breaks down Evictions by the priority of the
+	// evicted item
+	EvictionsByPriority [PriorityHigh + 1]uint32
+}
+
+// load copies the stats, loading each counter atomically. Caches bump some
+// counters under their write lock and some atomically outside of it, so this
+// should be called with at least a read lock.
+func (s *Stats) load() Stats {
+	retval := Stats{
+		KeysWritten:       atomic.LoadUint32(&s.KeysWritten),
+		KeysReadOK:        atomic.LoadUint32(&s.KeysReadOK),
+		KeysReadNotFound:  atomic.LoadUint32(&s.KeysReadNotFound),
+		KeysReadExpired:   atomic.LoadUint32(&s.KeysReadExpired),
+		Shuffles:          atomic.LoadUint32(&s.Shuffles),
+		Evictions:         atomic.LoadUint32(&s.Evictions),
+		KeysReaped:        atomic.LoadUint32(&s.KeysReaped),
+		ReaperCycles:      atomic.LoadUint32(&s.ReaperCycles),
+		Decays:            atomic.LoadUint32(&s.Decays),
+		GhostHits:         atomic.LoadUint32(&s.GhostHits),
+		AdaptiveTarget:    atomic.LoadUint32(&s.AdaptiveTarget),
+		ReadBufferDrains:  atomic.LoadUint32(&s.ReadBufferDrains),
+		ReadBufferDrops:   atomic.LoadUint32(&s.ReadBufferDrops),
+		PromotionBatches:  atomic.LoadUint32(&s.PromotionBatches),
+		PromotionsApplied: atomic.LoadUint32(&s.PromotionsApplied),
+		PromotionsDropped: atomic.LoadUint32(&s.PromotionsDropped),
+		EvictNotesQueued:  atomic.LoadUint32(&s.EvictNotesQueued),
+		EvictNotesDropped: atomic.LoadUint32(&s.EvictNotesDropped),
+		StoreLoads:        atomic.LoadUint32(&s.StoreLoads),
+		StoreWrites:       atomic.LoadUint32(&s.StoreWrites),
+		StoreErrors:       atomic.LoadUint32(&s.StoreErrors),
+		StoreFlushes:      atomic.LoadUint32(&s.StoreFlushes),
+		WALErrors:         atomic.LoadUint32(&s.WALErrors),
+	}
+	for p := range retval.EvictionsByPriority {
+		retval.EvictionsByPriority[p] = atomic.LoadUint32(&s.EvictionsByPriority[p])
+	}
+	return retval
 }
@@ -0,0 +1,367 @@
+package lazylru
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Store is a persistent store that the cache can front. See UseWriteThrough
+// and UseWriteBehind.
+type Store[K comparable, V any] interface {
+	// Load reads a value from the store. The returned bool indicates whether
+	// the key was found.
+	Load(ctx context.Context, key K) (V, bool, error)
+	// Store writes a value to the store
+	Store(ctx context.Context, key K, value V) error
+	// Delete removes a value from the store. Deleting a key that is not in the
+	// store is not an error.
+	Delete(ctx context.Context, key K) error
+}
+
+// dirtyEntry is a write that has not been flushed to the store yet
+type dirtyEntry[V any] struct {
+	value   V
+	deleted bool
+}
+
+// backing connects the cache to a store
+type backing[K comparable, V any] struct {
+	store       Store[K, V]
+	keys        keyLocks[K]         // keeps writers of one key from overtaking each other
+	dirty       map[K]dirtyEntry[V] // write-behind only: writes waiting to be flushed
+	flushing    map[K]dirtyEntry[V] // write-behind only: writes being sent to the store
+	kick        chan struct{}       // write-behind only: asks for an early flush
+	doneCh      chan struct{}       // write-behind only: stops the flusher
+	stoppedCh   chan struct{}       // write-behind only: closed when the flusher is gone
+	batchSize   int
+	mu          sync.Mutex // guards dirty and flushing
+	flushMu     sync.Mutex // keeps flushes in order
+	stopOnce    sync.Once
+	writeBehind bool
+}
+
+// UseWriteThrough makes the cache front a persistent store. Writes go to the
+// store before they go to the cache, and if the store returns an error, the
+// cache is not changed. Deletes are passed along to the store. Reads that miss
+// in the cache are loaded from the store and added to the cache. Writes to the
+// same key are applied to the store and the cache in the same order.
+//
+// Set and Delete have no way to return an error, so store errors from those
+// are only counted in Stats().StoreErrors. Use SetCtx to see them. MSet and
+// MSetTTL write one key at a time and stop at the first store error, which
+// they return; the keys before it have been written to both the store and the
+// cache, and the rest to neither.
+func (lru *LazyLRU[K, V]) UseWriteThrough(store Store[K, V]) {
+	lru.useBacking(&backing[K, V]{store: store})
+}
+
+// UseWriteBehind makes the cache front a persistent store, like
+// UseWriteThrough, except that writes and deletes are queued rather than sent
+// to the store right away. Repeated writes to the same key are coalesced, so
+// only the latest value is stored. The queue is flushed every flushInterval, or
+// sooner if batchSize keys are waiting. A write that evicts an item that has
+// not been flushed yet flushes that item before it returns, and Close and
+// CloseContext flush everything that is left.
+//
+// If the store returns an error during a flush, the write is counted in
+// Stats().StoreErrors and retried in the next flush, unless the key has been
+// written again since.
+func (lru *LazyLRU[K, V]) UseWriteBehind(store Store[K, V], flushInterval time.Duration, batchSize int) {
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+	b := &backing[K, V]{
+		store:       store,
+		dirty:       map[K]dirtyEntry[V]{},
+		kick:        make(chan struct{}, 1),
+		doneCh:      make(chan struct{}),
+		stoppedCh:   make(chan struct{}),
+		batchSize:   max(batchSize, 1),
+		writeBehind: true,
+	}
+	lru.useBacking(b)
+	go lru.flusher(b, flushInterval)
+}
+
+func (lru *LazyLRU[K, V]) useBacking(b *backing[K, V]) {
+	if old := lru.backing.Swap(b); old != nil {
+		_ = lru.stopBacking(context.Background(), old)
+	}
+}
+
+// flusher writes the queued writes to the store in the background
+func (lru *LazyLRU[K, V]) flusher(b *backing[K, V], flushInterval time.Duration) {
+	defer close(b.stoppedCh)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.doneCh:
+			return
+		case <-ticker.C:
+		case <-b.kick:
+		}
+		_ = lru.flush(context.Background(), b)
+	}
+}
+
+// stopBacking stops the flusher and flushes anything that is left
+func (lru *LazyLRU[K, V]) stopBacking(ctx context.Context, b *backing[K, V]) error {
+	if !b.writeBehind {
+		return nil
+	}
+	b.stopOnce.Do(func() { close(b.doneCh) })
+	select {
+	case <-b.stoppedCh:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return lru.flush(ctx, b)
+}
+
+// Flush writes any queued writes to the store. This only does anything in
+// write-behind mode.
+func (lru *LazyLRU[K, V]) Flush(ctx context.Context) error {
+	if b := lru.backing.Load(); b != nil && b.writeBehind {
+		return lru.flush(ctx, b)
+	}
+	return nil
+}
+
+// flush writes all of the dirty entries to the store, returning the first
+// error. Entries that fail are put back unless they have been written since.
+func (lru *LazyLRU[K, V]) flush(ctx context.Context, b *backing[K, V]) error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+	b.mu.Lock()
+	batch := b.dirty
+	b.dirty = make(map[K]dirtyEntry[V], len(batch))
+	// load keeps finding these until they are in the store
+	b.flushing = batch
+	b.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	var firstErr error
+	for key, entry := range batch {
+		err := lru.writeEntry(ctx, b, key, entry)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		b.doneFlushing(key, entry, err)
+	}
+	atomic.AddUint32(&lru.stats.StoreFlushes, 1)
+	return firstErr
+}
+
+// flushEvicted writes any evicted items that have not been flushed yet, so
+// that the only copy isn't lost
+func (lru *LazyLRU[K, V]) flushEvicted(ctx context.Context, deathList []*item[K, V]) {
+	b := lru.backing.Load()
+	if b == nil || !b.writeBehind || len(deathList) == 0 {
+		return
+	}
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+	for _, pqi := range deathList {
+		b.mu.Lock()
+		entry, ok := b.dirty[pqi.key]
+		if ok {
+			delete(b.dirty, pqi.key)
+			if b.flushing == nil {
+				b.flushing = map[K]dirtyEntry[V]{}
+			}
+			b.flushing[pqi.key] = entry
+		}
+		b.mu.Unlock()
+		if ok {
+			// if this fails, we tried; it is left for the next flush
+			b.doneFlushing(pqi.key, entry, lru.writeEntry(ctx, b, pqi.key, entry))
+		}
+	}
+}
+
+// doneFlushing stops showing a flushed write to load. If the write failed, it
+// is queued again, unless the key has been written since.
+func (b *backing[K, V]) doneFlushing(key K, entry dirtyEntry[V], err error) {
+	b.mu.Lock()
+	delete(b.flushing, key)
+	if _, ok := b.dirty[key]; err != nil && !ok {
+		b.dirty[key] = entry
+	}
+	b.mu.Unlock()
+}
+
+// writeEntry sends a single write or delete to the store
+func (lru *LazyLRU[K, V]) writeEntry(ctx context.Context, b *backing[K, V], key K, entry dirtyEntry[V]) error {
+	var err error
+	if entry.deleted {
+		err = b.store.Delete(ctx, key)
+	} else {
+		err = b.store.Store(ctx, key, entry.value)
+	}
+	if err != nil {
+		atomic.AddUint32(&lru.stats.StoreErrors, 1)
+		return err
+	}
+	atomic.AddUint32(&lru.stats.StoreWrites, 1)
+	return nil
+}
+
+// storeWrite writes through to the store or queues the write, depending on
+// the mode. Unless there is an error, the key is left locked against other
+// writers; the caller writes the cache, then passes the returned lock to
+// unlock, so that the store and the cache apply writes in the same order.
+func (lru *LazyLRU[K, V]) storeWrite(ctx context.Context, key K, entry dirtyEntry[V]) (*keyLock[K], error) {
+	b := lru.backing.Load()
+	if b == nil {
+		return nil, nil
+	}
+	kl, err := b.keys.lock(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !b.writeBehind {
+		if err := lru.writeEntry(ctx, b, key, entry); err != nil {
+			kl.unlock()
+			return nil, err
+		}
+		return kl, nil
+	}
+	b.mu.Lock()
+	b.dirty[key] = entry
+	full := len(b.dirty) >= b.batchSize
+	b.mu.Unlock()
+	if full {
+		select {
+		case b.kick <- struct{}{}:
+		default: // a flush is already coming
+		}
+	}
+	return kl, nil
+}
+
+// getThrough reads from the cache, then from the store on a miss
+func (lru *LazyLRU[K, V]) getThrough(ctx context.Context, key K) (V, bool, error) {
+	v, ok, err := lru.get(ctx, key)
+	if ok || err != nil {
+		return v, ok, err
+	}
+	b := lru.backing.Load()
+	if b == nil {
+		return v, ok, nil
+	}
+	return lru.load(ctx, b, key)
+}
+
+// mgetThrough reads from the cache, then from the store for any misses
+func (lru *LazyLRU[K, V]) mgetThrough(ctx context.Context, keys []K) (map[K]V, error) {
+	retval := make(map[K]V, len(keys))
+	if _, err := lru.mgetEachThrough(ctx, keys, func(i int, v V) { retval[keys[i]] = v }); err != nil {
+		return nil, err
+	}
+	return retval, nil
+}
+
+// mgetEachThrough is mgetEach, then a read from the store for any misses.
+// Without a store, it does not allocate.
+func (lru *LazyLRU[K, V]) mgetEachThrough(ctx context.Context, keys []K, emit func(i int, value V)) (int, error) {
+	b := lru.backing.Load()
+	if b == nil {
+		return lru.mgetEach(ctx, keys, emit)
+	}
+	hit := make([]bool, len(keys))
+	found, err := lru.mgetEach(ctx, keys, func(i int, v V) {
+		hit[i] = true
+		emit(i, v)
+	})
+	if err != nil || found == len(keys) {
+		return found, err
+	}
+	for i, key := range keys {
+		if hit[i] {
+			continue
+		}
+		v, ok, err := lru.load(ctx, b, key)
+		if err != nil {
+			return found, err
+		}
+		if ok {
+			emit(i, v)
+			found++
+		}
+	}
+	return found, nil
+}
+
+// load reads a value from the store, or from the queued writes if it hasn't
+// been flushed yet, and adds it to the cache. The key is locked the whole
+// time, so a write or delete can't land between the read and the add and
+// leave the old value in the cache.
+func (lru *LazyLRU[K, V]) load(ctx context.Context, b *backing[K, V], key K) (V, bool, error) {
+	var value V
+	var found bool
+	kl, err := b.keys.lock(ctx, key)
+	if err != nil {
+		return value, false, err
+	}
+	if b.writeBehind {
+		// a write being flushed may not be in the store yet
+		b.mu.Lock()
+		entry, ok := b.dirty[key]
+		if !ok {
+			entry, ok = b.flushing[key]
+		}
+		b.mu.Unlock()
+		if ok && entry.deleted {
+			kl.unlock()
+			return value, false, nil
+		}
+		value, found = entry.value, ok
+	}
+	if !found {
+		value, found, err = b.store.Load(ctx, key)
+		if err != nil {
+			kl.unlock()
+			atomic.AddUint32(&lru.stats.StoreErrors, 1)
+			return value, false, err
+		}
+		if !found {
+			kl.unlock()
+			return value, false, nil
+		}
+		atomic.AddUint32(&lru.stats.StoreLoads, 1)
+	}
+
+	return lru.addIfAbsent(ctx, key, value, time.Now().Add(lru.ttl), kl), true, nil
+}
+
+// addIfAbsent caches a value that was found elsewhere, unless the key has been
+// written in the meantime, in which case the newer value is returned. The key
+// lock, if any, is released once the cache has been written.
+func (lru *LazyLRU[K, V]) addIfAbsent(ctx context.Context, key K, value V, expiration time.Time, kl *keyLock[K]) V {
+	if err := lru.lockContext(ctx); err != nil {
+		kl.unlock()
+		// we have the value, even if we can't cache it
+		return value
+	}
+	if lru.isClosed {
+		lru.lock.Unlock()
+		kl.unlock()
+		return value
+	}
+	var deathList []*item[K, V]
+	if pqi, ok := lru.index[key]; ok {
+		// someone beat us to it, and theirs is newer
+		value = pqi.value
+	} else {
+		deathList = lru.setInternal(key, value, expiration, PriorityNormal, nil)
+	}
+	lru.lock.Unlock()
+	kl.unlock()
+	lru.afterEvict(ctx, deathList)
+	return value
+}
@@ -0,0 +1,359 @@
+package lazylru_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+var errStoreDown = errors.New("store is down")
+
+// mapStore is a Store backed by a map that can be told to fail
+type mapStore struct {
+	data   map[string]int
+	writes []string
+	mu     sync.Mutex
+	fail   bool
+	// if set, Store calls these before and after storing the value
+	beforeStore func(ctx context.Context) error
+	afterStore  func(key string, value int)
+	// if set, Load calls this after reading the value and before returning it
+	afterLoad func()
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{data: map[string]int{}}
+}
+
+func (ms *mapStore) Load(_ context.Context, key string) (int, bool, error) {
+	ms.mu.Lock()
+	if ms.fail {
+		ms.mu.Unlock()
+		return 0, false, errStoreDown
+	}
+	v, ok := ms.data[key]
+	ms.mu.Unlock()
+	if ms.afterLoad != nil {
+		ms.afterLoad()
+	}
+	return v, ok, nil
+}
+
+func (ms *mapStore) Store(ctx context.Context, key string, value int) error {
+	if ms.beforeStore != nil {
+		if err := ms.beforeStore(ctx); err != nil {
+			return err
+		}
+	}
+	ms.mu.Lock()
+	if ms.fail {
+		ms.mu.Unlock()
+		return errStoreDown
+	}
+	ms.data[key] = value
+	ms.writes = append(ms.writes, key)
+	ms.mu.Unlock()
+	if ms.afterStore != nil {
+		ms.afterStore(key, value)
+	}
+	return nil
+}
+
+func (ms *mapStore) Delete(_ context.Context, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.fail {
+		return errStoreDown
+	}
+	delete(ms.data, key)
+	ms.writes = append(ms.writes, "-"+key)
+	return nil
+}
+
+func (ms *mapStore) get(key string) (int, bool) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	v, ok := ms.data[key]
+	return v, ok
+}
+
+// gate makes Store wait until the returned channel is closed. Each Store that
+// starts waiting is announced on entered, if it is not nil.
+func (ms *mapStore) gate(entered chan<- struct{}) chan struct{} {
+	gate := make(chan struct{})
+	ms.beforeStore = func(ctx context.Context) error {
+		if entered != nil {
+			entered <- struct{}{}
+		}
+		select {
+		case <-gate:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return gate
+}
+
+func (ms *mapStore) setFail(fail bool) {
+	ms.mu.Lock()
+	ms.fail = fail
+	ms.mu.Unlock()
+}
+
+func TestWriteThrough(t *testing.T) {
+	store := newMapStore()
+	store.data["stored"] = 7
+	lru := lazylru.NewT[string, int](2, time.Hour)
+	defer lru.Close()
+	lru.UseWriteThrough(store)
+
+	lru.Set("a", 1)
+	v, ok := store.get("a")
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+
+	// misses are loaded and cached
+	v, ok = lru.Get("stored")
+	require.True(t, ok)
+	require.Equal(t, 7, v)
+	require.Equal(t, 2, lru.Len())
+	require.Equal(t, map[string]int{"a": 1, "stored": 7}, lru.MGet("a", "stored", "missing"))
+
+	lru.Delete("a")
+	_, ok = store.get("a")
+	require.False(t, ok)
+
+	// errors keep the cache out of it
+	store.setFail(true)
+	require.ErrorIs(t, lru.SetCtx(context.Background(), "b", 2), errStoreDown)
+	_, ok = lru.Get("b")
+	require.False(t, ok)
+	_, _, err := lru.GetCtx(context.Background(), "c")
+	require.ErrorIs(t, err, errStoreDown)
+
+	stats := lru.Stats()
+	require.Equal(t, uint32(1), stats.StoreLoads)
+	require.Equal(t, uint32(2), stats.StoreWrites)
+	require.Equal(t, uint32(3), stats.StoreErrors)
+}
+
+func TestWriteBehindCoalesces(t *testing.T) {
+	store := newMapStore()
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	lru.UseWriteBehind(store, time.Hour, 100)
+
+	lru.Set("a", 1)
+	lru.Set("a", 2)
+	lru.Set("b", 1)
+	lru.Delete("b")
+	_, ok := store.get("a")
+	require.False(t, ok, "nothing should be written before a flush")
+
+	require.NoError(t, lru.Flush(context.Background()))
+	v, ok := store.get("a")
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+	require.ElementsMatch(t, []string{"a", "-b"}, store.writes)
+
+	lru.Set("c", 3)
+	lru.Close() // flushes
+	v, ok = store.get("c")
+	require.True(t, ok)
+	require.Equal(t, 3, v)
+	require.Equal(t, uint32(2), lru.Stats().StoreFlushes)
+}
+
+func TestWriteBehindBatchSize(t *testing.T) {
+	store := newMapStore()
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	defer lru.Close()
+	lru.UseWriteBehind(store, time.Hour, 2)
+	lru.Set("a", 1)
+	lru.Set("b", 2)
+	require.Eventually(t, func() bool {
+		_, okA := store.get("a")
+		_, okB := store.get("b")
+		return okA && okB
+	}, time.Second, time.Millisecond)
+}
+
+func TestWriteBehindFlushesEvicted(t *testing.T) {
+	store := newMapStore()
+	lru := lazylru.NewT[string, int](1, time.Hour)
+	defer lru.Close()
+	lru.UseWriteBehind(store, time.Hour, 100)
+	lru.Set("a", 1)
+	_, ok := store.get("a")
+	require.False(t, ok)
+
+	lru.Set("b", 2) // evicts "a", which must not be lost
+	v, ok := store.get("a")
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+	_, ok = store.get("b")
+	require.False(t, ok)
+
+	// and reading it again finds it in the store
+	v, ok = lru.Get("a")
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+}
+
+func TestWriteBehindLoadsUnflushed(t *testing.T) {
+	store := newMapStore()
+	store.data["a"] = 1
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	defer lru.Close()
+	lru.UseWriteBehind(store, time.Hour, 100)
+	lru.Set("b", 2)
+	lru.Delete("a")
+	// the cache doesn't have either, but the queue knows better than the store
+	store.setFail(true)
+	_, ok := lru.Get("a")
+	require.False(t, ok)
+	v, ok := lru.Get("b")
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+}
+
+func TestWriteBehindRetries(t *testing.T) {
+	store := newMapStore()
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	defer lru.Close()
+	lru.UseWriteBehind(store, time.Hour, 100)
+	lru.Set("a", 1)
+	store.setFail(true)
+	require.ErrorIs(t, lru.Flush(context.Background()), errStoreDown)
+	store.setFail(false)
+	require.NoError(t, lru.Flush(context.Background()))
+	v, ok := store.get("a")
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+	require.Equal(t, uint32(1), lru.Stats().StoreErrors)
+}
+
+func TestWriteThroughKeepsWritesInOrder(t *testing.T) {
+	store := newMapStore()
+	stored, release := make(chan struct{}), make(chan struct{})
+	store.afterStore = func(_ string, value int) {
+		if value == 1 {
+			close(stored)
+			<-release
+		}
+	}
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	defer lru.Close()
+	lru.UseWriteThrough(store)
+
+	// the first writer has written the store but not yet the cache
+	firstDone := make(chan struct{})
+	go func() {
+		defer close(firstDone)
+		lru.Set("a", 1)
+	}()
+	<-stored
+	secondDone := make(chan struct{})
+	go func() {
+		defer close(secondDone)
+		lru.Set("a", 2)
+	}()
+	select {
+	case <-secondDone:
+		t.Fatal("the second write should wait for the first to reach the cache")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-firstDone
+	<-secondDone
+
+	v, ok := lru.Get("a")
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+	v, _ = store.get("a")
+	require.Equal(t, 2, v)
+}
+
+func TestWriteBehindLoadsFlushing(t *testing.T) {
+	store := newMapStore()
+	store.data["a"] = 1
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	defer lru.Close()
+	lru.UseWriteBehind(store, time.Hour, 100)
+	lru.SetTTL("a", 2, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	// the store is slow, so the flush is still writing "a" when it is read
+	// again, and the store still has the old value
+	entered := make(chan struct{})
+	gate := store.gate(entered)
+	flushed := make(chan error)
+	go func() { flushed <- lru.Flush(context.Background()) }()
+	<-entered
+	v, ok := lru.Get("a")
+	stored, _ := store.get("a")
+	close(gate)
+	require.NoError(t, <-flushed)
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+	require.Equal(t, 1, stored)
+	stored, _ = store.get("a")
+	require.Equal(t, 2, stored)
+}
+
+func TestWriteThroughDeleteError(t *testing.T) {
+	store := newMapStore()
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	defer lru.Close()
+	lru.UseWriteThrough(store)
+	lru.Set("a", 1)
+	store.setFail(true)
+	lru.Delete("a")
+	v, ok := lru.Get("a")
+	require.True(t, ok, "the cache should keep what the store still has")
+	require.Equal(t, 1, v)
+	store.setFail(false)
+}
+
+func TestLoadDoesNotBringBackDeleted(t *testing.T) {
+	store := newMapStore()
+	store.data["a"] = 1
+	entered := make(chan struct{})
+	gate := make(chan struct{})
+	store.afterLoad = func() {
+		entered <- struct{}{}
+		<-gate
+	}
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	defer lru.Close()
+	lru.UseWriteThrough(store)
+
+	loaded := make(chan int)
+	go func() {
+		v, _ := lru.Get("a")
+		loaded <- v
+	}()
+	<-entered
+	store.afterLoad = nil
+	deleted := make(chan struct{})
+	go func() {
+		lru.Delete("a")
+		close(deleted)
+	}()
+	// give the delete every chance to finish while the load is stuck
+	select {
+	case <-deleted:
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(gate)
+	require.Equal(t, 1, <-loaded)
+	<-deleted
+
+	_, ok := lru.Get("a")
+	require.False(t, ok, "the deleted value came back")
+}
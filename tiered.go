@@ -0,0 +1,180 @@
+package lazylru
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// L2 is the second tier of a Tiered cache. It is usually bigger and slower
+// than the LazyLRU in front of it. Implementations must be safe for concurrent
+// use and are expected to bound their own size.
+type L2[K comparable, V any] interface {
+	// Get reads a value and the time it expires. The returned bool indicates
+	// whether the key was found. Expired values may be returned; the caller
+	// checks the expiration.
+	Get(key K) (V, time.Time, bool, error)
+	// Set writes a value that expires at the given time
+	Set(key K, value V, expiration time.Time) error
+	// Delete removes a value. Deleting a key that is not there is not an error.
+	Delete(key K) error
+	// Len returns the number of values held
+	Len() int
+	// Close releases any resources held
+	Close() error
+}
+
+// TieredStats represents counts of actions against a tiered cache
+type TieredStats struct {
+	L1         Stats  // the stats of the LazyLRU in front
+	L1Hits     uint32 // reads found in the first tier
+	L2Hits     uint32 // reads missed in the first tier and found in the second
+	Misses     uint32 // reads found in neither tier
+	Demotions  uint32 // items evicted from the first tier and written to the second
+	Promotions uint32 // items moved from the second tier back to the first
+	L2Errors   uint32 // errors returned by the second tier
+}
+
+// Tiered is a two-tier cache. Items that are evicted from the first tier to
+// make room for others are demoted to the second tier rather than being thrown
+// away. Reads that miss in the first tier look in the second, and any item
+// found there is promoted back to the first tier. Items that expire or are
+// deleted from the first tier are not demoted.
+//
+// Reads, writes, and deletes of the same key are applied one at a time, so a
+// deleted or overwritten value can't be promoted or demoted back into either
+// tier.
+type Tiered[K comparable, V any] struct {
+	l1      *LazyLRU[K, V]
+	l2      L2[K, V]
+	keys    keyLocks[K]
+	writing sync.RWMutex // held for reading by writes to l1, which may demote
+	stats   TieredStats
+}
+
+// NewTiered creates a two-tier cache from a LazyLRU and a second tier. The
+// LazyLRU should not be used directly after this, or reads will not look in
+// the second tier and writes will leave stale values there.
+func NewTiered[K comparable, V any](l1 *LazyLRU[K, V], l2 L2[K, V]) *Tiered[K, V] {
+	t := &Tiered[K, V]{l1: l1, l2: l2}
+	l1.lock.Lock()
+	l1.demote = t.demote
+	l1.lock.Unlock()
+	return t
+}
+
+// demote writes an item evicted from the first tier to the second. If the key
+// is busy, whatever is being done to it is newer than this value, so the value
+// is dropped rather than waiting, which could deadlock with the writer that
+// evicted it.
+func (t *Tiered[K, V]) demote(key K, value V, expiration time.Time) {
+	if expiration.Before(time.Now()) {
+		return
+	}
+	kl, ok := t.keys.tryLock(key)
+	if !ok {
+		return
+	}
+	defer kl.unlock()
+	if err := t.l2.Set(key, value, expiration); err != nil {
+		atomic.AddUint32(&t.stats.L2Errors, 1)
+		return
+	}
+	atomic.AddUint32(&t.stats.Demotions, 1)
+}
+
+// Get retrieves a value from the cache, looking in the second tier if it is
+// not in the first. The returned bool indicates whether the key was found in
+// either tier.
+func (t *Tiered[K, V]) Get(key K) (V, bool) {
+	if v, ok := t.l1.Get(key); ok {
+		atomic.AddUint32(&t.stats.L1Hits, 1)
+		return v, true
+	}
+	kl, _ := t.keys.lock(context.Background(), key)
+	defer kl.unlock()
+	v, expiration, ok, err := t.l2.Get(key)
+	if err != nil {
+		atomic.AddUint32(&t.stats.L2Errors, 1)
+	}
+	if !ok || err != nil {
+		atomic.AddUint32(&t.stats.Misses, 1)
+		var zero V
+		return zero, false
+	}
+	// either way, it doesn't belong in the second tier anymore
+	if err := t.l2.Delete(key); err != nil {
+		atomic.AddUint32(&t.stats.L2Errors, 1)
+	}
+	if expiration.Before(time.Now()) {
+		atomic.AddUint32(&t.stats.Misses, 1)
+		var zero V
+		return zero, false
+	}
+	// a write that got to the first tier before us wins
+	t.writing.RLock()
+	v = t.l1.addIfAbsent(context.Background(), key, v, expiration, nil)
+	t.writing.RUnlock()
+	atomic.AddUint32(&t.stats.L2Hits, 1)
+	atomic.AddUint32(&t.stats.Promotions, 1)
+	return v, true
+}
+
+// Set writes to the first tier of the cache
+func (t *Tiered[K, V]) Set(key K, value V) {
+	t.SetTTL(key, value, t.l1.ttl)
+}
+
+// SetTTL writes to the first tier of the cache, expiring with the given
+// time-to-live value. Any older value in the second tier is removed.
+func (t *Tiered[K, V]) SetTTL(key K, value V, ttl time.Duration) {
+	kl, _ := t.keys.lock(context.Background(), key)
+	defer kl.unlock()
+	if err := t.l2.Delete(key); err != nil {
+		atomic.AddUint32(&t.stats.L2Errors, 1)
+	}
+	t.writing.RLock()
+	t.l1.SetTTL(key, value, ttl)
+	t.writing.RUnlock()
+}
+
+// Delete removes a key from both tiers
+func (t *Tiered[K, V]) Delete(key K) {
+	kl, _ := t.keys.lock(context.Background(), key)
+	defer kl.unlock()
+	// An item evicted before we took the key may still be on its way to the
+	// second tier, so wait for the writes that are already under way. Any
+	// later eviction of the key will find it locked and won't demote it.
+	t.writing.Lock()
+	t.writing.Unlock() //nolint:staticcheck // this only waits
+	t.l1.Delete(key)
+	if err := t.l2.Delete(key); err != nil {
+		atomic.AddUint32(&t.stats.L2Errors, 1)
+	}
+}
+
+// Len returns the number of items in both tiers
+func (t *Tiered[K, V]) Len() int {
+	return t.l1.Len() + t.l2.Len()
+}
+
+// Close stops the first tier and closes the second
+func (t *Tiered[K, V]) Close() error {
+	t.l1.Close()
+	return t.l2.Close()
+}
+
+// Stats gets a copy of the stats held by the cache. Note that this is a copy,
+// so returned objects will not update as the service continues to execute.
+func (t *Tiered[K, V]) Stats() TieredStats {
+	return TieredStats{
+		L1:         t.l1.Stats(),
+		L1Hits:     atomic.LoadUint32(&t.stats.L1Hits),
+		L2Hits:     atomic.LoadUint32(&t.stats.L2Hits),
+		Misses:     atomic.LoadUint32(&t.stats.Misses),
+		Demotions:  atomic.LoadUint32(&t.stats.Demotions),
+		Promotions: atomic.LoadUint32(&t.stats.Promotions),
+		L2Errors:   atomic.LoadUint32(&t.stats.L2Errors),
+	}
+}
@@ -0,0 +1,164 @@
+package lazylru_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+func testTiered(t *testing.T, l2 lazylru.L2[int, string]) {
+	tc := lazylru.NewTiered(lazylru.NewT[int, string](2, time.Hour), l2)
+	defer func() { require.NoError(t, tc.Close()) }()
+
+	tc.Set(1, "one")
+	tc.Set(2, "two")
+	tc.Set(3, "three") // demotes 1
+	require.Equal(t, 3, tc.Len())
+	require.Equal(t, 1, l2.Len())
+
+	v, ok := tc.Get(3)
+	require.True(t, ok)
+	require.Equal(t, "three", v)
+
+	v, ok = tc.Get(1) // promotes 1, demoting 2
+	require.True(t, ok)
+	require.Equal(t, "one", v)
+	require.Equal(t, 1, l2.Len())
+
+	_, ok = tc.Get(4)
+	require.False(t, ok)
+
+	// a new value replaces the demoted one
+	tc.Set(2, "deux") // demotes 3
+	v, ok = tc.Get(2)
+	require.True(t, ok)
+	require.Equal(t, "deux", v)
+
+	tc.Delete(3)
+	_, ok = tc.Get(3)
+	require.False(t, ok)
+	require.Equal(t, 0, l2.Len())
+
+	// expired items are not promoted
+	tc.SetTTL(5, "five", 20*time.Millisecond) // demotes 1
+	tc.Set(6, "six")                          // demotes 2
+	tc.Set(7, "seven")                        // demotes 5
+	time.Sleep(30 * time.Millisecond)
+	_, ok = tc.Get(5)
+	require.False(t, ok)
+
+	stats := tc.Stats()
+	require.Equal(t, uint32(2), stats.L1Hits)
+	require.Equal(t, uint32(1), stats.L2Hits)
+	require.Equal(t, uint32(3), stats.Misses)
+	require.Equal(t, uint32(6), stats.Demotions)
+	require.Equal(t, uint32(1), stats.Promotions)
+	require.Equal(t, uint32(0), stats.L2Errors)
+}
+
+func TestTieredCompressed(t *testing.T) {
+	testTiered(t, lazylru.NewCompressedL2[int, string](10))
+}
+
+func TestTieredFile(t *testing.T) {
+	dir := t.TempDir()
+	l2, err := lazylru.NewFileL2[int, string](dir, 10)
+	require.NoError(t, err)
+	testTiered(t, l2)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries, "Close should remove the files")
+}
+
+func TestFileL2Bounded(t *testing.T) {
+	l2, err := lazylru.NewFileL2[int, int](t.TempDir(), 2)
+	require.NoError(t, err)
+	defer l2.Close()
+	expiration := time.Now().Add(time.Hour)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, l2.Set(i, i, expiration))
+	}
+	require.Equal(t, 2, l2.Len())
+	_, _, ok, err := l2.Get(0)
+	require.NoError(t, err)
+	require.False(t, ok)
+	v, exp, ok, err := l2.Get(4)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 4, v)
+	require.True(t, exp.Equal(expiration.Round(0)))
+}
+
+func TestFileL2SetErrorLeavesNoFile(t *testing.T) {
+	dir := t.TempDir()
+	// gob can't encode functions
+	l2, err := lazylru.NewFileL2[int, func()](dir, 2)
+	require.NoError(t, err)
+	defer l2.Close()
+	require.Error(t, l2.Set(1, func() {}, time.Now().Add(time.Hour)))
+	require.Equal(t, 0, l2.Len())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	files, err := os.ReadDir(filepath.Join(dir, entries[0].Name()))
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+// gatedL2 is an L2 whose Get waits, after reading, until it is let go
+type gatedL2[K comparable, V any] struct {
+	lazylru.L2[K, V]
+	entered chan struct{}
+	gate    chan struct{}
+}
+
+func (g *gatedL2[K, V]) Get(key K) (V, time.Time, bool, error) {
+	v, expiration, ok, err := g.L2.Get(key)
+	g.entered <- struct{}{}
+	<-g.gate
+	return v, expiration, ok, err
+}
+
+func TestTieredDeleteDuringPromotion(t *testing.T) {
+	l2 := &gatedL2[int, string]{
+		L2:      lazylru.NewCompressedL2[int, string](10),
+		entered: make(chan struct{}),
+		gate:    make(chan struct{}),
+	}
+	tc := lazylru.NewTiered(lazylru.NewT[int, string](1, time.Hour), l2)
+	defer func() { require.NoError(t, tc.Close()) }()
+	tc.Set(1, "one")
+	tc.Set(2, "two") // demotes 1
+
+	promoted := make(chan string)
+	go func() {
+		v, _ := tc.Get(1)
+		promoted <- v
+	}()
+	<-l2.entered
+	deleted := make(chan struct{})
+	go func() {
+		tc.Delete(1)
+		close(deleted)
+	}()
+	// give the delete every chance to finish while the promotion is stuck
+	select {
+	case <-deleted:
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(l2.gate)
+	require.Equal(t, "one", <-promoted)
+	<-deleted
+
+	go func() {
+		for range l2.entered {
+		}
+	}()
+	_, ok := tc.Get(1)
+	close(l2.entered)
+	require.False(t, ok, "the deleted value came back")
+}
@@ -0,0 +1,442 @@
+package lazylru
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// SyncPolicy decides how often the write-ahead log is flushed to stable
+// storage. Writes that have not been flushed can be lost if the machine
+// crashes, but not if only the process does.
+type SyncPolicy uint8
+
+const (
+	// SyncAlways flushes every write before the cache write returns
+	SyncAlways SyncPolicy = iota
+	// SyncInterval flushes in the background on a fixed interval
+	SyncInterval
+	// SyncNever leaves flushing to the operating system
+	SyncNever
+)
+
+// Each record in the log is a checksum, the length of the rest of the record,
+// and then the rest of the record. The checksum covers the length and the
+// body, so a torn write at the end of the log is detected on recovery.
+//
+//	crc32 (4) | length (4) | op (1) | priority (1) | expiration (8) | key length (4) | key | value
+const (
+	walHeaderSize = 4 + 4
+	walBodyHeader = 1 + 1 + 8 + 4
+	walMaxRecord  = 1 << 30
+)
+
+const (
+	walOpSet       byte = 1
+	walOpDelete    byte = 2
+	walOpSetPinned byte = 3
+	walOpUnpin     byte = 4
+)
+
+var errWALCorrupt = errors.New("corrupt write-ahead log record")
+
+var walCRC = crc32.MakeTable(crc32.Castagnoli)
+
+// walRecord is a single write or delete
+type walRecord[K comparable, V any] struct {
+	expiration time.Time
+	key        K
+	value      V
+	op         byte
+	priority   Priority
+}
+
+// WAL is a write-ahead log of the writes and deletes made to a cache. Along
+// with Snapshot, it lets Recover rebuild a cache after a restart without losing
+// recent writes. Keys and values must be encodable with encoding/gob.
+type WAL[K comparable, V any] struct {
+	file     *os.File
+	w        *bufio.Writer
+	doneCh   chan struct{}
+	stopped  chan struct{}
+	policy   SyncPolicy
+	lock     sync.Mutex
+	stopOnce sync.Once // concurrent calls to Close must not both stop the syncer
+}
+
+// OpenWAL opens a write-ahead log, creating it if needed. Any damaged records
+// at the end of an existing log are cut off so that new records can follow the
+// last good one. With SyncInterval, the log is flushed every interval.
+func OpenWAL[K comparable, V any](path string, policy SyncPolicy, interval time.Duration) (*WAL[K, V], error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600) //nolint:gosec // the caller picks the path
+	if err != nil {
+		return nil, err
+	}
+	good, err := replayWAL[K, V](file, func(walRecord[K, V]) {})
+	if err == nil {
+		err = file.Truncate(good)
+	}
+	if err == nil {
+		_, err = file.Seek(good, io.SeekStart)
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	wal := &WAL[K, V]{
+		file:   file,
+		w:      bufio.NewWriter(file),
+		policy: policy,
+	}
+	if policy == SyncInterval {
+		if interval <= 0 {
+			interval = time.Second
+		}
+		wal.doneCh = make(chan struct{})
+		wal.stopped = make(chan struct{})
+		go wal.syncer(interval)
+	}
+	return wal, nil
+}
+
+func (wal *WAL[K, V]) syncer(interval time.Duration) {
+	defer close(wal.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-wal.doneCh:
+			return
+		case <-ticker.C:
+			_ = wal.Sync()
+		}
+	}
+}
+
+// append writes a record to the log, flushing it if the policy says to
+func (wal *WAL[K, V]) append(rec walRecord[K, V]) error {
+	data, err := encodeWALRecord(rec)
+	if err != nil {
+		return err
+	}
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	if wal.file == nil {
+		return ErrClosed
+	}
+	if _, err := wal.w.Write(data); err != nil {
+		return err
+	}
+	if wal.policy != SyncAlways {
+		// get it to the OS so that a crash of the process doesn't lose it
+		return wal.w.Flush()
+	}
+	if err := wal.w.Flush(); err != nil {
+		return err
+	}
+	return wal.file.Sync()
+}
+
+// Sync flushes the log to stable storage
+func (wal *WAL[K, V]) Sync() error {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	if wal.file == nil {
+		return ErrClosed
+	}
+	if err := wal.w.Flush(); err != nil {
+		return err
+	}
+	return wal.file.Sync()
+}
+
+// truncate empties the log once its records are covered by a snapshot
+func (wal *WAL[K, V]) truncate() error {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	if wal.file == nil {
+		return ErrClosed
+	}
+	wal.w.Reset(wal.file)
+	if err := wal.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := wal.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return wal.file.Sync()
+}
+
+// Close flushes and closes the log. Closing the cache does not close its log.
+// This is safe to call multiple times, even at the same time.
+func (wal *WAL[K, V]) Close() error {
+	if wal.doneCh != nil {
+		wal.stopOnce.Do(func() { close(wal.doneCh) })
+		<-wal.stopped
+	}
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+	if wal.file == nil {
+		return nil
+	}
+	err := wal.w.Flush()
+	if err == nil {
+		err = wal.file.Sync()
+	}
+	if cerr := wal.file.Close(); err == nil {
+		err = cerr
+	}
+	wal.file = nil
+	return err
+}
+
+// UseWAL records every write and delete made through Set, SetTTL, MSetTTL,
+// Delete, and their variants in the log. Records are appended while the write
+// lock is held, so the log is in the same order as the cache, but a slow sync
+// policy slows every writer. Evictions and expirations are not logged; Recover
+// works those out again.
+func (lru *LazyLRU[K, V]) UseWAL(wal *WAL[K, V]) {
+	lru.lock.Lock()
+	lru.wal = wal
+	lru.lock.Unlock()
+}
+
+// logWrite appends a write or delete to the log, if there is one. This is NOT
+// thread safe and should always be called with a write lock
+func (lru *LazyLRU[K, V]) logWrite(rec walRecord[K, V]) {
+	if lru.wal == nil {
+		return
+	}
+	if err := lru.wal.append(rec); err != nil {
+		lru.stats.WALErrors++
+	}
+}
+
+// Snapshot writes every item in the cache to a file, oldest first, replacing
+// the file only once the new one is complete. If the cache has a write-ahead
+// log, the log is emptied, since the snapshot covers everything in it. Writers
+// wait while the snapshot is written. Priorities and pins are kept.
+func (lru *LazyLRU[K, V]) Snapshot(path string) error {
+	// the read lock keeps writers, and so the log, still while we work
+	lru.lock.RLock()
+	defer lru.lock.RUnlock()
+	if lru.isClosed {
+		return ErrClosed
+	}
+
+	items := make([]*item[K, V], 0, len(lru.index))
+	for _, pqi := range lru.index {
+		items = append(items, pqi)
+	}
+	slices.SortFunc(items, func(a, b *item[K, V]) int {
+		// pinned items go last so that they are the last to be evicted
+		if a.pinned != b.pinned {
+			if a.pinned {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Compare(a.insertNumber, b.insertNumber)
+	})
+
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600) //nolint:gosec // derived from the caller's path
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		_ = file.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	w := bufio.NewWriter(file)
+	now := time.Now()
+	for _, pqi := range items {
+		if pqi.expiration.Before(now) {
+			continue
+		}
+		op := walOpSet
+		if pqi.pinned {
+			op = walOpSetPinned
+		}
+		data, err := encodeWALRecord(walRecord[K, V]{
+			op:         op,
+			key:        pqi.key,
+			value:      pqi.value,
+			expiration: pqi.expiration,
+			priority:   pqi.priority,
+		})
+		if err != nil {
+			return fail(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return fail(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := file.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if lru.wal != nil {
+		return lru.wal.truncate()
+	}
+	return nil
+}
+
+// Recover rebuilds a cache from a snapshot and a write-ahead log. The snapshot
+// is loaded first, then the log is replayed on top of it. Items whose TTL ran
+// out while the process was down are skipped. Either file may be missing, and
+// damaged records at the end of either are ignored. The returned cache does
+// not log its writes until UseWAL is called.
+func Recover[K comparable, V any](snapshotPath, walPath string, maxItems int, ttl time.Duration) (*LazyLRU[K, V], error) {
+	lru := NewT[K, V](maxItems, ttl)
+	now := time.Now()
+	apply := func(rec walRecord[K, V]) {
+		if rec.op == walOpUnpin {
+			lru.Unpin(rec.key)
+			return
+		}
+		if rec.op == walOpDelete || rec.expiration.Before(now) {
+			// an older value should not outlive a newer one that expired
+			lru.Delete(rec.key)
+			return
+		}
+		ttl := time.Until(rec.expiration)
+		_ = lru.set(context.Background(), rec.key, rec.value, ttl, rec.priority)
+		if rec.op == walOpSetPinned {
+			// this pins the item in place, keeping its priority; past the pin
+			// limit, it stays unpinned
+			_ = lru.SetPinnedTTL(rec.key, rec.value, ttl)
+		}
+	}
+	for _, path := range []string{snapshotPath, walPath} {
+		if path == "" {
+			continue
+		}
+		file, err := os.Open(path) //nolint:gosec // the caller picks the path
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			lru.Close()
+			return nil, err
+		}
+		_, err = replayWAL(file, apply)
+		_ = file.Close()
+		if err != nil {
+			lru.Close()
+			return nil, err
+		}
+	}
+	// the recovery isn't what anybody will want to measure
+	lru.lock.Lock()
+	lru.stats = Stats{}
+	lru.lock.Unlock()
+	return lru, nil
+}
+
+// replayWAL reads records from the start of the file until the end or the
+// first damaged record, returning the offset just past the last good record
+func replayWAL[K comparable, V any](file *os.File, apply func(walRecord[K, V])) (int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(file)
+	var offset int64
+	for {
+		rec, n, err := readWALRecord[K, V](r)
+		if err != nil {
+			// io.EOF is a clean end; anything else is a torn or damaged tail
+			return offset, nil
+		}
+		apply(rec)
+		offset += n
+	}
+}
+
+func encodeWALRecord[K comparable, V any](rec walRecord[K, V]) ([]byte, error) {
+	kdata, err := GobCodec[K]{}.Encode(rec.key)
+	if err != nil {
+		return nil, err
+	}
+	var vdata []byte
+	if rec.op == walOpSet || rec.op == walOpSetPinned {
+		if vdata, err = (GobCodec[V]{}).Encode(rec.value); err != nil {
+			return nil, err
+		}
+	}
+	bodyLen := walBodyHeader + len(kdata) + len(vdata)
+	data := make([]byte, walHeaderSize+bodyLen)
+	binary.BigEndian.PutUint32(data[4:], uint32(bodyLen))
+	body := data[walHeaderSize:]
+	body[0] = rec.op
+	body[1] = byte(rec.priority)
+	binary.BigEndian.PutUint64(body[2:], uint64(rec.expiration.UnixNano()))
+	binary.BigEndian.PutUint32(body[10:], uint32(len(kdata)))
+	copy(body[walBodyHeader:], kdata)
+	copy(body[walBodyHeader+len(kdata):], vdata)
+	binary.BigEndian.PutUint32(data, crc32.Checksum(data[4:], walCRC))
+	return data, nil
+}
+
+func readWALRecord[K comparable, V any](r io.Reader) (walRecord[K, V], int64, error) {
+	var rec walRecord[K, V]
+	var header [walHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return rec, 0, io.EOF
+		}
+		return rec, 0, errWALCorrupt
+	}
+	bodyLen := binary.BigEndian.Uint32(header[4:])
+	if bodyLen < walBodyHeader || bodyLen > walMaxRecord {
+		return rec, 0, errWALCorrupt
+	}
+	body := make([]byte, bodyLen)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return rec, 0, errWALCorrupt
+	}
+	crc := crc32.Update(crc32.Checksum(header[4:], walCRC), walCRC, body)
+	if crc != binary.BigEndian.Uint32(header[:4]) {
+		return rec, 0, errWALCorrupt
+	}
+	rec.op = body[0]
+	rec.priority = min(Priority(body[1]), PriorityHigh)
+	rec.expiration = time.Unix(0, int64(binary.BigEndian.Uint64(body[2:])))
+	klen := binary.BigEndian.Uint32(body[10:])
+	if uint64(klen) > uint64(bodyLen-walBodyHeader) {
+		return rec, 0, errWALCorrupt
+	}
+	var err error
+	if rec.key, err = (GobCodec[K]{}).Decode(body[walBodyHeader : walBodyHeader+klen]); err != nil {
+		return rec, 0, errWALCorrupt
+	}
+	switch rec.op {
+	case walOpSet, walOpSetPinned:
+		if rec.value, err = (GobCodec[V]{}).Decode(body[walBodyHeader+klen:]); err != nil {
+			return rec, 0, errWALCorrupt
+		}
+	case walOpDelete, walOpUnpin:
+	default:
+		return rec, 0, errWALCorrupt
+	}
+	return rec, int64(walHeaderSize + bodyLen), nil
+}
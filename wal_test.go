@@ -0,0 +1,248 @@
+package lazylru_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	lazylru "github.com/TriggerMail/lazylru"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWALRecover(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "cache.wal")
+	wal, err := lazylru.OpenWAL[string, int](walPath, lazylru.SyncAlways, 0)
+	require.NoError(t, err)
+
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	lru.UseWAL(wal)
+	lru.Set("a", 1)
+	lru.SetTTL("b", 2, time.Minute)
+	require.NoError(t, lru.MSet([]string{"c", "d"}, []int{3, 4}))
+	lru.Set("a", 5)
+	lru.Delete("c")
+	lru.Close()
+	require.NoError(t, wal.Close())
+
+	lru2, err := lazylru.Recover[string, int]("", walPath, 10, time.Hour)
+	require.NoError(t, err)
+	defer lru2.Close()
+	require.Equal(t, 3, lru2.Len())
+	for key, expected := range map[string]int{"a": 5, "b": 2, "d": 4} {
+		v, ok := lru2.Get(key)
+		require.True(t, ok, key)
+		require.Equal(t, expected, v, key)
+	}
+	_, ok := lru2.Get("c")
+	require.False(t, ok)
+	require.Equal(t, uint32(0), lru2.Stats().KeysWritten)
+}
+
+func TestWALSkipsExpired(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "cache.wal")
+	wal, err := lazylru.OpenWAL[string, int](walPath, lazylru.SyncNever, 0)
+	require.NoError(t, err)
+
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	lru.UseWAL(wal)
+	lru.Set("a", 1)
+	lru.SetTTL("b", 2, 10*time.Millisecond)
+	lru.Close()
+	require.NoError(t, wal.Close())
+
+	// the process is "down" long enough for b to expire
+	time.Sleep(20 * time.Millisecond)
+
+	lru2, err := lazylru.Recover[string, int]("", walPath, 10, time.Hour)
+	require.NoError(t, err)
+	defer lru2.Close()
+	require.Equal(t, 1, lru2.Len())
+	_, ok := lru2.Get("b")
+	require.False(t, ok)
+}
+
+func TestWALSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "cache.wal")
+	snapPath := filepath.Join(dir, "cache.snap")
+	wal, err := lazylru.OpenWAL[string, int](walPath, lazylru.SyncInterval, time.Millisecond)
+	require.NoError(t, err)
+
+	lru := lazylru.NewT[string, int](3, time.Hour)
+	lru.UseWAL(wal)
+	lru.Set("a", 1)
+	lru.Set("b", 2)
+	lru.SetTTLPriority("c", 3, time.Hour, lazylru.PriorityHigh)
+	require.NoError(t, lru.Snapshot(snapPath))
+
+	info, err := os.Stat(walPath)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), info.Size())
+
+	// after the snapshot, only the log has these
+	lru.Set("d", 4)
+	lru.Delete("b")
+	lru.Close()
+	require.NoError(t, wal.Close())
+
+	lru2, err := lazylru.Recover[string, int](snapPath, walPath, 3, time.Hour)
+	require.NoError(t, err)
+	defer lru2.Close()
+	require.Equal(t, 2, lru2.Len())
+	for key, expected := range map[string]int{"c": 3, "d": 4} {
+		v, ok := lru2.Get(key)
+		require.True(t, ok, key)
+		require.Equal(t, expected, v, key)
+	}
+}
+
+func TestWALTornTail(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "cache.wal")
+	wal, err := lazylru.OpenWAL[string, int](walPath, lazylru.SyncAlways, 0)
+	require.NoError(t, err)
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	lru.UseWAL(wal)
+	lru.Set("a", 1)
+	lru.Set("b", 2)
+	lru.Close()
+	require.NoError(t, wal.Close())
+
+	// cut the last record in half
+	info, err := os.Stat(walPath)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(walPath, info.Size()-3))
+
+	lru2, err := lazylru.Recover[string, int]("", walPath, 10, time.Hour)
+	require.NoError(t, err)
+	defer lru2.Close()
+	require.Equal(t, 1, lru2.Len())
+
+	// reopening cuts off the damage, so new records are readable
+	wal, err = lazylru.OpenWAL[string, int](walPath, lazylru.SyncAlways, 0)
+	require.NoError(t, err)
+	lru2.UseWAL(wal)
+	lru2.Set("c", 3)
+	require.NoError(t, wal.Close())
+
+	lru3, err := lazylru.Recover[string, int]("", walPath, 10, time.Hour)
+	require.NoError(t, err)
+	defer lru3.Close()
+	require.Equal(t, 2, lru3.Len())
+	_, ok := lru3.Get("c")
+	require.True(t, ok)
+}
+
+func TestWALMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	lru, err := lazylru.Recover[string, int](filepath.Join(dir, "nope.snap"), filepath.Join(dir, "nope.wal"), 10, time.Hour)
+	require.NoError(t, err)
+	defer lru.Close()
+	require.Equal(t, 0, lru.Len())
+}
+
+func TestWALErrorsCounted(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "cache.wal")
+	wal, err := lazylru.OpenWAL[string, int](walPath, lazylru.SyncAlways, 0)
+	require.NoError(t, err)
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	defer lru.Close()
+	lru.UseWAL(wal)
+	require.NoError(t, wal.Close())
+	lru.Set("a", 1)
+	require.Equal(t, uint32(1), lru.Stats().WALErrors)
+	_, ok := lru.Get("a")
+	require.True(t, ok)
+}
+
+func TestWALRecoverPrioritiesAndPins(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "cache.wal")
+	snapPath := filepath.Join(dir, "cache.snap")
+	wal, err := lazylru.OpenWAL[string, int](walPath, lazylru.SyncAlways, 0)
+	require.NoError(t, err)
+
+	lru := lazylru.NewT[string, int](10, time.Hour)
+	lru.UseWAL(wal)
+	require.NoError(t, lru.MSet([]string{"a", "b"}, []int{1, 2}))
+	lru.SetTTLPriority("c", 3, time.Hour, lazylru.PriorityHigh)
+	require.NoError(t, lru.SetPinned("c", 4))
+	require.NoError(t, lru.SetPinned("d", 5))
+	require.NoError(t, lru.SetPinned("e", 6))
+	lru.Unpin("e")
+
+	check := func(lru2 *lazylru.LazyLRU[string, int]) {
+		require.Equal(t, 5, lru2.Len())
+		require.Equal(t, 2, lru2.PinnedLen())
+		require.Equal(t, 3, lru2.PriorityLen(lazylru.PriorityNormal))
+		for key, expected := range map[string]lazylru.Priority{
+			"a": lazylru.PriorityNormal,
+			"b": lazylru.PriorityNormal,
+			"c": lazylru.PriorityHigh,
+			"d": lazylru.PriorityNormal,
+			"e": lazylru.PriorityNormal,
+		} {
+			_, info, ok := lru2.Peek(key)
+			require.True(t, ok, key)
+			require.Equal(t, expected, info.Priority, key)
+		}
+		lru2.Unpin("c")
+		require.Equal(t, 1, lru2.PriorityLen(lazylru.PriorityHigh))
+	}
+
+	lru2, err := lazylru.Recover[string, int]("", walPath, 10, time.Hour)
+	require.NoError(t, err)
+	check(lru2)
+	lru2.Close()
+
+	// the same has to hold when the items come from a snapshot
+	require.NoError(t, lru.Snapshot(snapPath))
+	lru.Close()
+	require.NoError(t, wal.Close())
+	lru3, err := lazylru.Recover[string, int](snapPath, walPath, 10, time.Hour)
+	require.NoError(t, err)
+	defer lru3.Close()
+	check(lru3)
+}
+
+func TestWALDeleteAfterEviction(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "cache.wal")
+	wal, err := lazylru.OpenWAL[string, int](walPath, lazylru.SyncAlways, 0)
+	require.NoError(t, err)
+
+	lru := lazylru.NewT[string, int](1, time.Hour)
+	lru.UseWAL(wal)
+	lru.Set("a", 1)
+	lru.Set("b", 2) // evicts a, which is still in the log
+	lru.Delete("a")
+	lru.Close()
+	require.NoError(t, wal.Close())
+
+	lru2, err := lazylru.Recover[string, int]("", walPath, 10, time.Hour)
+	require.NoError(t, err)
+	defer lru2.Close()
+	_, ok := lru2.Get("a")
+	require.False(t, ok)
+	require.Equal(t, 1, lru2.Len())
+}
+
+func TestWALConcurrentClose(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		wal, err := lazylru.OpenWAL[string, int](filepath.Join(t.TempDir(), "cache.wal"), lazylru.SyncInterval, time.Millisecond)
+		require.NoError(t, err)
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				require.NoError(t, wal.Close())
+			}()
+		}
+		close(start)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,80 @@
+package lazylru
+
+import (
+	"context"
+
+	heap "github.com/TriggerMail/lazylru/containers/heap"
+)
+
+// setWeigher limits the total weight of the values in the cache, alongside
+// the limit on the number of items. Items are evicted in the usual order until
+// the cache is back within the limit, and an item that outweighs the whole
+// limit on its own is not kept. Pinned items count against the limit but are
+// not evicted for it. With a maxWeight of zero or fewer, the weight is kept
+// track of, but not limited.
+func (lru *LazyLRU[K, V]) setWeigher(weigh func(V) int64, maxWeight int64) {
+	lru.lock.Lock()
+	if lru.isClosed {
+		lru.lock.Unlock()
+		return
+	}
+	old := lru.weight
+	lru.weigh, lru.weight, lru.maxWeight = weigh, 0, maxWeight
+	for _, pqi := range lru.index {
+		lru.weight += weigh(pqi.value)
+	}
+	lru.countBudgetWeight(lru.weight - old)
+	deathList := lru.evictOverweight(nil)
+	lru.lock.Unlock()
+	lru.afterEvict(context.Background(), deathList)
+}
+
+// addWeight adds or, with a sign of -1, removes the weight of a value, both in
+// the cache and in its budget, if it has one. This is NOT thread safe and
+// should always be called with a write lock
+func (lru *LazyLRU[K, V]) addWeight(value V, sign int64) {
+	if lru.weigh != nil {
+		w := sign * lru.weigh(value)
+		lru.weight += w
+		lru.countBudgetWeight(w)
+	}
+}
+
+// countBudgetWeight adds to the weight counted against the cache's budget, if
+// it has one. This should always be called with a write lock.
+func (lru *LazyLRU[K, V]) countBudgetWeight(w int64) {
+	if lru.budget != nil {
+		lru.budget.weight.Add(w)
+	}
+}
+
+// evictOverweight evicts items from the queue until the cache is within its
+// weight limit. This is NOT thread safe and should always be called with a
+// write lock
+func (lru *LazyLRU[K, V]) evictOverweight(deathList []*item[K, V]) []*item[K, V] {
+	if lru.maxWeight <= 0 {
+		return deathList
+	}
+	for lru.weight > lru.maxWeight && lru.items.Len() > 0 {
+		if deathList == nil {
+			deathList = lru.newDeathList()
+		}
+		if lru.lfu {
+			lru.refreshHead()
+		}
+		deadGuy := heap.Pop(&lru.items)
+		lru.unindex(deadGuy.key)
+		deathList = append(deathList, deadGuy)
+		lru.classLen[deadGuy.priority]--
+		lru.stats.Evictions++
+		lru.stats.EvictionsByPriority[deadGuy.priority]++
+	}
+	return deathList
+}
+
+// heldWeight returns the total weight of the values in the cache
+func (lru *LazyLRU[K, V]) heldWeight() int64 {
+	lru.lock.RLock()
+	defer lru.lock.RUnlock()
+	return lru.weight
+}